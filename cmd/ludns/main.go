@@ -24,6 +24,7 @@ import (
 	_ "github.com/luids-io/api/dnsutil/grpc/resolvcollect"
 	_ "github.com/luids-io/api/event/grpc/notify"
 	_ "github.com/luids-io/api/xlist/grpc/check"
+	_ "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 var directives = []string{
@@ -16,11 +16,27 @@ func Default(program string) *goconfig.Config {
 			Name:     "resolvcache",
 			Required: true,
 			Data: &iconfig.ResolvCacheCfg{
+				Backend:    "memory",
+				Disk:       iconfig.DiskStoreCfg{SegmentSecs: 3600},
 				DumpSecs:   60,
+				DumpFormat: "text",
+				TTL:        iconfig.TTLCfg{GraceSecs: 30, MinSecs: 60},
+				History:    4,
+				Failures:   32,
 				Limits:     resolvcache.DefaultLimits(),
 				ExpireSecs: 3600,
 			},
 		},
+		goconfig.Section{
+			Name:     "replica",
+			Required: true,
+			Data: &iconfig.ResolvReplicaCfg{
+				Log:       true,
+				BatchSize: 256,
+				WaitSecs:  1,
+				QueueSize: 8192,
+			},
+		},
 		goconfig.Section{
 			Name:     "service.dnsutil.resolvcollect",
 			Required: true,
@@ -37,6 +53,29 @@ func Default(program string) *goconfig.Config {
 				Log:    true,
 			},
 		},
+		goconfig.Section{
+			Name:     "service.dnsutil.resolvquery",
+			Required: true,
+			Data: &iconfig.ResolvQueryAPICfg{
+				Enable: true,
+				Log:    true,
+			},
+		},
+		goconfig.Section{
+			Name:     "service.dnsutil.resolvadmin",
+			Required: true,
+			Data: &iconfig.ResolvAdminAPICfg{
+				Log: true,
+			},
+		},
+		goconfig.Section{
+			Name:     "dnstap",
+			Required: true,
+			Data: &iconfig.DnstapCfg{
+				Log:         true,
+				TimeoutSecs: 10,
+			},
+		},
 		goconfig.Section{
 			Name:     "server",
 			Required: true,
@@ -50,6 +89,16 @@ func Default(program string) *goconfig.Config {
 			Required: false,
 			Data:     &cconfig.ServerCfg{},
 		},
+		goconfig.Section{
+			Name:     "server.admin",
+			Required: false,
+			Data:     &cconfig.ServerCfg{},
+		},
+		goconfig.Section{
+			Name:     "server.replica",
+			Required: false,
+			Data:     &cconfig.ServerCfg{},
+		},
 		goconfig.Section{
 			Name:     "log",
 			Required: true,
@@ -3,7 +3,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
@@ -12,11 +14,17 @@ import (
 	apicollect "github.com/luids-io/api/dnsutil/grpc/resolvcollect"
 	cconfig "github.com/luids-io/common/config"
 	cfactory "github.com/luids-io/common/factory"
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/core/ipfilter"
 	"github.com/luids-io/core/serverd"
 	"github.com/luids-io/core/yalogi"
 	iconfig "github.com/luids-io/dns/internal/config"
 	ifactory "github.com/luids-io/dns/internal/factory"
 	"github.com/luids-io/dns/pkg/resolvcache"
+	apiadmin "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvadmin"
+	apiquery "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
+	apirecord "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
+	apireplica "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvreplica"
 	"github.com/luids-io/dns/pkg/resolvcache/tracelog"
 )
 
@@ -58,9 +66,35 @@ func createTraceLogger(msrv *serverd.Manager, logger yalogi.Logger) (resolvcache
 	return trace, nil
 }
 
-func createResolvCache(trace resolvcache.TraceLogger, msrv *serverd.Manager, logger yalogi.Logger) (*resolvcache.Service, error) {
+func createReplicaPeers(msrv *serverd.Manager, logger yalogi.Logger) ([]resolvcache.Option, error) {
+	cfgReplica := cfg.Data("replica").(*iconfig.ResolvReplicaCfg)
 	cfgRCache := cfg.Data("resolvcache").(*iconfig.ResolvCacheCfg)
-	cache, err := ifactory.ResolvCache(cfgRCache, trace, logger)
+	if cfgRCache.Backend == iconfig.DiskBackend && (cfgReplica.Enable || len(cfgReplica.Peers) > 0) {
+		return nil, errors.New("replica is not supported by disk backend")
+	}
+	clients, opts, err := ifactory.ResolvReplicaPeers(cfgReplica, logger)
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) > 0 {
+		msrv.Register(serverd.Service{
+			Name: "replica.peers",
+			Shutdown: func() {
+				for _, c := range clients {
+					c.Close()
+				}
+			},
+		})
+	}
+	return opts, nil
+}
+
+func createResolvCache(trace resolvcache.TraceLogger, opts []resolvcache.Option, msrv *serverd.Manager, logger yalogi.Logger) (*resolvcache.Service, error) {
+	cfgRCache := cfg.Data("resolvcache").(*iconfig.ResolvCacheCfg)
+	if len(replayFiles) > 0 {
+		opts = append(opts, resolvcache.ReplayTrace(replayFiles...))
+	}
+	cache, err := ifactory.ResolvCache(cfgRCache, trace, logger, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -80,11 +114,29 @@ func createCollectAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *server
 			return err
 		}
 		apicollect.RegisterServer(gsrv, gsvc)
+		rsvc, err := ifactory.ResolvRecordAPI(cfgAPI, csvc, logger)
+		if err != nil {
+			return err
+		}
+		apirecord.RegisterServer(gsrv, rsvc)
 		msrv.Register(serverd.Service{Name: "service.dnsutil.resolvcollect"})
 	}
 	return nil
 }
 
+func createReplicaAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgAPI := cfg.Data("replica").(*iconfig.ResolvReplicaCfg)
+	if cfgAPI.Enable {
+		gsvc, err := ifactory.ResolvReplicaAPI(cfgAPI, csvc, logger)
+		if err != nil {
+			return err
+		}
+		apireplica.RegisterServer(gsrv, gsvc)
+		msrv.Register(serverd.Service{Name: "service.dnsutil.resolvreplica"})
+	}
+	return nil
+}
+
 func createCheckAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *serverd.Manager, logger yalogi.Logger) error {
 	cfgAPI := cfg.Data("service.dnsutil.resolvcheck").(*iconfig.ResolvCheckAPICfg)
 	if cfgAPI.Enable {
@@ -98,6 +150,57 @@ func createCheckAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *serverd.
 	return nil
 }
 
+func createQueryAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgAPI := cfg.Data("service.dnsutil.resolvquery").(*iconfig.ResolvQueryAPICfg)
+	if cfgAPI.Enable {
+		gsvc, err := ifactory.ResolvQueryAPI(cfgAPI, csvc, logger)
+		if err != nil {
+			return err
+		}
+		apiquery.RegisterServer(gsrv, gsvc)
+		msrv.Register(serverd.Service{Name: "service.dnsutil.resolvquery"})
+	}
+	return nil
+}
+
+func createAdminAPI(gsrv *grpc.Server, csvc *resolvcache.Service, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgAPI := cfg.Data("service.dnsutil.resolvadmin").(*iconfig.ResolvAdminAPICfg)
+	if cfgAPI.Enable {
+		gsvc, err := ifactory.ResolvAdminAPI(cfgAPI, csvc, logger)
+		if err != nil {
+			return err
+		}
+		apiadmin.RegisterServer(gsrv, gsvc)
+		msrv.Register(serverd.Service{Name: "service.dnsutil.resolvadmin"})
+		if cfgAPI.HTTPURI != "" {
+			hlis, err := util.Listener(cfgAPI.HTTPURI)
+			if err != nil {
+				return err
+			}
+			// http uses the same access restrictions of the admin server
+			filter := ipfilter.Whitelist(adminAllowed())
+			filter.Wrapped = apiadmin.NewHandler(gsvc)
+			hsrv := &http.Server{Handler: filter}
+			msrv.Register(serverd.Service{
+				Name:     fmt.Sprintf("service.dnsutil.resolvadmin.http.[%s]", cfgAPI.HTTPURI),
+				Start:    func() error { go hsrv.Serve(hlis); return nil },
+				Shutdown: func() { hsrv.Close() },
+			})
+		}
+	}
+	return nil
+}
+
+// adminAllowed returns the addresses allowed in the admin server, only
+// localhost is allowed if none is configured.
+func adminAllowed() []string {
+	cfgServer := cfg.Data("server.admin").(*cconfig.ServerCfg)
+	if len(cfgServer.Allowed) == 0 {
+		return []string{"127.0.0.1", "::1"}
+	}
+	return cfgServer.Allowed
+}
+
 func createServer(msrv *serverd.Manager) (*grpc.Server, error) {
 	cfgServer := cfg.Data("server").(*cconfig.ServerCfg)
 	glis, gsrv, err := cfactory.Server(cfgServer)
@@ -142,3 +245,82 @@ func createCollectSrv(msrv *serverd.Manager) (*grpc.Server, error) {
 	})
 	return gsrv, nil
 }
+
+func createDnstap(csvc *resolvcache.Service, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgTap := cfg.Data("dnstap").(*iconfig.DnstapCfg)
+	if cfgTap.Enable {
+		tlis, tap, err := ifactory.Dnstap(cfgTap, csvc, logger)
+		if err != nil {
+			return err
+		}
+		msrv.Register(serverd.Service{
+			Name:     fmt.Sprintf("dnstap.[%s]", cfgTap.ListenURI),
+			Start:    func() error { go tap.Serve(tlis); return nil },
+			Shutdown: func() { tap.Close() },
+		})
+	}
+	return nil
+}
+
+// createReplicaSrv creates the server of the replica api. Peers insert
+// records in the cache, so it requires its own listenuri and the list of
+// allowed peers.
+func createReplicaSrv(msrv *serverd.Manager) (*grpc.Server, error) {
+	cfgAPI := cfg.Data("replica").(*iconfig.ResolvReplicaCfg)
+	if !cfgAPI.Enable {
+		return nil, nil
+	}
+	cfgServer := cfg.Data("server.replica").(*cconfig.ServerCfg)
+	if cfgServer.ListenURI == "" {
+		return nil, errors.New("replica api requires server.replica listenuri")
+	}
+	if len(cfgServer.Allowed) == 0 {
+		return nil, errors.New("replica api requires server.replica allowed")
+	}
+	glis, gsrv, err := cfactory.Server(cfgServer)
+	if err == cfactory.ErrURIServerExists {
+		return nil, errors.New("replica server must use its own listenuri")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfgServer.Metrics {
+		grpc_prometheus.Register(gsrv)
+	}
+	msrv.Register(serverd.Service{
+		Name:     fmt.Sprintf("server.replica.[%s]", cfgServer.ListenURI),
+		Start:    func() error { go gsrv.Serve(glis); return nil },
+		Shutdown: gsrv.GracefulStop,
+		Stop:     gsrv.Stop,
+	})
+	return gsrv, nil
+}
+
+func createAdminSrv(msrv *serverd.Manager) (*grpc.Server, error) {
+	cfgAPI := cfg.Data("service.dnsutil.resolvadmin").(*iconfig.ResolvAdminAPICfg)
+	if !cfgAPI.Enable {
+		return nil, nil
+	}
+	cfgServer := *cfg.Data("server.admin").(*cconfig.ServerCfg)
+	if cfgServer.ListenURI == "" {
+		return nil, errors.New("admin api requires server.admin listenuri")
+	}
+	cfgServer.Allowed = adminAllowed()
+	glis, gsrv, err := cfactory.Server(&cfgServer)
+	if err == cfactory.ErrURIServerExists {
+		return nil, errors.New("admin server must use its own listenuri")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfgServer.Metrics {
+		grpc_prometheus.Register(gsrv)
+	}
+	msrv.Register(serverd.Service{
+		Name:     fmt.Sprintf("server.admin.[%s]", cfgServer.ListenURI),
+		Start:    func() error { go gsrv.Serve(glis); return nil },
+		Shutdown: gsrv.GracefulStop,
+		Stop:     gsrv.Stop,
+	})
+	return gsrv, nil
+}
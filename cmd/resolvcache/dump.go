@@ -0,0 +1,95 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// runDump reads json dump files and prints records matching filters
+func runDump(files []string) error {
+	filter, err := getDumpFilter()
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	var printRecord func(r resolvcache.DumpRecord) error
+	switch strings.ToLower(dumpOutput) {
+	case "json":
+		enc := json.NewEncoder(out)
+		printRecord = func(r resolvcache.DumpRecord) error {
+			return enc.Encode(r)
+		}
+	case "csv":
+		printRecord = func(r resolvcache.DumpRecord) error {
+			client := r.Client.String()
+			if r.Prefix > 0 {
+				client = fmt.Sprintf("%s/%v", client, r.Prefix)
+			}
+			_, err := fmt.Fprintf(out, "%s,%s,%s,%s,%s\n", client, r.Resolved, r.Name,
+				r.Timestamp.Format(time.RFC3339), r.Last.Format(time.RFC3339))
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid output format '%s'", dumpOutput)
+	}
+	if len(files) == 0 {
+		return resolvcache.ReadDump(os.Stdin, filter, printRecord)
+	}
+	for _, fname := range files {
+		err := readDumpFile(fname, filter, printRecord)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDumpFile(fname string, filter resolvcache.DumpFilter, fn func(resolvcache.DumpRecord) error) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = resolvcache.ReadDump(file, filter, fn)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fname, err)
+	}
+	return nil
+}
+
+func getDumpFilter() (resolvcache.DumpFilter, error) {
+	filter := resolvcache.DumpFilter{Name: dumpName}
+	if dumpClient != "" {
+		_, cidr, err := net.ParseCIDR(dumpClient)
+		if err != nil {
+			ip := net.ParseIP(dumpClient)
+			if ip == nil {
+				return filter, fmt.Errorf("invalid client '%s'", dumpClient)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			cidr = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+		}
+		filter.Client = cidr
+	}
+	if dumpResolved != "" {
+		filter.Resolved = net.ParseIP(dumpResolved)
+		if filter.Resolved == nil {
+			return filter, errors.New("invalid resolved ip")
+		}
+	}
+	return filter, nil
+}
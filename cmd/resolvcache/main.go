@@ -28,6 +28,14 @@ var (
 	help       = false
 	debug      = false
 	dryRun     = false
+	//dump command filters
+	dumpClient   = ""
+	dumpResolved = ""
+	dumpName     = ""
+	dumpOutput   = "json"
+	//replay params
+	replayFiles []string
+	replayDump  = ""
 )
 
 func init() {
@@ -39,6 +47,14 @@ func init() {
 	pflag.BoolVarP(&help, "help", "h", help, "Show this help.")
 	pflag.BoolVar(&debug, "debug", debug, "Enable debug.")
 	pflag.BoolVar(&dryRun, "dry-run", dryRun, "Checks and construct list but not start service.")
+	//dump command params
+	pflag.StringVar(&dumpClient, "client", dumpClient, "Dump command: filter by client ip or cidr.")
+	pflag.StringVar(&dumpResolved, "resolved", dumpResolved, "Dump command: filter by resolved ip.")
+	pflag.StringVar(&dumpName, "name", dumpName, "Dump command: filter by name.")
+	pflag.StringVar(&dumpOutput, "output", dumpOutput, "Dump command: output format json or csv.")
+	//replay params
+	pflag.StringSliceVar(&replayFiles, "replay", replayFiles, "Trace files to replay before starting the service.")
+	pflag.StringVar(&replayDump, "replay-dump", replayDump, "Replay trace files, write the dump to file (- is stdout) and exit.")
 	pflag.Parse()
 }
 
@@ -51,6 +67,15 @@ func main() {
 		pflag.Usage()
 		os.Exit(0)
 	}
+	// dump command reads json dumps: resolvcache dump [flags] [files...]
+	if pflag.Arg(0) == "dump" {
+		err := runDump(pflag.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 	// load configuration
 	err := cfg.LoadIfFile(configFile)
 	if err != nil {
@@ -71,6 +96,19 @@ func main() {
 		logger.Debugf("configuration dump:\n%v", cfg.Dump())
 	}
 
+	// replay trace files and exit
+	if replayDump != "" {
+		err := runReplay(replayDump, logger)
+		if err != nil {
+			logger.Fatalf("replaying trace files: %v", err)
+		}
+		os.Exit(0)
+	}
+	err = checkReplay()
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+
 	// creates main server manager instance
 	msrv := serverd.New(Program, serverd.SetLogger(logger))
 
@@ -79,8 +117,13 @@ func main() {
 	if err != nil {
 		logger.Fatalf("creating cache logger: %v", err)
 	}
+	// create replica peers
+	replicas, err := createReplicaPeers(msrv, logger)
+	if err != nil {
+		logger.Fatalf("creating replica peers: %v", err)
+	}
 	// create resolv cache
-	cache, err := createResolvCache(trace, msrv, logger)
+	cache, err := createResolvCache(trace, replicas, msrv, logger)
 	if err != nil {
 		logger.Fatalf("creating resolv cache: %v", err)
 	}
@@ -99,6 +142,10 @@ func main() {
 	if err != nil {
 		logger.Fatalf("creating check api: %v", err)
 	}
+	err = createQueryAPI(fgsrv, cache, msrv, logger)
+	if err != nil {
+		logger.Fatalf("creating query api: %v", err)
+	}
 
 	// create collector server
 	cgsrv, err := createCollectSrv(msrv)
@@ -110,6 +157,36 @@ func main() {
 		logger.Fatalf("creating collect api: %v", err)
 	}
 
+	// create replica server
+	rgsrv, err := createReplicaSrv(msrv)
+	if err != nil {
+		logger.Fatalf("creating replica server: %v", err)
+	}
+	if rgsrv != nil {
+		err = createReplicaAPI(rgsrv, cache, msrv, logger)
+		if err != nil {
+			logger.Fatalf("creating replica api: %v", err)
+		}
+	}
+
+	// create dnstap listener
+	err = createDnstap(cache, msrv, logger)
+	if err != nil {
+		logger.Fatalf("creating dnstap listener: %v", err)
+	}
+
+	// create admin server
+	agsrv, err := createAdminSrv(msrv)
+	if err != nil {
+		logger.Fatalf("creating admin server: %v", err)
+	}
+	if agsrv != nil {
+		err = createAdminAPI(agsrv, cache, msrv, logger)
+		if err != nil {
+			logger.Fatalf("creating admin api: %v", err)
+		}
+	}
+
 	// creates health server
 	err = createHealthSrv(msrv, logger)
 	if err != nil {
@@ -0,0 +1,72 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/luids-io/core/yalogi"
+	iconfig "github.com/luids-io/dns/internal/config"
+	ifactory "github.com/luids-io/dns/internal/factory"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// checkReplay returns an error if the trace file of the service is in the
+// replay files, it's truncated when the service is created.
+func checkReplay() error {
+	cfgRCache := cfg.Data("resolvcache").(*iconfig.ResolvCacheCfg)
+	if cfgRCache.Backend == iconfig.DiskBackend && len(replayFiles) > 0 {
+		return errors.New("replay is not supported by disk backend")
+	}
+	for _, fname := range replayFiles {
+		if cfgRCache.TraceFile != "" && fname == cfgRCache.TraceFile {
+			return fmt.Errorf("trace file '%s' can't be replayed by the service, copy it first", fname)
+		}
+	}
+	return nil
+}
+
+// runReplay replays trace files in a cache and writes a dump of the cache
+// using the dump format, "-" is stdout.
+func runReplay(output string, logger yalogi.Logger) error {
+	if len(replayFiles) == 0 {
+		return errors.New("required trace files to replay")
+	}
+	cfgRCache := cfg.Data("resolvcache").(*iconfig.ResolvCacheCfg)
+	cache, err := ifactory.Cache(cfgRCache)
+	if err != nil {
+		return err
+	}
+	for _, fname := range replayFiles {
+		st, err := cache.ReplayFile(fname)
+		if err != nil {
+			return fmt.Errorf("replaying %s: %v", fname, err)
+		}
+		logger.Infof("replayed %s: %v collects, %v stored, %v expired, %v invalid lines",
+			fname, st.Collects, st.Stored, st.Expired, st.Invalid)
+	}
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	format, _ := resolvcache.ToDumpFormat(cfgRCache.DumpFormat)
+	if format == resolvcache.DumpJSON {
+		err = cache.DumpRecords(w)
+	} else {
+		cache.Dump(w)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -7,6 +7,7 @@ import (
 	cconfig "github.com/luids-io/common/config"
 	cfactory "github.com/luids-io/common/factory"
 	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
 )
 
 func createLogger(debug bool) (yalogi.Logger, error) {
@@ -25,3 +26,15 @@ func createClient(logger yalogi.Logger) (*resolvcheck.Client, error) {
 	client := resolvcheck.NewClient(dial, resolvcheck.SetLogger(logger))
 	return client, nil
 }
+
+func createQueryClient(logger yalogi.Logger) (*resolvquery.Client, error) {
+	//create dial
+	cfgDial := cfg.Data("client").(*cconfig.ClientCfg)
+	dial, err := cfactory.ClientConn(cfgDial)
+	if err != nil {
+		return nil, err
+	}
+	//create grpc client
+	client := resolvquery.NewClient(dial, resolvquery.SetLogger(logger))
+	return client, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
+)
+
+// historyWriter writes the history records in csv or json lines.
+type historyWriter struct {
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+// historyRecord is the json output of a history record, ttl in seconds.
+type historyRecord struct {
+	Client   string    `json:"client"`
+	Resolved string    `json:"resolved"`
+	Name     string    `json:"name"`
+	Since    time.Time `json:"since"`
+	Last     time.Time `json:"last"`
+	TTL      int       `json:"ttl,omitempty"`
+	Chain    []string  `json:"chain,omitempty"`
+}
+
+func newHistoryWriter(out io.Writer, format string) (*historyWriter, error) {
+	switch format {
+	case "", "csv":
+		w := csv.NewWriter(out)
+		err := w.Write([]string{"client", "resolved", "name", "since", "last", "ttl", "chain"})
+		return &historyWriter{csv: w}, err
+	case "json":
+		return &historyWriter{enc: json.NewEncoder(out)}, nil
+	}
+	return nil, fmt.Errorf("invalid format '%s'", format)
+}
+
+func (w *historyWriter) write(client string, r resolvcache.HistoryRecord) error {
+	if w.enc != nil {
+		return w.enc.Encode(historyRecord{
+			Client:   client,
+			Resolved: r.Resolved.String(),
+			Name:     r.Name,
+			Since:    r.Since,
+			Last:     r.Last,
+			TTL:      int(r.TTL / time.Second),
+			Chain:    r.Chain,
+		})
+	}
+	return w.csv.Write([]string{
+		client,
+		r.Resolved.String(),
+		r.Name,
+		r.Since.Format(time.RFC3339),
+		r.Last.Format(time.RFC3339),
+		strconv.Itoa(int(r.TTL / time.Second)),
+		strings.Join(r.Chain, ">"),
+	})
+}
+
+func (w *historyWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// getWindow returns the time window from the args in RFC3339 format
+func getWindow(sfrom, sto string) (from time.Time, to time.Time, err error) {
+	if sfrom != "" {
+		from, err = time.Parse(time.RFC3339, sfrom)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if sto != "" {
+		to, err = time.Parse(time.RFC3339, sto)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to: %v", err)
+		}
+		if to.Before(from) {
+			return from, to, fmt.Errorf("invalid window: to is before from")
+		}
+	}
+	return from, to, nil
+}
+
+// queryHistory writes the periods of resolution of the client in arg
+func queryHistory(client *resolvquery.Client, out *historyWriter, arg string, from, to time.Time) error {
+	ip := net.ParseIP(arg)
+	if ip == nil {
+		return fmt.Errorf("invalid client ip '%s'", arg)
+	}
+	records, err := client.History(context.Background(), ip, from, to)
+	if err != nil {
+		return fmt.Errorf("history '%s' returned error: %v", arg, err)
+	}
+	for _, r := range records {
+		if err := out.write(arg, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
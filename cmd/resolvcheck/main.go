@@ -14,6 +14,8 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/luids-io/dns/cmd/resolvcheck/config"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
 )
 
 //Variables for version output
@@ -35,6 +37,20 @@ var (
 	//input
 	inStdin = false
 	inFile  = ""
+	//query modes
+	clientsMode  = false
+	lookupMode   = false
+	failuresMode = false
+	statsMode    = false
+	historyMode  = false
+	historyFrom  = ""
+	historyTo    = ""
+	historyFmt   = "csv"
+	matchMode    = false
+	matchType    = "exact"
+	matchAt      = ""
+	//batch size, zero disables
+	batchSize = 0
 )
 
 func init() {
@@ -48,6 +64,19 @@ func init() {
 	//input params
 	pflag.BoolVar(&inStdin, "stdin", inStdin, "From stdin.")
 	pflag.StringVarP(&inFile, "file", "f", inFile, "File for input.")
+	pflag.IntVar(&batchSize, "batch", batchSize, "Check in batches of this size using the query api.")
+	//query params
+	pflag.BoolVar(&clientsMode, "clients", clientsMode, "Query clients that resolved the ips or names passed as args.")
+	pflag.BoolVar(&lookupMode, "lookup", lookupMode, "Query names resolved by the client for the ip in args client,resolved.")
+	pflag.BoolVar(&failuresMode, "failures", failuresMode, "Query negative answers received by the clients passed as args.")
+	pflag.BoolVar(&statsMode, "stats", statsMode, "Query behavioural stats of the clients passed as args, the most recently updated clients if none.")
+	pflag.BoolVar(&historyMode, "history", historyMode, "Query names and ips resolved by the clients passed as args in a time window.")
+	pflag.StringVar(&historyFrom, "from", historyFrom, "Start of the history window in RFC3339 format, all stored if empty.")
+	pflag.StringVar(&historyTo, "to", historyTo, "End of the history window in RFC3339 format, now if empty.")
+	pflag.StringVar(&historyFmt, "format", historyFmt, "Output format of history: csv or json.")
+	pflag.BoolVar(&matchMode, "match", matchMode, "Show ttl, name matched and cname chain of the checks.")
+	pflag.StringVar(&matchType, "mode", matchType, "Match mode used with match: exact, subdomain or domain.")
+	pflag.StringVar(&matchAt, "at", matchAt, "Check at the time in RFC3339 format, implies match.")
 	pflag.Parse()
 }
 
@@ -66,8 +95,16 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if batchSize < 0 || batchSize > resolvquery.MaxBatch {
+		fmt.Fprintf(os.Stderr, "batch must be between 0 and %v\n", resolvquery.MaxBatch)
+		os.Exit(1)
+	}
+	if batchSize > 0 && (matchMode || matchAt != "") {
+		fmt.Fprintln(os.Stderr, "batch is not compatible with match")
+		os.Exit(1)
+	}
 	// check args
-	if len(pflag.Args()) == 0 && !inStdin && inFile == "" {
+	if len(pflag.Args()) == 0 && !inStdin && inFile == "" && !statsMode {
 		fmt.Fprintln(os.Stderr, "required query data")
 		os.Exit(1)
 	}
@@ -78,27 +115,191 @@ func main() {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
-	// create grpc client
-	client, err := createClient(logger)
-	if err != nil {
-		logger.Fatalf("couldn't create client: %v", err)
+	// query clients mode
+	if clientsMode {
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		for _, arg := range pflag.Args() {
+			err := queryClients(qclient, arg)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+		return
 	}
-	defer client.Close()
-
-	// process args
-	if !inStdin && inFile == "" {
+	// query stats mode
+	if statsMode {
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		args := pflag.Args()
+		if len(args) == 0 {
+			args = []string{""}
+		}
+		for _, arg := range args {
+			err := queryStats(qclient, arg)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+		return
+	}
+	// query history mode
+	if historyMode {
+		from, to, err := getWindow(historyFrom, historyTo)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		out, err := newHistoryWriter(os.Stdout, historyFmt)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		for _, arg := range pflag.Args() {
+			err := queryHistory(qclient, out, arg, from, to)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+		if err := out.flush(); err != nil {
+			logger.Fatalf("%v", err)
+		}
+		return
+	}
+	// query failures mode
+	if failuresMode {
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		for _, arg := range pflag.Args() {
+			err := queryFailures(qclient, arg)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+		return
+	}
+	// query names mode
+	if lookupMode {
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
 		for _, arg := range pflag.Args() {
 			data, err := getValues(arg)
 			if err != nil {
 				logger.Fatalf("%v", err)
 			}
-			startc := time.Now()
+			err = queryNames(qclient, data)
+			if err != nil {
+				logger.Fatalf("%v", err)
+			}
+		}
+		return
+	}
+	// create grpc client
+	var check func(data recordData) (string, error)
+	var checkMany func(batch []recordData) ([]string, error)
+	if batchSize > 0 {
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		checkMany = func(batch []recordData) ([]string, error) {
+			return checkBatch(qclient, batch)
+		}
+	} else if matchMode || matchAt != "" {
+		mode, err := resolvcache.ToMatchMode(matchType)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		var at time.Time
+		if matchAt != "" {
+			at, err = time.Parse(time.RFC3339, matchAt)
+			if err != nil {
+				logger.Fatalf("invalid time: %v", err)
+			}
+		}
+		qclient, err := createQueryClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer qclient.Close()
+		check = func(data recordData) (string, error) {
+			return checkMatch(qclient, data, mode, at)
+		}
+	} else {
+		client, err := createClient(logger)
+		if err != nil {
+			logger.Fatalf("couldn't create client: %v", err)
+		}
+		defer client.Close()
+		check = func(data recordData) (string, error) {
 			resp, err := client.Check(context.Background(), data.client, data.resolved, data.name)
 			if err != nil {
-				logger.Fatalf("Check '%s' returned error: %v", arg, err)
+				return "", err
 			}
-			fmt.Fprintf(os.Stdout, "%v,%v,%s: %v,%v,%v (%v)\n", data.client, data.resolved, data.name, resp.Result, resp.Last, resp.Store, time.Since(startc))
+			return fmt.Sprintf("%v,%v,%v", resp.Result, resp.Last, resp.Store), nil
+		}
+	}
+
+	// checks in batches if enabled
+	var batch []recordData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		startc := time.Now()
+		resps, err := checkMany(batch)
+		if err != nil {
+			logger.Fatalf("check batch returned error: %v", err)
 		}
+		elapsed := time.Since(startc)
+		for i, data := range batch {
+			fmt.Fprintf(os.Stdout, "%v,%v,%s: %s\n", data.client, data.resolved, data.name, resps[i])
+		}
+		fmt.Fprintf(os.Stdout, "batch %v checks (%v)\n", len(batch), elapsed)
+		batch = batch[:0]
+	}
+	process := func(line string) {
+		data, err := getValues(line)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		if batchSize > 0 {
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				flush()
+			}
+			return
+		}
+		startc := time.Now()
+		resp, err := check(data)
+		if err != nil {
+			logger.Fatalf("Check '%s' returned error: %v", line, err)
+		}
+		fmt.Fprintf(os.Stdout, "%v,%v,%s: %s (%v)\n", data.client, data.resolved, data.name, resp, time.Since(startc))
+	}
+
+	// process args
+	if !inStdin && inFile == "" {
+		for _, arg := range pflag.Args() {
+			process(arg)
+		}
+		flush()
 		return
 	}
 
@@ -118,17 +319,9 @@ func main() {
 		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
 			continue
 		}
-		data, err := getValues(line)
-		if err != nil {
-			logger.Fatalf("%v", err)
-		}
-		startc := time.Now()
-		resp, err := client.Check(context.Background(), data.client, data.resolved, data.name)
-		if err != nil {
-			logger.Fatalf("Check '%s' returned error: %v", line, err)
-		}
-		fmt.Fprintf(os.Stdout, "%v,%v,%s: %v,%v,%v (%v)\n", data.client, data.resolved, data.name, resp.Result, resp.Last, resp.Store, time.Since(startc))
+		process(line)
 	}
+	flush()
 	if err := scanner.Err(); err != nil {
 		logger.Fatalf("%v", err)
 	}
@@ -0,0 +1,117 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
+)
+
+// queryClients prints the clients that resolved the ip or name in arg
+func queryClients(client *resolvquery.Client, arg string) error {
+	var resolved net.IP
+	var name string
+	if resolved = net.ParseIP(arg); resolved == nil {
+		name = arg
+	}
+	startc := time.Now()
+	clients, err := client.Clients(context.Background(), resolved, name)
+	if err != nil {
+		return fmt.Errorf("clients '%s' returned error: %v", arg, err)
+	}
+	fmt.Fprintf(os.Stdout, "%s: %v clients (%v)\n", arg, len(clients), time.Since(startc))
+	for _, c := range clients {
+		fmt.Fprintf(os.Stdout, "%s,%v\n", c.Client, c.Last.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// queryNames prints the names resolved by the client for the ip
+func queryNames(client *resolvquery.Client, data recordData) error {
+	startc := time.Now()
+	names, err := client.Lookup(context.Background(), data.client, data.resolved)
+	if err != nil {
+		return fmt.Errorf("lookup '%v,%v' returned error: %v", data.client, data.resolved, err)
+	}
+	fmt.Fprintf(os.Stdout, "%v,%v: %v names (%v)\n", data.client, data.resolved, len(names), time.Since(startc))
+	for _, n := range names {
+		fmt.Fprintf(os.Stdout, "%s,%v,%s\n", n.Name, n.Last.Format(time.RFC3339), strings.Join(n.Chain, ">"))
+	}
+	return nil
+}
+
+// queryFailures prints the negative answers received by the client in arg
+func queryFailures(client *resolvquery.Client, arg string) error {
+	ip := net.ParseIP(arg)
+	if ip == nil {
+		return fmt.Errorf("invalid client ip '%s'", arg)
+	}
+	startc := time.Now()
+	info, err := client.Failures(context.Background(), ip)
+	if err != nil {
+		return fmt.Errorf("failures '%s' returned error: %v", arg, err)
+	}
+	fmt.Fprintf(os.Stdout, "%v: %v nxdomain, %v nodata, %v names (%v)\n", info.Client, info.NXDomain, info.NoData, len(info.Recent), time.Since(startc))
+	for _, f := range info.Recent {
+		fmt.Fprintf(os.Stdout, "%s,%v,%v\n", f.Name, f.Last.Format(time.RFC3339), f.Negative)
+	}
+	return nil
+}
+
+// queryStats prints the behavioural stats of the client in arg, the most
+// recently updated clients if arg is empty
+func queryStats(client *resolvquery.Client, arg string) error {
+	var ip net.IP
+	if arg != "" {
+		if ip = net.ParseIP(arg); ip == nil {
+			return fmt.Errorf("invalid client ip '%s'", arg)
+		}
+	}
+	startc := time.Now()
+	stats, err := client.ClientStats(context.Background(), ip)
+	if err != nil {
+		return fmt.Errorf("stats '%s' returned error: %v", arg, err)
+	}
+	if arg == "" {
+		arg = "all"
+	}
+	fmt.Fprintf(os.Stdout, "%s: %v clients (%v)\n", arg, len(stats), time.Since(startc))
+	for _, st := range stats {
+		fmt.Fprintf(os.Stdout, "%v,%v,%v,%v,%v,%.1f,%.2f,%.1f\n", st.Client, st.First.Format(time.RFC3339),
+			st.Last.Format(time.RFC3339), st.Names, st.Domains, st.LabelLength, st.LabelEntropy, st.Rate)
+	}
+	return nil
+}
+
+// checkMatch returns the result of the check with match information
+func checkMatch(client *resolvquery.Client, data recordData, mode resolvcache.MatchMode, at time.Time) (string, error) {
+	m, err := client.Match(context.Background(), data.client, data.resolved, data.name, mode, at)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v,%v,%v,%v,%v,%s,%s,%v", m.Result, m.Last, m.Store, m.TTL, m.InTTL,
+		m.Name, strings.Join(m.Chain, ">"), m.Since), nil
+}
+
+func checkBatch(client *resolvquery.Client, batch []recordData) ([]string, error) {
+	cs := make([]resolvcache.Check, 0, len(batch))
+	for _, data := range batch {
+		cs = append(cs, resolvcache.Check{Client: data.client, Resolved: data.resolved, Name: data.name})
+	}
+	resps, err := client.CheckMany(context.Background(), cs)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]string, 0, len(resps))
+	for _, resp := range resps {
+		results = append(results, fmt.Sprintf("%v,%v,%v", resp.Result, resp.Last, resp.Store))
+	}
+	return results, nil
+}
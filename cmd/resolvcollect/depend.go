@@ -7,6 +7,7 @@ import (
 	cconfig "github.com/luids-io/common/config"
 	cfactory "github.com/luids-io/common/factory"
 	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 func createLogger(debug bool) (yalogi.Logger, error) {
@@ -14,14 +15,16 @@ func createLogger(debug bool) (yalogi.Logger, error) {
 	return cfactory.Logger(cfgLog, debug)
 }
 
-func createClient(logger yalogi.Logger) (*resolvcollect.Client, error) {
+func createClient(logger yalogi.Logger) (*resolvcollect.Client, *resolvrecord.Client, error) {
 	//create dial
 	cfgDial := cfg.Data("client").(*cconfig.ClientCfg)
 	dial, err := cfactory.ClientConn(cfgDial)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	//create grpc client
+	//create grpc clients, connection is shared
 	client := resolvcollect.NewClient(dial, resolvcollect.SetLogger(logger))
-	return client, nil
+	rclient := resolvrecord.NewClient(dial,
+		resolvrecord.SetLogger(logger), resolvrecord.CloseConnection(false))
+	return client, rclient, nil
 }
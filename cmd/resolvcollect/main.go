@@ -9,12 +9,15 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 
 	"github.com/luids-io/dns/cmd/resolvcollect/config"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 //Variables for version output
@@ -36,6 +39,8 @@ var (
 	//input
 	inStdin = false
 	inFile  = ""
+	//batch size, zero disables
+	batchSize = 0
 )
 
 func init() {
@@ -49,6 +54,7 @@ func init() {
 	//input params
 	pflag.BoolVar(&inStdin, "stdin", inStdin, "From stdin.")
 	pflag.StringVarP(&inFile, "file", "f", inFile, "File for input.")
+	pflag.IntVar(&batchSize, "batch", batchSize, "Collect in batches of this size using the record api.")
 	pflag.Parse()
 }
 
@@ -67,6 +73,10 @@ func main() {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if batchSize < 0 || batchSize > resolvrecord.MaxBatch {
+		fmt.Fprintf(os.Stderr, "batch must be between 0 and %v\n", resolvrecord.MaxBatch)
+		os.Exit(1)
+	}
 	if len(pflag.Args()) == 0 && !inStdin && inFile == "" {
 		fmt.Fprintln(os.Stderr, "required collect data")
 		os.Exit(1)
@@ -79,26 +89,78 @@ func main() {
 		os.Exit(1)
 	}
 	// create grpc client
-	client, err := createClient(logger)
+	client, rclient, err := createClient(logger)
 	if err != nil {
 		logger.Fatalf("couldn't create client: %v", err)
 	}
 	defer client.Close()
+	defer rclient.Close()
+	// records with ttls are collected using the record api
+	collect := func(record recordData) error {
+		if len(record.ttls) > 0 {
+			return rclient.CollectTTL(context.Background(), record.client, record.name, record.resolved, record.cnames, record.ttls)
+		}
+		return client.Collect(context.Background(), record.client, record.name, record.resolved, record.cnames)
+	}
+
+	// collects in batches if enabled
+	var batch []recordData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		rs := make([]resolvcache.Resolution, 0, len(batch))
+		for _, record := range batch {
+			rs = append(rs, resolvcache.Resolution{
+				Client:   record.client,
+				Name:     record.name,
+				CNAMEs:   record.cnames,
+				Resolved: record.resolved,
+				TTLs:     record.ttls,
+			})
+		}
+		startc := time.Now()
+		errs, err := rclient.CollectMany(context.Background(), rs)
+		if err != nil {
+			logger.Fatalf("collect batch returned error: %v", err)
+		}
+		elapsed := time.Since(startc)
+		for i, record := range batch {
+			if errs != nil && errs[i] != nil {
+				fmt.Fprintf(os.Stdout, "%s,%s,%s: %v\n", record.client, record.name, record.resolved, errs[i])
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "%s,%s,%s\n", record.client, record.name, record.resolved)
+		}
+		fmt.Fprintf(os.Stdout, "batch %v records (%v)\n", len(batch), elapsed)
+		batch = batch[:0]
+	}
+	process := func(line string) {
+		record, err := getValue(line)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		if batchSize > 0 {
+			batch = append(batch, record)
+			if len(batch) >= batchSize {
+				flush()
+			}
+			return
+		}
+		startc := time.Now()
+		err = collect(record)
+		if err != nil {
+			logger.Fatalf("collect '%s' returned error: %v", line, err)
+		}
+		fmt.Fprintf(os.Stdout, "%s,%s,%s (%v)\n", record.client, record.name, record.resolved, time.Since(startc))
+	}
 
 	// collect from args
 	if !inStdin && inFile == "" {
 		for _, arg := range pflag.Args() {
-			record, err := getValue(arg)
-			if err != nil {
-				logger.Fatalf("%v", err)
-			}
-			startc := time.Now()
-			err = client.Collect(context.Background(), record.client, record.name, record.resolved, record.cnames)
-			if err != nil {
-				logger.Fatalf("collect '%s' returned error: %v", arg, err)
-			}
-			fmt.Fprintf(os.Stdout, "%s,%s,%s (%v)\n", record.client, record.name, record.resolved, time.Since(startc))
+			process(arg)
 		}
+		flush()
 		return
 	}
 
@@ -118,17 +180,9 @@ func main() {
 		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
 			continue
 		}
-		record, err := getValue(line)
-		if err != nil {
-			logger.Fatalf("%v", err)
-		}
-		startc := time.Now()
-		err = client.Collect(context.Background(), record.client, record.name, record.resolved, record.cnames)
-		if err != nil {
-			logger.Fatalf("collect '%s' returned error: %v", line, err)
-		}
-		fmt.Fprintf(os.Stdout, "%s,%s,%s (%v)\n", record.client, record.name, record.resolved, time.Since(startc))
+		process(line)
 	}
+	flush()
 	if err := scanner.Err(); err != nil {
 		logger.Fatalf("%v", err)
 	}
@@ -138,6 +192,7 @@ type recordData struct {
 	client   net.IP
 	name     string
 	resolved []net.IP
+	ttls     []time.Duration
 	cnames   []string
 }
 
@@ -157,22 +212,39 @@ func getValue(arg string) (recordData, error) {
 	if !isDomain(name) {
 		return data, fmt.Errorf("invalid domain '%v'", name)
 	}
-	// get resolved ips
+	// get resolved ips, with optional ttl in format ip@ttl
 	resolved := values[2:]
 	resolvedIP := make([]net.IP, 0, len(resolved))
 	resolvedCNAME := make([]string, 0, len(resolved))
+	var ttls []time.Duration
 	for _, value := range resolved {
+		ttl := 0
+		if idx := strings.LastIndex(value, "@"); idx > 0 {
+			var err error
+			ttl, err = strconv.Atoi(value[idx+1:])
+			if err != nil || ttl < 0 {
+				return data, fmt.Errorf("invalid ttl '%v'", value)
+			}
+			value = value[:idx]
+		}
 		ip := net.ParseIP(value)
 		if ip == nil {
 			resolvedCNAME = append(resolvedCNAME, value)
 			continue
 		}
 		resolvedIP = append(resolvedIP, ip)
+		if ttl > 0 {
+			for len(ttls) < len(resolvedIP)-1 {
+				ttls = append(ttls, 0)
+			}
+			ttls = append(ttls, time.Duration(ttl)*time.Second)
+		}
 	}
 	// set data
 	data.client = clientIP
 	data.name = name
 	data.resolved = resolvedIP
+	data.ttls = ttls
 	data.cnames = resolvedCNAME
 	return data, nil
 }
@@ -5,6 +5,9 @@ go 1.13
 require (
 	github.com/caddyserver/caddy v1.0.5
 	github.com/coredns/coredns v1.7.0
+	github.com/dnstap/golang-dnstap v0.2.0
+	github.com/farsightsec/golang-framestream v0.0.0-20190425193708-fa4b164d59b8
+	github.com/golang/protobuf v1.4.2
 	github.com/google/uuid v1.2.0
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0
@@ -17,5 +20,6 @@ require (
 	github.com/sirupsen/logrus v1.6.0 // indirect
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
+	golang.org/x/net v0.0.0-20200324143707-d3edc9973b7e
 	google.golang.org/grpc v1.29.1
 )
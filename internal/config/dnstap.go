@@ -0,0 +1,88 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+)
+
+// DnstapCfg stores the preferences of the dnstap listener.
+type DnstapCfg struct {
+	Enable      bool
+	Log         bool
+	ListenURI   string
+	TimeoutSecs int
+	Resolver    bool
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *DnstapCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.BoolVar(&cfg.Enable, aprefix+"enable", cfg.Enable, "Enable collection from dnstap.")
+	pflag.BoolVar(&cfg.Log, aprefix+"log", cfg.Log, "Enable log in dnstap listener.")
+	pflag.StringVar(&cfg.ListenURI, aprefix+"listenuri", cfg.ListenURI, "Dnstap frame stream socket.")
+	pflag.IntVar(&cfg.TimeoutSecs, aprefix+"timeout", cfg.TimeoutSecs, "Timeout in seconds of the handshake of connections.")
+	pflag.BoolVar(&cfg.Resolver, aprefix+"resolver", cfg.Resolver, "Collect resolver responses, the server is stored as client.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *DnstapCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"enable")
+	util.BindViper(v, aprefix+"log")
+	util.BindViper(v, aprefix+"listenuri")
+	util.BindViper(v, aprefix+"timeout")
+	util.BindViper(v, aprefix+"resolver")
+}
+
+// FromViper fill values from viper
+func (cfg *DnstapCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.Enable = v.GetBool(aprefix + "enable")
+	cfg.Log = v.GetBool(aprefix + "log")
+	cfg.ListenURI = v.GetString(aprefix + "listenuri")
+	cfg.TimeoutSecs = v.GetInt(aprefix + "timeout")
+	cfg.Resolver = v.GetBool(aprefix + "resolver")
+}
+
+// Empty returns true if configuration is empty
+func (cfg DnstapCfg) Empty() bool {
+	return false
+}
+
+// Validate checks that configuration is ok
+func (cfg DnstapCfg) Validate() error {
+	if !cfg.Enable {
+		return nil
+	}
+	if cfg.ListenURI == "" {
+		return errors.New("listenuri is required")
+	}
+	if _, _, err := util.ParseListenURI(cfg.ListenURI); err != nil {
+		return fmt.Errorf("invalid listenuri: %v", err)
+	}
+	if cfg.TimeoutSecs < 0 {
+		return errors.New("invalid timeout")
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg DnstapCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+)
+
+// ResolvAdminAPICfg stores admin service preferences
+type ResolvAdminAPICfg struct {
+	Enable  bool
+	Log     bool
+	HTTPURI string
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *ResolvAdminAPICfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.BoolVar(&cfg.Enable, aprefix+"enable", cfg.Enable, "Enable resolv admin api.")
+	pflag.BoolVar(&cfg.Log, aprefix+"log", cfg.Log, "Enable log in service.")
+	pflag.StringVar(&cfg.HTTPURI, aprefix+"httpuri", cfg.HTTPURI, "Export admin api as http json in listen uri.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *ResolvAdminAPICfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"enable")
+	util.BindViper(v, aprefix+"log")
+	util.BindViper(v, aprefix+"httpuri")
+}
+
+// FromViper fill values from viper
+func (cfg *ResolvAdminAPICfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.Enable = v.GetBool(aprefix + "enable")
+	cfg.Log = v.GetBool(aprefix + "log")
+	cfg.HTTPURI = v.GetString(aprefix + "httpuri")
+}
+
+// Empty returns true if configuration is empty
+func (cfg ResolvAdminAPICfg) Empty() bool {
+	return false
+}
+
+// Validate checks that configuration is ok
+func (cfg ResolvAdminAPICfg) Validate() error {
+	if cfg.HTTPURI != "" {
+		if !cfg.Enable {
+			return errors.New("http requires admin api enabled")
+		}
+		_, _, err := util.ParseListenURI(cfg.HTTPURI)
+		if err != nil {
+			return fmt.Errorf("invalid httpuri: %v", err)
+		}
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg ResolvAdminAPICfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
@@ -3,7 +3,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -14,11 +16,87 @@ import (
 
 // ResolvCacheCfg stores repository settings
 type ResolvCacheCfg struct {
+	Backend    string
+	Disk       DiskStoreCfg
 	ExpireSecs int
 	TraceFile  string
 	DumpFile   string
 	DumpSecs   int
+	DumpFormat string
+	SnapFile   string
+	SnapSecs   int
+	Index      bool
+	Metrics    bool
+	CheckMode  string
+	History    int
+	Failures   int
+	Overflow   string
+	Aggregate  AggregateCfg
+	TTL        TTLCfg
 	Limits     resolvcache.Limits
+	Profiles   []LimitProfileCfg
+}
+
+// DiskStoreCfg stores the settings of the disk backend.
+type DiskStoreCfg struct {
+	Dir         string
+	SegmentSecs int
+}
+
+// Backends of the resolv cache.
+const (
+	MemoryBackend = "memory"
+	DiskBackend   = "disk"
+)
+
+// LimitProfileCfg stores the limits applied to the clients in a network,
+// zero values use the global limits.
+type LimitProfileCfg struct {
+	CIDR            string `mapstructure:"cidr"`
+	MaxBlocksClient int    `mapstructure:"maxblocksclient"`
+	MaxNamesNode    int    `mapstructure:"maxnamesnode"`
+}
+
+// Profile returns the resolvcache limit profile.
+func (cfg LimitProfileCfg) Profile() (resolvcache.LimitProfile, error) {
+	p := resolvcache.LimitProfile{
+		MaxBlocksClient: cfg.MaxBlocksClient,
+		MaxNamesNode:    cfg.MaxNamesNode,
+	}
+	_, network, err := net.ParseCIDR(cfg.CIDR)
+	if err != nil {
+		return p, fmt.Errorf("invalid cidr '%s'", cfg.CIDR)
+	}
+	p.Network = network
+	return p, p.Validate()
+}
+
+// TTLCfg stores the values used for expiration from ttls of the records.
+type TTLCfg struct {
+	Enable    bool
+	GraceSecs int
+	MinSecs   int
+}
+
+// AggregateCfg stores prefixes used for grouping clients. Networks is a
+// list of cidr=prefix values.
+type AggregateCfg struct {
+	IPv4     int
+	IPv6     int
+	Networks []string
+}
+
+// Aggregation returns the resolvcache aggregation.
+func (cfg AggregateCfg) Aggregation() (resolvcache.Aggregation, error) {
+	a := resolvcache.Aggregation{IPv4Prefix: cfg.IPv4, IPv6Prefix: cfg.IPv6}
+	for _, s := range cfg.Networks {
+		np, err := resolvcache.ToNetPrefix(s)
+		if err != nil {
+			return a, err
+		}
+		a.Networks = append(a.Networks, np)
+	}
+	return a, a.Validate()
 }
 
 // SetPFlags setups posix flags for commandline configuration
@@ -27,13 +105,33 @@ func (cfg *ResolvCacheCfg) SetPFlags(short bool, prefix string) {
 	if prefix != "" {
 		aprefix = prefix + "."
 	}
+	pflag.StringVar(&cfg.Backend, aprefix+"backend", cfg.Backend, "Storage backend: memory or disk.")
+	pflag.StringVar(&cfg.Disk.Dir, aprefix+"disk.dir", cfg.Disk.Dir, "Directory of the disk backend.")
+	pflag.IntVar(&cfg.Disk.SegmentSecs, aprefix+"disk.segment", cfg.Disk.SegmentSecs, "Period of time in seconds stored in each file of the disk backend.")
 	pflag.IntVar(&cfg.ExpireSecs, aprefix+"expire", cfg.ExpireSecs, "Expire time in seconds.")
 	pflag.StringVar(&cfg.TraceFile, aprefix+"trace.file", cfg.TraceFile, "Cache operations log file.")
 	pflag.StringVar(&cfg.DumpFile, aprefix+"dump.file", cfg.DumpFile, "Cache dump file for debug.")
 	pflag.IntVar(&cfg.DumpSecs, aprefix+"dump.secs", cfg.DumpSecs, "Dump interval time in seconds.")
+	pflag.StringVar(&cfg.DumpFormat, aprefix+"dump.format", cfg.DumpFormat, "Dump format: text or json.")
+	pflag.StringVar(&cfg.SnapFile, aprefix+"snapshot.file", cfg.SnapFile, "Cache snapshot file for persistence.")
+	pflag.IntVar(&cfg.SnapSecs, aprefix+"snapshot.secs", cfg.SnapSecs, "Snapshot interval time in seconds.")
+	pflag.BoolVar(&cfg.Index, aprefix+"index", cfg.Index, "Enable index of clients by resolved ip and name.")
+	pflag.BoolVar(&cfg.Metrics, aprefix+"metrics", cfg.Metrics, "Expose prometheus metrics of the cache.")
+	pflag.StringVar(&cfg.CheckMode, aprefix+"checkmode", cfg.CheckMode, "Match mode of checks: exact, subdomain or domain.")
+	pflag.IntVar(&cfg.History, aprefix+"history", cfg.History, "Previous periods of resolution stored per name for checks in the past.")
+	pflag.IntVar(&cfg.Failures, aprefix+"failures", cfg.Failures, "Recent names with negative answers stored per client.")
+	pflag.IntVar(&cfg.Aggregate.IPv4, aprefix+"aggregate.ipv4", cfg.Aggregate.IPv4, "Prefix length for grouping ipv4 clients.")
+	pflag.IntVar(&cfg.Aggregate.IPv6, aprefix+"aggregate.ipv6", cfg.Aggregate.IPv6, "Prefix length for grouping ipv6 clients.")
+	pflag.StringSliceVar(&cfg.Aggregate.Networks, aprefix+"aggregate.networks", cfg.Aggregate.Networks, "List of cidr=prefix for grouping clients.")
+	pflag.BoolVar(&cfg.TTL.Enable, aprefix+"ttl.enable", cfg.TTL.Enable, "Enable expiration using ttl of records.")
+	pflag.IntVar(&cfg.TTL.GraceSecs, aprefix+"ttl.grace", cfg.TTL.GraceSecs, "Grace time in seconds added to ttl.")
+	pflag.IntVar(&cfg.TTL.MinSecs, aprefix+"ttl.min", cfg.TTL.MinSecs, "Min expiration time in seconds using ttl.")
 	pflag.IntVar(&cfg.Limits.BlockSize, aprefix+"limit.blocksize", cfg.Limits.BlockSize, "Limit Blocksize.")
 	pflag.IntVar(&cfg.Limits.MaxBlocksClient, aprefix+"limit.maxblocksclient", cfg.Limits.MaxBlocksClient, "Limit max blocks per client.")
 	pflag.IntVar(&cfg.Limits.MaxNamesNode, aprefix+"limit.maxnamesnode", cfg.Limits.MaxNamesNode, "Limit max names per node.")
+	pflag.StringVar(&cfg.Overflow, aprefix+"limit.overflow", cfg.Overflow, "Policy when a client reaches its limits: error or evict.")
+	pflag.IntVar(&cfg.Limits.MaxClients, aprefix+"limit.maxclients", cfg.Limits.MaxClients, "Limit max clients, zero disables.")
+	pflag.IntVar(&cfg.Limits.MaxMemory, aprefix+"limit.maxmemory", cfg.Limits.MaxMemory, "Limit approximate memory in MB, zero disables.")
 }
 
 // BindViper setups posix flags for commandline configuration and bind to viper
@@ -42,13 +140,33 @@ func (cfg *ResolvCacheCfg) BindViper(v *viper.Viper, prefix string) {
 	if prefix != "" {
 		aprefix = prefix + "."
 	}
+	util.BindViper(v, aprefix+"backend")
+	util.BindViper(v, aprefix+"disk.dir")
+	util.BindViper(v, aprefix+"disk.segment")
 	util.BindViper(v, aprefix+"expire")
 	util.BindViper(v, aprefix+"trace.file")
 	util.BindViper(v, aprefix+"dump.file")
 	util.BindViper(v, aprefix+"dump.secs")
+	util.BindViper(v, aprefix+"dump.format")
+	util.BindViper(v, aprefix+"snapshot.file")
+	util.BindViper(v, aprefix+"snapshot.secs")
+	util.BindViper(v, aprefix+"index")
+	util.BindViper(v, aprefix+"metrics")
+	util.BindViper(v, aprefix+"checkmode")
+	util.BindViper(v, aprefix+"history")
+	util.BindViper(v, aprefix+"failures")
+	util.BindViper(v, aprefix+"aggregate.ipv4")
+	util.BindViper(v, aprefix+"aggregate.ipv6")
+	util.BindViper(v, aprefix+"aggregate.networks")
+	util.BindViper(v, aprefix+"ttl.enable")
+	util.BindViper(v, aprefix+"ttl.grace")
+	util.BindViper(v, aprefix+"ttl.min")
 	util.BindViper(v, aprefix+"limit.blocksize")
 	util.BindViper(v, aprefix+"limit.maxblocksclient")
 	util.BindViper(v, aprefix+"limit.maxnamesnode")
+	util.BindViper(v, aprefix+"limit.overflow")
+	util.BindViper(v, aprefix+"limit.maxclients")
+	util.BindViper(v, aprefix+"limit.maxmemory")
 }
 
 // FromViper fill values from viper
@@ -57,13 +175,41 @@ func (cfg *ResolvCacheCfg) FromViper(v *viper.Viper, prefix string) {
 	if prefix != "" {
 		aprefix = prefix + "."
 	}
+	cfg.Backend = v.GetString(aprefix + "backend")
+	cfg.Disk.Dir = v.GetString(aprefix + "disk.dir")
+	cfg.Disk.SegmentSecs = v.GetInt(aprefix + "disk.segment")
 	cfg.ExpireSecs = v.GetInt(aprefix + "expire")
 	cfg.TraceFile = v.GetString(aprefix + "trace.file")
 	cfg.DumpFile = v.GetString(aprefix + "dump.file")
 	cfg.DumpSecs = v.GetInt(aprefix + "dump.secs")
+	cfg.DumpFormat = v.GetString(aprefix + "dump.format")
+	cfg.SnapFile = v.GetString(aprefix + "snapshot.file")
+	cfg.SnapSecs = v.GetInt(aprefix + "snapshot.secs")
+	cfg.Index = v.GetBool(aprefix + "index")
+	cfg.Metrics = v.GetBool(aprefix + "metrics")
+	cfg.CheckMode = v.GetString(aprefix + "checkmode")
+	cfg.History = v.GetInt(aprefix + "history")
+	if cfg.Backend == DiskBackend && !v.IsSet(aprefix+"history") {
+		// the default history only applies to the memory backend
+		cfg.History = 0
+	}
+	cfg.Failures = v.GetInt(aprefix + "failures")
+	cfg.Aggregate.IPv4 = v.GetInt(aprefix + "aggregate.ipv4")
+	cfg.Aggregate.IPv6 = v.GetInt(aprefix + "aggregate.ipv6")
+	cfg.Aggregate.Networks = v.GetStringSlice(aprefix + "aggregate.networks")
+	cfg.TTL.Enable = v.GetBool(aprefix + "ttl.enable")
+	cfg.TTL.GraceSecs = v.GetInt(aprefix + "ttl.grace")
+	cfg.TTL.MinSecs = v.GetInt(aprefix + "ttl.min")
 	cfg.Limits.BlockSize = v.GetInt(aprefix + "limit.blocksize")
 	cfg.Limits.MaxBlocksClient = v.GetInt(aprefix + "limit.maxblocksclient")
 	cfg.Limits.MaxNamesNode = v.GetInt(aprefix + "limit.maxnamesnode")
+	cfg.Overflow = v.GetString(aprefix + "limit.overflow")
+	cfg.Limits.MaxClients = v.GetInt(aprefix + "limit.maxclients")
+	cfg.Limits.MaxMemory = v.GetInt(aprefix + "limit.maxmemory")
+	cfg.Profiles = nil
+	if v.IsSet(aprefix + "profile") {
+		v.UnmarshalKey(aprefix+"profile", &cfg.Profiles)
+	}
 }
 
 // Empty returns true if configuration is empty
@@ -77,11 +223,88 @@ func (cfg ResolvCacheCfg) Empty() bool {
 	if cfg.DumpFile != "" {
 		return false
 	}
+	if cfg.SnapFile != "" {
+		return false
+	}
 	return true
 }
 
 // Validate checks that configuration is ok
 func (cfg ResolvCacheCfg) Validate() error {
+	switch cfg.Backend {
+	case "", MemoryBackend:
+	case DiskBackend:
+		if cfg.Disk.Dir == "" {
+			return errors.New("disk dir is required")
+		}
+		if cfg.Disk.SegmentSecs < 0 {
+			return errors.New("invalid disk segment")
+		}
+		if err := cfg.validateDisk(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid backend '%s'", cfg.Backend)
+	}
+	if _, err := resolvcache.ToDumpFormat(cfg.DumpFormat); err != nil {
+		return err
+	}
+	if _, err := resolvcache.ToMatchMode(cfg.CheckMode); err != nil {
+		return err
+	}
+	if _, err := resolvcache.ToOverflowPolicy(cfg.Overflow); err != nil {
+		return err
+	}
+	if cfg.Limits.MaxClients < 0 || cfg.Limits.MaxMemory < 0 {
+		return errors.New("invalid limits")
+	}
+	if _, err := cfg.Aggregate.Aggregation(); err != nil {
+		return fmt.Errorf("invalid aggregate: %v", err)
+	}
+	for _, p := range cfg.Profiles {
+		if _, err := p.Profile(); err != nil {
+			return fmt.Errorf("invalid profile: %v", err)
+		}
+	}
+	if cfg.History < 0 {
+		return errors.New("invalid history")
+	}
+	if cfg.Failures < 0 {
+		return errors.New("invalid failures")
+	}
+	if cfg.SnapSecs < 0 {
+		return errors.New("invalid snapshot secs")
+	}
+	if cfg.TTL.GraceSecs < 0 || cfg.TTL.MinSecs < 0 {
+		return errors.New("invalid ttl")
+	}
+	return nil
+}
+
+// validateDisk rejects the options of the memory cache not supported by the
+// disk backend.
+func (cfg ResolvCacheCfg) validateDisk() error {
+	unsupported := func(option string) error {
+		return fmt.Errorf("%s is not supported by disk backend", option)
+	}
+	if cfg.SnapFile != "" {
+		return unsupported("snapshot")
+	}
+	if cfg.Index {
+		return unsupported("index")
+	}
+	if len(cfg.Profiles) > 0 {
+		return unsupported("profile")
+	}
+	if cfg.TTL.Enable {
+		return unsupported("ttl")
+	}
+	if cfg.History > 0 {
+		return unsupported("history")
+	}
+	if p, _ := resolvcache.ToOverflowPolicy(cfg.Overflow); p != resolvcache.OverflowError {
+		return unsupported("overflow")
+	}
 	return nil
 }
 
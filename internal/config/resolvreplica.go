@@ -0,0 +1,113 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/core/grpctls"
+)
+
+// ResolvReplicaCfg stores replication preferences. Enable accepts records
+// from peers, Peers are the uris of the daemons that receive the records
+// collected.
+type ResolvReplicaCfg struct {
+	Enable    bool
+	Log       bool
+	Peers     []string
+	BatchSize int
+	WaitSecs  int
+	QueueSize int
+	TLS       grpctls.ClientCfg
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *ResolvReplicaCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.BoolVar(&cfg.Enable, aprefix+"enable", cfg.Enable, "Enable replica api for receiving records from peers in server.replica.")
+	pflag.BoolVar(&cfg.Log, aprefix+"log", cfg.Log, "Enable log in service.")
+	pflag.StringSliceVar(&cfg.Peers, aprefix+"peers", cfg.Peers, "List of uris of peers for replicating records.")
+	pflag.IntVar(&cfg.BatchSize, aprefix+"batch", cfg.BatchSize, "Max records sent to peers in a batch.")
+	pflag.IntVar(&cfg.WaitSecs, aprefix+"wait", cfg.WaitSecs, "Max time in seconds that records wait to be sent.")
+	pflag.IntVar(&cfg.QueueSize, aprefix+"queue", cfg.QueueSize, "Size of the queue of records of each peer.")
+	pflag.StringVar(&cfg.TLS.CertFile, aprefix+"clientcert", cfg.TLS.CertFile, "Path to grpc client cert file.")
+	pflag.StringVar(&cfg.TLS.KeyFile, aprefix+"clientkey", cfg.TLS.KeyFile, "Path to grpc client key file.")
+	pflag.StringVar(&cfg.TLS.ServerCert, aprefix+"servercert", cfg.TLS.ServerCert, "Path to grpc server cert file.")
+	pflag.StringVar(&cfg.TLS.ServerName, aprefix+"servername", cfg.TLS.ServerName, "Server name of grpc service for TLS check.")
+	pflag.StringVar(&cfg.TLS.CACert, aprefix+"cacert", cfg.TLS.CACert, "Path to grpc CA cert file.")
+	pflag.BoolVar(&cfg.TLS.UseSystemCAs, aprefix+"systemca", cfg.TLS.UseSystemCAs, "Use system CA pool for grpc check.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *ResolvReplicaCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"enable")
+	util.BindViper(v, aprefix+"log")
+	util.BindViper(v, aprefix+"peers")
+	util.BindViper(v, aprefix+"batch")
+	util.BindViper(v, aprefix+"wait")
+	util.BindViper(v, aprefix+"queue")
+	util.BindViper(v, aprefix+"clientcert")
+	util.BindViper(v, aprefix+"clientkey")
+	util.BindViper(v, aprefix+"servercert")
+	util.BindViper(v, aprefix+"servername")
+	util.BindViper(v, aprefix+"cacert")
+	util.BindViper(v, aprefix+"systemca")
+}
+
+// FromViper fill values from viper
+func (cfg *ResolvReplicaCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.Enable = v.GetBool(aprefix + "enable")
+	cfg.Log = v.GetBool(aprefix + "log")
+	cfg.Peers = v.GetStringSlice(aprefix + "peers")
+	cfg.BatchSize = v.GetInt(aprefix + "batch")
+	cfg.WaitSecs = v.GetInt(aprefix + "wait")
+	cfg.QueueSize = v.GetInt(aprefix + "queue")
+	cfg.TLS.CertFile = v.GetString(aprefix + "clientcert")
+	cfg.TLS.KeyFile = v.GetString(aprefix + "clientkey")
+	cfg.TLS.ServerCert = v.GetString(aprefix + "servercert")
+	cfg.TLS.ServerName = v.GetString(aprefix + "servername")
+	cfg.TLS.CACert = v.GetString(aprefix + "cacert")
+	cfg.TLS.UseSystemCAs = v.GetBool(aprefix + "systemca")
+}
+
+// Empty returns true if configuration is empty
+func (cfg ResolvReplicaCfg) Empty() bool {
+	return false
+}
+
+// Validate checks that configuration is ok
+func (cfg ResolvReplicaCfg) Validate() error {
+	if cfg.BatchSize < 0 || cfg.WaitSecs < 0 || cfg.QueueSize < 0 {
+		return errors.New("invalid batch values")
+	}
+	for _, peer := range cfg.Peers {
+		if _, _, err := grpctls.ParseURI(peer); err != nil {
+			return fmt.Errorf("invalid peer '%s': %v", peer, err)
+		}
+	}
+	if cfg.TLS.UseTLS() {
+		return cfg.TLS.Validate()
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg ResolvReplicaCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
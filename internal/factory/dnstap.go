@@ -0,0 +1,44 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/internal/config"
+	"github.com/luids-io/dns/pkg/resolvcache/tapcollect"
+)
+
+// Dnstap is a factory for a dnstap listener. Unix sockets are removed
+// before listening.
+func Dnstap(cfg *config.DnstapCfg, c tapcollect.Collector, logger yalogi.Logger) (net.Listener, *tapcollect.Listener, error) {
+	if !cfg.Enable {
+		return nil, nil, errors.New("dnstap listener disabled")
+	}
+	err := cfg.Validate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid dnstap config: %v", err)
+	}
+	proto, addr, _ := util.ParseListenURI(cfg.ListenURI)
+	if proto == "unix" {
+		os.Remove(addr)
+	}
+	tlis, err := util.Listener(cfg.ListenURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening dnstap: %v", err)
+	}
+	if !cfg.Log {
+		logger = yalogi.LogNull
+	}
+	tap := tapcollect.New(c,
+		tapcollect.SetLogger(logger),
+		tapcollect.SetTimeout(time.Duration(cfg.TimeoutSecs)*time.Second),
+		tapcollect.ResolverResponses(cfg.Resolver))
+	return tlis, tap, nil
+}
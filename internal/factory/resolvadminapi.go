@@ -0,0 +1,24 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"errors"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/internal/config"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	adminapi "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvadmin"
+)
+
+// ResolvAdminAPI creates grpc service
+func ResolvAdminAPI(cfg *config.ResolvAdminAPICfg, csvc *resolvcache.Service, logger yalogi.Logger) (*adminapi.Service, error) {
+	if !cfg.Enable {
+		return nil, errors.New("dnsutil resolvadmin service disabled")
+	}
+	if !cfg.Log {
+		logger = yalogi.LogNull
+	}
+	gsvc := adminapi.NewService(csvc, adminapi.SetServiceLogger(logger))
+	return gsvc, nil
+}
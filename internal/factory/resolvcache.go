@@ -10,6 +10,7 @@ import (
 	"github.com/luids-io/core/yalogi"
 	"github.com/luids-io/dns/internal/config"
 	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/diskstore"
 	"github.com/luids-io/dns/pkg/resolvcache/tracelog"
 )
 
@@ -21,17 +22,67 @@ func TraceLogFile(cfg *config.ResolvCacheCfg, logger yalogi.Logger) (*tracelog.F
 	return tracelog.NewFile(cfg.TraceFile)
 }
 
-// ResolvCache is a factory for a resolv cache service
-func ResolvCache(cfg *config.ResolvCacheCfg, clog resolvcache.TraceLogger, logger yalogi.Logger) (*resolvcache.Service, error) {
+// Cache is a factory for a resolv cache without service.
+func Cache(cfg *config.ResolvCacheCfg) (*resolvcache.Cache, error) {
 	err := cfg.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("invalid resolv cache config: %v", err)
 	}
-	svc := resolvcache.NewService(
-		resolvcache.NewCache(time.Duration(cfg.ExpireSecs)*time.Second, cfg.Limits),
+	aggregate, _ := cfg.Aggregate.Aggregation()
+	overflow, _ := resolvcache.ToOverflowPolicy(cfg.Overflow)
+	copts := []resolvcache.CacheOption{
+		resolvcache.ClientIndex(cfg.Index),
+		resolvcache.AggregateClients(aggregate),
+		resolvcache.KeepHistory(cfg.History),
+		resolvcache.KeepFailures(cfg.Failures),
+		resolvcache.SetOverflow(overflow),
+	}
+	for _, p := range cfg.Profiles {
+		profile, _ := p.Profile()
+		copts = append(copts, resolvcache.LimitProfiles(profile))
+	}
+	if cfg.TTL.Enable {
+		copts = append(copts, resolvcache.HonourTTL(
+			time.Duration(cfg.TTL.GraceSecs)*time.Second,
+			time.Duration(cfg.TTL.MinSecs)*time.Second))
+	}
+	return resolvcache.NewCache(time.Duration(cfg.ExpireSecs)*time.Second, cfg.Limits, copts...), nil
+}
+
+// Store is a factory for the storage backend of a resolv cache.
+func Store(cfg *config.ResolvCacheCfg, logger yalogi.Logger) (resolvcache.Store, error) {
+	if cfg.Backend != config.DiskBackend {
+		return Cache(cfg)
+	}
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid resolv cache config: %v", err)
+	}
+	aggregate, _ := cfg.Aggregate.Aggregation()
+	return diskstore.New(cfg.Disk.Dir, time.Duration(cfg.ExpireSecs)*time.Second,
+		diskstore.SegmentDuration(time.Duration(cfg.Disk.SegmentSecs)*time.Second),
+		diskstore.AggregateClients(aggregate),
+		diskstore.SetLogger(logger))
+}
+
+// ResolvCache is a factory for a resolv cache service, opt are appended to
+// the options created from cfg.
+func ResolvCache(cfg *config.ResolvCacheCfg, clog resolvcache.TraceLogger, logger yalogi.Logger, opt ...resolvcache.Option) (*resolvcache.Service, error) {
+	store, err := Store(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	dumpFormat, _ := resolvcache.ToDumpFormat(cfg.DumpFormat)
+	checkMode, _ := resolvcache.ToMatchMode(cfg.CheckMode)
+	sopts := []resolvcache.Option{
 		resolvcache.DumpCache(time.Duration(cfg.DumpSecs)*time.Second, cfg.DumpFile),
+		resolvcache.SetDumpFormat(dumpFormat),
+		resolvcache.SnapshotCache(time.Duration(cfg.SnapSecs)*time.Second, cfg.SnapFile),
+		resolvcache.EnableMetrics(cfg.Metrics),
+		resolvcache.SetCheckMode(checkMode),
 		resolvcache.SetTraceLogger(clog),
 		resolvcache.SetLogger(logger),
-	)
-	return svc, nil
+	}
+	sopts = append(sopts, opt...)
+	return resolvcache.NewService(store, sopts...), nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/luids-io/core/yalogi"
 	"github.com/luids-io/dns/internal/config"
 	"github.com/luids-io/dns/pkg/resolvcache"
+	recordapi "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 // ResolvCollectAPI creates grpc service
@@ -22,3 +23,16 @@ func ResolvCollectAPI(cfg *config.ResolvCollectAPICfg, csvc *resolvcache.Service
 	gsvc := collectapi.NewService(csvc, collectapi.SetServiceLogger(logger))
 	return gsvc, nil
 }
+
+// ResolvRecordAPI creates grpc service for collecting with ttls, it's
+// enabled with the collect service
+func ResolvRecordAPI(cfg *config.ResolvCollectAPICfg, csvc *resolvcache.Service, logger yalogi.Logger) (*recordapi.Service, error) {
+	if !cfg.Enable {
+		return nil, errors.New("dnsutil resolvcollect service disabled")
+	}
+	if !cfg.Log {
+		logger = yalogi.LogNull
+	}
+	gsvc := recordapi.NewService(csvc, recordapi.SetServiceLogger(logger))
+	return gsvc, nil
+}
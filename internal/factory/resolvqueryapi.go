@@ -0,0 +1,24 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"errors"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/internal/config"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	queryapi "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvquery"
+)
+
+// ResolvQueryAPI creates grpc service
+func ResolvQueryAPI(cfg *config.ResolvQueryAPICfg, csvc *resolvcache.Service, logger yalogi.Logger) (*queryapi.Service, error) {
+	if !cfg.Enable {
+		return nil, errors.New("dnsutil resolvquery service disabled")
+	}
+	if !cfg.Log {
+		logger = yalogi.LogNull
+	}
+	gsvc := queryapi.NewService(csvc, queryapi.SetServiceLogger(logger))
+	return gsvc, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luids-io/core/grpctls"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/internal/config"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	replicaapi "github.com/luids-io/dns/pkg/resolvcache/grpc/resolvreplica"
+)
+
+// ResolvReplicaPeers creates grpc clients for the peers and returns the
+// options for the resolv cache service.
+func ResolvReplicaPeers(cfg *config.ResolvReplicaCfg, logger yalogi.Logger) ([]*replicaapi.Client, []resolvcache.Option, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid replica config: %v", err)
+	}
+	if len(cfg.Peers) == 0 {
+		return nil, nil, nil
+	}
+	clients := make([]*replicaapi.Client, 0, len(cfg.Peers))
+	opts := make([]resolvcache.Option, 0, len(cfg.Peers)+1)
+	for _, uri := range cfg.Peers {
+		dial, err := grpctls.Dial(uri, cfg.TLS)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, nil, fmt.Errorf("dialing peer '%s': %v", uri, err)
+		}
+		client := replicaapi.NewClient(dial)
+		clients = append(clients, client)
+		opts = append(opts, resolvcache.ReplicateTo(uri, client))
+	}
+	opts = append(opts, resolvcache.SetReplicaBatch(cfg.BatchSize, time.Duration(cfg.WaitSecs)*time.Second, cfg.QueueSize))
+	return clients, opts, nil
+}
+
+// ResolvReplicaAPI creates grpc service
+func ResolvReplicaAPI(cfg *config.ResolvReplicaCfg, csvc *resolvcache.Service, logger yalogi.Logger) (*replicaapi.Service, error) {
+	if !cfg.Enable {
+		return nil, errors.New("dnsutil resolvreplica service disabled")
+	}
+	if !cfg.Log {
+		logger = yalogi.LogNull
+	}
+	gsvc := replicaapi.NewService(csvc, replicaapi.SetServiceLogger(logger))
+	return gsvc, nil
+}
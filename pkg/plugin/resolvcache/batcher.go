@@ -0,0 +1,136 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
+)
+
+// batchItem stores a resolution and the request id used in events.
+type batchItem struct {
+	rid uuid.UUID
+	r   resolvcache.Resolution
+}
+
+// batchTimeout is the max time used for collecting a batch.
+const batchTimeout = 5 * time.Second
+
+// batcher collects resolutions in batches in an asyncronous mode.
+type batcher struct {
+	// resolutions dropped because the buffer was full, atomic value
+	dropped uint64
+	logger  yalogi.Logger
+	//internal buffered data channel
+	dataCh chan batchItem
+	//client used for collect
+	client resolvrecord.BatchCollector
+	//onError is called for each resolution not collected
+	onError func(rid uuid.UUID, r resolvcache.Resolution, err error)
+	size    int
+	wait    time.Duration
+	//control state, senders hold the read lock so the data channel is
+	//never closed while sending
+	mu       sync.RWMutex
+	closed   bool
+	sigclose chan struct{}
+}
+
+func newBatcher(client resolvrecord.BatchCollector, size int, wait time.Duration,
+	onError func(uuid.UUID, resolvcache.Resolution, error), logger yalogi.Logger) *batcher {
+	b := &batcher{
+		logger:   logger,
+		client:   client,
+		onError:  onError,
+		size:     size,
+		wait:     wait,
+		dataCh:   make(chan batchItem, 4*size),
+		sigclose: make(chan struct{}),
+	}
+	go b.doProcess()
+	return b
+}
+
+// collect resolution in an asyncronous mode. It never blocks, the
+// resolution is dropped if the buffer is full.
+func (b *batcher) collect(rid uuid.UUID, r resolvcache.Resolution) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	select {
+	case b.dataCh <- batchItem{rid: rid, r: r}:
+	default:
+		atomic.AddUint64(&b.dropped, 1)
+	}
+}
+
+// close batcher, pending resolutions are collected.
+func (b *batcher) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.dataCh)
+	b.mu.Unlock()
+	<-b.sigclose
+}
+
+func (b *batcher) doProcess() {
+	ticker := time.NewTicker(b.wait)
+	defer ticker.Stop()
+	items := make([]batchItem, 0, b.size)
+	for {
+		select {
+		case item, ok := <-b.dataCh:
+			if !ok {
+				b.flush(items)
+				close(b.sigclose)
+				return
+			}
+			items = append(items, item)
+			if len(items) < b.size {
+				continue
+			}
+		case <-ticker.C:
+			if dropped := atomic.SwapUint64(&b.dropped, 0); dropped > 0 {
+				b.logger.Warnf("dropped %v resolutions: buffer is full", dropped)
+			}
+		}
+		b.flush(items)
+		items = items[:0]
+	}
+}
+
+func (b *batcher) flush(items []batchItem) {
+	if len(items) == 0 {
+		return
+	}
+	rs := make([]resolvcache.Resolution, 0, len(items))
+	for _, item := range items {
+		rs = append(rs, item.r)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+	errs, err := b.client.CollectMany(ctx, rs)
+	if err != nil {
+		b.logger.Warnf("collecting batch of %v resolutions: %v", len(rs), err)
+		return
+	}
+	for i, err := range errs {
+		if err != nil {
+			b.onError(items[i].rid, items[i].r, err)
+		}
+	}
+}
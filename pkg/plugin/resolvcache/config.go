@@ -4,16 +4,28 @@ package resolvcache
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/caddyserver/caddy"
 	"github.com/coredns/coredns/plugin"
+
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 // Config stores configuration for the plugin.
 type Config struct {
 	Service string
 	Policy  RuleSet
+	// Batch is the max number of resolutions collected in a batch and
+	// BatchWait the max time in milliseconds that they wait, batches are
+	// disabled if zero
+	Batch     int
+	BatchWait int
+	// Negative enables the collection of negative answers (NXDOMAIN and
+	// NODATA)
+	Negative bool
 }
 
 // DefaultConfig returns a Config with default values.
@@ -24,6 +36,7 @@ func DefaultConfig() Config {
 			MaxClientRequests: Rule{Log: true},
 			MaxNamesResolved:  Rule{Log: true},
 		},
+		BatchWait: 100,
 	}
 }
 
@@ -32,6 +45,12 @@ func (cfg Config) Validate() error {
 	if cfg.Service == "" {
 		return errors.New("service empty")
 	}
+	if cfg.Batch < 0 || cfg.Batch > resolvrecord.MaxBatch {
+		return fmt.Errorf("invalid batch value: %v", cfg.Batch)
+	}
+	if cfg.Batch > 0 && cfg.BatchWait <= 0 {
+		return fmt.Errorf("invalid batch wait value: %v", cfg.BatchWait)
+	}
 	return nil
 }
 
@@ -77,6 +96,31 @@ var mapConfig = map[string]loadCfgFn{
 		cfg.Service = c.Val()
 		return nil
 	},
+	"batch": func(c *caddy.Controller, cfg *Config) error {
+		args := c.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return c.ArgErr()
+		}
+		var err error
+		cfg.Batch, err = strconv.Atoi(args[0])
+		if err != nil {
+			return c.SyntaxErr("batch must be an integer")
+		}
+		if len(args) == 2 {
+			cfg.BatchWait, err = strconv.Atoi(args[1])
+			if err != nil {
+				return c.SyntaxErr("batch wait must be an integer")
+			}
+		}
+		return nil
+	},
+	"negative": func(c *caddy.Controller, cfg *Config) error {
+		if c.NextArg() {
+			return c.ArgErr()
+		}
+		cfg.Negative = true
+		return nil
+	},
 	"on-maxclient": func(c *caddy.Controller, cfg *Config) error {
 		args := c.RemainingArgs()
 		if len(args) == 0 {
@@ -10,12 +10,14 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/plugin/pkg/dnstest"
 	"github.com/coredns/coredns/plugin/pkg/fall"
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 	"github.com/coredns/coredns/request"
+	"github.com/google/uuid"
 	"github.com/miekg/dns"
 
 	"github.com/luids-io/api/dnsutil"
@@ -24,6 +26,8 @@ import (
 	"github.com/luids-io/core/yalogi"
 	"github.com/luids-io/dns/pkg/plugin/idsapi"
 	"github.com/luids-io/dns/pkg/plugin/idsevent"
+	"github.com/luids-io/dns/pkg/resolvcache"
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/resolvrecord"
 )
 
 // Plugin is the main struct of the plugin.
@@ -36,7 +40,13 @@ type Plugin struct {
 	policy    RuleSet
 	svc       apiservice.Service
 	collector dnsutil.ResolvCollector
-	started   bool
+	// recorder is nil if service doesn't support ttls
+	recorder resolvrecord.Collector
+	// negative is nil if negative answers are not collected
+	negative resolvrecord.NegativeCollector
+	// batcher is nil if batches are disabled
+	batcher *batcher
+	started bool
 }
 
 // New returns a new Plugin.
@@ -64,6 +74,21 @@ func (p *Plugin) Start() error {
 	if !ok {
 		return fmt.Errorf("service '%s' is not an dnsutil resolvcollect api", p.cfg.Service)
 	}
+	p.recorder, _ = p.svc.(resolvrecord.Collector)
+	if p.cfg.Negative {
+		p.negative, ok = p.svc.(resolvrecord.NegativeCollector)
+		if !ok {
+			return fmt.Errorf("service '%s' doesn't support negative answers", p.cfg.Service)
+		}
+	}
+	if p.cfg.Batch > 0 {
+		bcollector, ok := p.svc.(resolvrecord.BatchCollector)
+		if !ok {
+			return fmt.Errorf("service '%s' doesn't support batches", p.cfg.Service)
+		}
+		p.batcher = newBatcher(bcollector, p.cfg.Batch,
+			time.Duration(p.cfg.BatchWait)*time.Millisecond, p.onError, p.logger)
+	}
 	p.started = true
 	return nil
 }
@@ -85,6 +110,9 @@ func (p *Plugin) Shutdown() error {
 		return nil
 	}
 	p.started = false
+	if p.batcher != nil {
+		p.batcher.close()
+	}
 	return nil
 }
 
@@ -100,20 +128,33 @@ func (p Plugin) ServeDNS(ctx context.Context, writer dns.ResponseWriter, query *
 	// if A or AAAA gets response
 	rrw := dnstest.NewRecorder(writer)
 	rc, err := plugin.NextOrFailure(p.Name(), p.Next, ctx, rrw, query)
-	if rc != dns.RcodeSuccess || err != nil {
+	if err != nil {
+		return rc, err
+	}
+	if rc == dns.RcodeNameError || (rrw.Msg != nil && rrw.Msg.Rcode == dns.RcodeNameError) {
+		if p.negative != nil {
+			p.collectNegative(ctx, req, resolvcache.NXDomain)
+		}
+		return rc, err
+	}
+	if rc != dns.RcodeSuccess {
 		return rc, err
 	}
 	// gets IPs and CNAMEs from answer
 	var resolved []net.IP
+	var ttls []time.Duration
 	var cnames []string
 	if rrw.Msg != nil && len(rrw.Msg.Answer) > 0 {
 		resolved = make([]net.IP, 0, len(rrw.Msg.Answer))
+		ttls = make([]time.Duration, 0, len(rrw.Msg.Answer))
 		cnames = make([]string, 0, len(rrw.Msg.Answer))
 		for _, a := range rrw.Msg.Answer {
 			if rsp, ok := a.(*dns.A); ok {
 				resolved = append(resolved, rsp.A)
+				ttls = append(ttls, time.Duration(rsp.Hdr.Ttl)*time.Second)
 			} else if rsp, ok := a.(*dns.AAAA); ok {
 				resolved = append(resolved, rsp.AAAA)
+				ttls = append(ttls, time.Duration(rsp.Hdr.Ttl)*time.Second)
 			} else if rsp, ok := a.(*dns.CNAME); ok {
 				target := rsp.Target
 				if dns.IsFqdn(target) {
@@ -125,53 +166,101 @@ func (p Plugin) ServeDNS(ctx context.Context, writer dns.ResponseWriter, query *
 	}
 	if len(resolved) > 0 {
 		// prepare data
-		name := req.Name()
-		if dns.IsFqdn(name) {
-			name = strings.TrimSuffix(name, ".")
-		}
-		remote, _, _ := net.SplitHostPort(req.RemoteAddr())
-		client := net.ParseIP(remote)
-		if client == nil {
-			p.logger.Warnf("parsing remote '%s'", req.RemoteAddr())
+		client, name, ok := p.getQuery(req)
+		if !ok {
 			return rc, err
 		}
 		// collect data
-		p.doCollect(ctx, client, name, resolved, cnames)
+		p.doCollect(ctx, client, name, resolved, cnames, ttls)
+	} else if p.negative != nil && rrw.Msg != nil && rrw.Msg.Rcode == dns.RcodeSuccess {
+		p.collectNegative(ctx, req, resolvcache.NoData)
 	}
 	return rc, err
 }
 
-func (p *Plugin) doCollect(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string) {
-	err := p.collector.Collect(ctx, client, name, resolved, cnames)
+// getQuery returns the client and the name queried.
+func (p *Plugin) getQuery(req request.Request) (net.IP, string, bool) {
+	name := req.Name()
+	if dns.IsFqdn(name) {
+		name = strings.TrimSuffix(name, ".")
+	}
+	remote, _, _ := net.SplitHostPort(req.RemoteAddr())
+	client := net.ParseIP(remote)
+	if client == nil {
+		p.logger.Warnf("parsing remote '%s'", req.RemoteAddr())
+		return nil, "", false
+	}
+	return client, name, true
+}
+
+func (p *Plugin) collectNegative(ctx context.Context, req request.Request, n resolvcache.Negative) {
+	client, name, ok := p.getQuery(req)
+	if !ok {
+		return
+	}
+	if p.batcher != nil {
+		p.batcher.collect(idsapi.GetRequestID(ctx), resolvcache.Resolution{
+			Client:   client,
+			Name:     name,
+			Negative: n,
+		})
+		return
+	}
+	err := p.negative.CollectNegative(ctx, client, name, n)
 	if err != nil {
-		rid := idsapi.GetRequestID(ctx)
-		//apply policy management error
-		switch err {
-		case dnsutil.ErrLimitDNSClientQueries:
-			if p.policy.MaxClientRequests.Log {
-				p.logger.Infof("%v", err)
-			}
-			if p.policy.MaxClientRequests.Event.Raise {
-				level := p.policy.MaxClientRequests.Event.Level
-				e := event.New(idsevent.DNSMaxClientRequests, level)
-				e.Set("rid", rid.String())
-				e.Set("remote", client)
-				event.Notify(e)
-			}
-		case dnsutil.ErrLimitResolvedNamesIP:
-			if p.policy.MaxNamesResolved.Log {
-				p.logger.Infof("%v", err)
-			}
-			if p.policy.MaxNamesResolved.Event.Raise {
-				level := p.policy.MaxNamesResolved.Event.Level
-				e := event.New(idsevent.DNSMaxNamesResolvedIP, level)
-				e.Set("rid", rid.String())
-				e.Set("remote", client)
-				e.Set("resolved", resolved)
-				event.Notify(e)
-			}
-		default:
-			p.logger.Warnf("%v", err)
+		p.onError(idsapi.GetRequestID(ctx), resolvcache.Resolution{Client: client, Name: name, Negative: n}, err)
+	}
+}
+
+func (p *Plugin) doCollect(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string, ttls []time.Duration) {
+	if p.batcher != nil {
+		p.batcher.collect(idsapi.GetRequestID(ctx), resolvcache.Resolution{
+			Client:   client,
+			Name:     name,
+			CNAMEs:   cnames,
+			Resolved: resolved,
+			TTLs:     ttls,
+		})
+		return
+	}
+	var err error
+	if p.recorder != nil {
+		err = p.recorder.CollectTTL(ctx, client, name, resolved, cnames, ttls)
+	} else {
+		err = p.collector.Collect(ctx, client, name, resolved, cnames)
+	}
+	if err != nil {
+		p.onError(idsapi.GetRequestID(ctx), resolvcache.Resolution{Client: client, Name: name, Resolved: resolved}, err)
+	}
+}
+
+// onError applies policy management error
+func (p *Plugin) onError(rid uuid.UUID, r resolvcache.Resolution, err error) {
+	switch err {
+	case dnsutil.ErrLimitDNSClientQueries:
+		if p.policy.MaxClientRequests.Log {
+			p.logger.Infof("%v", err)
+		}
+		if p.policy.MaxClientRequests.Event.Raise {
+			level := p.policy.MaxClientRequests.Event.Level
+			e := event.New(idsevent.DNSMaxClientRequests, level)
+			e.Set("rid", rid.String())
+			e.Set("remote", r.Client)
+			event.Notify(e)
+		}
+	case dnsutil.ErrLimitResolvedNamesIP:
+		if p.policy.MaxNamesResolved.Log {
+			p.logger.Infof("%v", err)
+		}
+		if p.policy.MaxNamesResolved.Event.Raise {
+			level := p.policy.MaxNamesResolved.Event.Level
+			e := event.New(idsevent.DNSMaxNamesResolvedIP, level)
+			e.Set("rid", rid.String())
+			e.Set("remote", r.Client)
+			e.Set("resolved", r.Resolved)
+			event.Notify(e)
 		}
+	default:
+		p.logger.Warnf("%v", err)
 	}
 }
@@ -0,0 +1,132 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Aggregation defines the network prefixes used to group client addresses
+// in the cache. Zero values disable aggregation for the address family.
+type Aggregation struct {
+	IPv4Prefix int
+	IPv6Prefix int
+	// Networks overrides prefixes for the clients in the networks
+	Networks []NetPrefix
+}
+
+// NetPrefix stores a prefix length for the clients in a network.
+type NetPrefix struct {
+	Network *net.IPNet
+	Prefix  int
+}
+
+// ToNetPrefix returns a NetPrefix from a string with format cidr=prefix.
+func ToNetPrefix(s string) (NetPrefix, error) {
+	var np NetPrefix
+	args := strings.SplitN(s, "=", 2)
+	if len(args) != 2 {
+		return np, fmt.Errorf("invalid network prefix '%s'", s)
+	}
+	_, network, err := net.ParseCIDR(strings.TrimSpace(args[0]))
+	if err != nil {
+		return np, fmt.Errorf("invalid network prefix '%s': %v", s, err)
+	}
+	prefix, err := strconv.Atoi(strings.TrimSpace(args[1]))
+	if err != nil {
+		return np, fmt.Errorf("invalid network prefix '%s': %v", s, err)
+	}
+	_, bits := network.Mask.Size()
+	if prefix < 0 || prefix > bits {
+		return np, fmt.Errorf("invalid network prefix '%s': prefix out of range", s)
+	}
+	np.Network, np.Prefix = network, prefix
+	return np, nil
+}
+
+// Validate aggregation values.
+func (a Aggregation) Validate() error {
+	if a.IPv4Prefix < 0 || a.IPv4Prefix > 32 {
+		return fmt.Errorf("invalid ipv4 prefix %v", a.IPv4Prefix)
+	}
+	if a.IPv6Prefix < 0 || a.IPv6Prefix > 128 {
+		return fmt.Errorf("invalid ipv6 prefix %v", a.IPv6Prefix)
+	}
+	for _, n := range a.Networks {
+		if n.Network == nil {
+			return fmt.Errorf("network is required")
+		}
+	}
+	return nil
+}
+
+// sorted returns a copy with the most specific networks first.
+func (a Aggregation) sorted() Aggregation {
+	networks := make([]NetPrefix, len(a.Networks))
+	copy(networks, a.Networks)
+	sort.SliceStable(networks, func(i, j int) bool {
+		ones1, _ := networks[i].Network.Mask.Size()
+		ones2, _ := networks[j].Network.Mask.Size()
+		return ones1 > ones2
+	})
+	a.Networks = networks
+	return a
+}
+
+// ClientNet returns the network that groups the client ip.
+func (a Aggregation) ClientNet(ip net.IP) *net.IPNet {
+	bits, prefix := 128, a.IPv6Prefix
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits, prefix = 32, a.IPv4Prefix
+	}
+	for _, n := range a.Networks {
+		if n.Network.Contains(ip) {
+			prefix = n.Prefix
+			break
+		}
+	}
+	if prefix <= 0 || prefix > bits {
+		prefix = bits
+	}
+	mask := net.CIDRMask(prefix, bits)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// clientKey returns the key of the network that groups the client ip
+// without allocations.
+func (a Aggregation) clientKey(ip net.IP) ipKey {
+	k := getIPKey(ip)
+	bits, offset, prefix := 128, 0, a.IPv6Prefix
+	if ip.To4() != nil {
+		bits, offset, prefix = 32, 96, a.IPv4Prefix
+	}
+	for _, n := range a.Networks {
+		if n.Network.Contains(ip) {
+			prefix = n.Prefix
+			break
+		}
+	}
+	if prefix <= 0 || prefix >= bits {
+		return k
+	}
+	return k.mask(offset + prefix)
+}
+
+// aggregated returns true if network groups more than one address
+func aggregated(n *net.IPNet) bool {
+	ones, bits := n.Mask.Size()
+	return ones < bits
+}
+
+// netString returns the ip if not aggregated, cidr in other case
+func netString(n *net.IPNet) string {
+	if aggregated(n) {
+		return n.String()
+	}
+	return n.IP.String()
+}
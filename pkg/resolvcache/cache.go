@@ -6,26 +6,112 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/luids-io/api/dnsutil"
 )
 
 // Cache implements a resolv cache in memory.
 type Cache struct {
-	expires time.Duration
+	// atomic counters, must be 64-bit aligned
+	nblocks  int64
+	nclients int64
+	evicted  uint64
+	// evictions by the overflow policy
+	evictedBlocks uint64
+	evictedNames  uint64
+	// negative answers
+	nxdomain uint64
+	nodata   uint64
+	// expires and time stamps (unix nanoseconds) can change on the fly
+	expires int64
+	cleaned int64
+	flushed int64
 	limits  Limits
-	mu      sync.RWMutex
-	clients map[string]*clientBlock
-	//time stamps
-	cleaned time.Time
-	flushed time.Time
+	// clients are partitioned in shards
+	shards  [cacheShards]cacheShard
+	evictMu sync.Mutex
+	// index is nil if disabled
+	index *clientIndex
+	// client aggregation
+	aggregate  Aggregation
+	aggregated bool
+	// expiration using ttls
+	ttl ttlPolicy
+	// previous periods stored by name
+	history int
+	// policy when clients reach their limits
+	overflow OverflowPolicy
+	// limit profiles, most specific first
+	profiles []LimitProfile
+	// failed names stored by client
+	failures int
+}
+
+// NameInfo stores a name resolved and its last resolution time. Chain
+// stores the names from the name queried to the last alias if the name
+// was resolved through cnames.
+type NameInfo struct {
+	Name  string    `json:"name"`
+	Last  time.Time `json:"last"`
+	Chain []string  `json:"chain,omitempty"`
+}
+
+// Match stores the result of a check in the cache.
+type Match struct {
+	// Result is true if was resolved
+	Result bool
+	// Since is the first resolution of the period of continuous
+	// resolutions that matched
+	Since time.Time
+	// Last time resolved in the period
+	Last time.Time
+	// Store time of cache
+	Store time.Time
+	// TTL of the dns record matched, zero if unknown
+	TTL time.Duration
+	// InTTL is true if the record matched was still within its ttl
+	InTTL bool
+	// Name matched
+	Name string
+	// Chain from the name queried to the last alias, empty if the name
+	// was resolved without cnames
+	Chain []string
+}
+
+// Resolution stores the data of a dns resolution. CNAMEs is the chain of
+// aliases in order, TTLs are related by position to Resolved ips. Negative
+// answers only store the name queried.
+type Resolution struct {
+	Client   net.IP
+	Name     string
+	CNAMEs   []string
+	Resolved []net.IP
+	TTLs     []time.Duration
+	Negative Negative
 }
 
-// Limits stores max values for cache.
+// Check stores the values of a check in a batch, name can be empty. A zero
+// time is now.
+type Check struct {
+	Client   net.IP
+	Resolved net.IP
+	Name     string
+	At       time.Time
+}
+
+// Limits stores max values for cache. MaxClients and MaxMemory (in MB)
+// are disabled if zero, when reached the least recently updated clients
+// are evicted. Memory is an estimation from the number of blocks in use.
 type Limits struct {
 	BlockSize       int
 	MaxBlocksClient int
 	MaxNamesNode    int
+	MaxClients      int
+	MaxMemory       int
 }
 
 // DefaultLimits returns limits.
@@ -37,106 +123,380 @@ func DefaultLimits() Limits {
 	}
 }
 
+// CacheOption is used for cache configuration.
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	index     bool
+	aggregate Aggregation
+	ttl       ttlPolicy
+	history   int
+	overflow  OverflowPolicy
+	profiles  []LimitProfile
+	failures  int
+}
+
+// ClientIndex option enables a secondary index from resolved ips and names
+// to clients.
+func ClientIndex(b bool) CacheOption {
+	return func(o *cacheOptions) {
+		o.index = b
+	}
+}
+
+// AggregateClients option groups clients by network prefixes.
+func AggregateClients(a Aggregation) CacheOption {
+	return func(o *cacheOptions) {
+		o.aggregate = a
+	}
+}
+
 // NewCache creates a new Cache.
-func NewCache(expires time.Duration, limits Limits) *Cache {
-	now := time.Now()
+func NewCache(expires time.Duration, limits Limits, opt ...CacheOption) *Cache {
+	opts := cacheOptions{failures: defaultFailures}
+	for _, f := range opt {
+		f(&opts)
+	}
+	now := time.Now().UnixNano()
 	o := &Cache{
-		expires: expires,
-		limits:  limits,
-		clients: make(map[string]*clientBlock),
-		flushed: now,
-		cleaned: now,
+		expires:  int64(expires),
+		limits:   limits,
+		ttl:      opts.ttl,
+		history:  opts.history,
+		overflow: opts.overflow,
+		profiles: sortProfiles(opts.profiles),
+		failures: opts.failures,
+		flushed:  now,
+		cleaned:  now,
+	}
+	for i := range o.shards {
+		o.shards[i].clients = make(map[ipKey]*clientBlock)
+	}
+	if opts.index {
+		o.index = newClientIndex()
+	}
+	a := opts.aggregate
+	if a.IPv4Prefix > 0 || a.IPv6Prefix > 0 || len(a.Networks) > 0 {
+		o.aggregate = a.sorted()
+		o.aggregated = true
 	}
 	return o
 }
 
 // Set data.
 func (o *Cache) Set(ts time.Time, client net.IP, name string, resolved []net.IP) error {
-	// gets client data
-	c := o.getClientBlock(client)
-	// insert data into client information
-	for _, rip := range resolved {
-		err := c.insert(rip, name, ts)
+	return o.SetTTL(ts, client, name, resolved, nil)
+}
+
+// SetTTL sets data with the ttls of the resolved ips, ttls are ignored if
+// the cache doesn't honour them. Missing or zero ttls are unknown.
+func (o *Cache) SetTTL(ts time.Time, client net.IP, name string, resolved []net.IP, ttls []time.Duration) error {
+	return o.Insert(ts, Resolution{Client: client, Name: name, Resolved: resolved, TTLs: ttls})
+}
+
+// Insert stores the resolution. The name queried and each alias of the
+// chain are stored with the resolved ips, sharing the chain. It returns the
+// first error but tries to store all names. Negative answers are stored in
+// the failures of the client.
+func (o *Cache) Insert(ts time.Time, r Resolution) error {
+	key := o.clientKey(r.Client)
+	err := o.insert(o.getClientBlock(key, r.Client), key, ts, r)
+	// check memory limits
+	if o.overMemory() {
+		o.evictMemory()
+	}
+	return err
+}
+
+// InsertMany stores the resolutions with the same timestamp. Clients are
+// searched once per batch and memory limits are checked at the end. It
+// returns the errors related by position to the resolutions, nil if all
+// resolutions were stored.
+func (o *Cache) InsertMany(ts time.Time, rs []Resolution) []error {
+	var errs []error
+	clients := make(map[ipKey]*clientBlock)
+	for idx, r := range rs {
+		key := o.clientKey(r.Client)
+		c, ok := clients[key]
+		if !ok {
+			c = o.getClientBlock(key, r.Client)
+			clients[key] = c
+		}
+		err := o.insert(c, key, ts, r)
 		if err != nil {
-			return err
+			if errs == nil {
+				errs = make([]error, len(rs))
+			}
+			errs[idx] = err
+		}
+	}
+	// check memory limits
+	if o.overMemory() {
+		o.evictMemory()
+	}
+	return errs
+}
+
+func (o *Cache) insert(c *clientBlock, key ipKey, ts time.Time, r Resolution) error {
+	return o.insertPeriods(c, key, ts, r, ts, nil)
+}
+
+// insertPeriods inserts the resolution with the start of the current period
+// and the previous periods.
+func (o *Cache) insertPeriods(c *clientBlock, key ipKey, ts time.Time, r Resolution, since time.Time, past []period) error {
+	c.activity(ts)
+	// names are stored in lower case
+	r.Name = strings.ToLower(r.Name)
+	r.CNAMEs = lowerNames(r.CNAMEs)
+	if r.Negative != Positive {
+		return o.insertNegative(c, ts, r)
+	}
+	var chain []string
+	if len(r.CNAMEs) > 0 {
+		chain = make([]string, 0, len(r.CNAMEs)+1)
+		chain = append(chain, r.Name)
+		chain = append(chain, r.CNAMEs...)
+	}
+	// insert data into client information
+	var err error
+	insert := func(name string) {
+		ierr := o.insertItem(c, key, r.Resolved, r.TTLs, item{name: name, ts: ts, since: since, chain: chain, past: past})
+		if ierr != nil && err == nil {
+			err = ierr
 		}
 	}
-	return nil
+	insert(r.Name)
+	for _, cname := range r.CNAMEs {
+		insert(cname)
+	}
+	return err
+}
+
+// insertItem inserts the item for the resolved ips, ttls are related by
+// position. It stops at the first error, only the ips inserted are stored
+// in the index.
+func (o *Cache) insertItem(c *clientBlock, key ipKey, resolved []net.IP, ttls []time.Duration, i item) error {
+	var err error
+	stored := 0
+	for n, rip := range resolved {
+		i.ttl = 0
+		if o.ttl.enabled && n < len(ttls) {
+			i.ttl = ttls[n]
+		}
+		if err = c.insert(rip, i); err != nil {
+			break
+		}
+		stored++
+	}
+	if stored > 0 {
+		c.names.add(i.name, i.ts)
+		if o.index != nil {
+			o.index.add(i.ts, key, i.name, resolved[:stored])
+		}
+	}
+	return err
 }
 
 // Get data.
 func (o *Cache) Get(client, resolved net.IP, name string) (bool, time.Time) {
-	o.mu.RLock()
-	c, ok := o.clients[getIPKey(client)]
-	o.mu.RUnlock()
+	m := o.Match(client, resolved, name)
+	return m.Result, m.Last
+}
+
+// Match returns the match in the cache, name can be empty.
+func (o *Cache) Match(client, resolved net.IP, name string) Match {
+	return o.MatchWith(client, resolved, name, MatchExact)
+}
+
+// MatchWith returns the match in the cache comparing names with the mode,
+// name can be empty. If several names match, the newest is returned.
+func (o *Cache) MatchWith(client, resolved net.IP, name string, mode MatchMode) Match {
+	return o.MatchAt(client, resolved, name, mode, time.Now())
+}
+
+// MatchAt returns the match in the cache at a point in time, expiration is
+// evaluated relative to it. Past resolutions are found only if the history
+// stored and the expiration of the cache include them.
+func (o *Cache) MatchAt(client, resolved net.IP, name string, mode MatchMode, at time.Time) Match {
+	c, ok := o.findClientBlock(o.clientKey(client))
 	if !ok {
-		return false, time.Time{}
+		return Match{Store: o.Store()}
 	}
-	result, last := c.doQuery(resolved, name)
-	return result, last
+	found, ok := c.doQuery(resolved, newMatcher(name, mode), at)
+	if !ok {
+		return Match{Store: o.Store()}
+	}
+	return o.match(found, at)
+}
+
+// MatchMany returns the matches of the checks comparing names with the
+// mode, related by position. Checks are grouped by client, so each client
+// is searched once per batch.
+func (o *Cache) MatchMany(cs []Check, mode MatchMode) []Match {
+	now := time.Now()
+	store := o.Store()
+	matches := make([]Match, len(cs))
+	clients := make(map[ipKey]*clientBlock)
+	for idx, chk := range cs {
+		at := chk.At
+		if at.IsZero() {
+			at = now
+		}
+		key := o.clientKey(chk.Client)
+		c, ok := clients[key]
+		if !ok {
+			c, _ = o.findClientBlock(key)
+			clients[key] = c
+		}
+		if c == nil {
+			matches[idx] = Match{Store: store}
+			continue
+		}
+		found, ok := c.doQuery(chk.Resolved, newMatcher(chk.Name, mode), at)
+		if !ok {
+			matches[idx] = Match{Store: store}
+			continue
+		}
+		matches[idx] = o.match(found, at)
+	}
+	return matches
+}
+
+// Lookup returns the names resolved by client for the resolved ip that are
+// not expired, newest first.
+func (o *Cache) Lookup(client, resolved net.IP) []NameInfo {
+	c, ok := o.findClientBlock(o.clientKey(client))
+	if !ok {
+		return nil
+	}
+	return c.lookup(resolved)
+}
+
+// Clients returns the clients that resolved the ip or the name, newest
+// first. It returns dnsutil.ErrNotSupported if the index is not enabled.
+func (o *Cache) Clients(resolved net.IP, name string) ([]ClientInfo, error) {
+	if o.index == nil {
+		return nil, dnsutil.ErrNotSupported
+	}
+	if resolved != nil {
+		return o.index.getByIP(resolved, o.Expires()), nil
+	}
+	return o.index.getByName(strings.ToLower(name), o.Expires()), nil
+}
+
+// ClientCount returns the number of clients in the cache.
+func (o *Cache) ClientCount() int {
+	return int(atomic.LoadInt64(&o.nclients))
 }
 
 // Flushed returns time from last flush.
 func (o *Cache) Flushed() time.Time {
-	return o.flushed
+	return time.Unix(0, atomic.LoadInt64(&o.flushed))
 }
 
 // Cleaned returns time from last clean.
 func (o *Cache) Cleaned() time.Time {
-	return o.cleaned
+	return time.Unix(0, atomic.LoadInt64(&o.cleaned))
 }
 
 // Expires returns expiration time.
 func (o *Cache) Expires() time.Duration {
-	return o.expires
+	return time.Duration(atomic.LoadInt64(&o.expires))
+}
+
+// SetExpires changes expiration time. Items are expired using the new
+// value in queries and in the next clean.
+func (o *Cache) SetExpires(d time.Duration) {
+	atomic.StoreInt64(&o.expires, int64(d))
 }
 
 // Store returns store time.
 func (o *Cache) Store() time.Time {
-	if time.Since(o.flushed) < o.expires {
-		return o.flushed
-	}
-	return time.Now().Add(-o.expires)
+	return storeTime(o)
 }
 
 // Flush cache.
 func (o *Cache) Flush() {
-	o.mu.Lock()
-	defer o.mu.Unlock()
-
-	o.clients = make(map[string]*clientBlock)
+	for i := range o.shards {
+		s := &o.shards[i]
+		s.mu.Lock()
+		clients := s.clients
+		s.clients = make(map[ipKey]*clientBlock)
+		s.mu.Unlock()
+		// counters are reset below
+		for _, c := range clients {
+			c.mu.Lock()
+			c.evicted = true
+			c.mu.Unlock()
+		}
+	}
+	atomic.StoreInt64(&o.nclients, 0)
+	atomic.StoreInt64(&o.nblocks, 0)
+	if o.index != nil {
+		o.index.flush()
+	}
 	//garbage collector hash some work... ;)
-	o.flushed = time.Now()
+	atomic.StoreInt64(&o.flushed, time.Now().UnixNano())
+}
+
+// FlushNet removes the clients in the network and returns the number of
+// clients removed.
+func (o *Cache) FlushNet(network *net.IPNet) int {
+	removed := make(map[ipKey]struct{})
+	for i := range o.shards {
+		s := &o.shards[i]
+		s.mu.Lock()
+		for k, c := range s.clients {
+			if !network.Contains(c.network.IP) {
+				continue
+			}
+			delete(s.clients, k)
+			removed[k] = struct{}{}
+			c.remove()
+			atomic.AddInt64(&o.nclients, -1)
+		}
+		s.mu.Unlock()
+	}
+	o.unindex(removed)
+	return len(removed)
 }
 
 // Clean expired items from cache.
 func (o *Cache) Clean() {
-	o.mu.RLock()
 	//gets a copy of pointers to clientdata
-	clients := make([]*clientBlock, 0, len(o.clients))
-	for _, client := range o.clients {
-		clients = append(clients, client)
-	}
-	o.mu.RUnlock()
+	clients := o.clientList()
 	//iterate clients and clean
-	for _, c := range clients {
-		c.clean(o.expires)
+	expires := o.Expires()
+	for _, e := range clients {
+		e.client.clean(expires)
 	}
-	o.cleaned = time.Now()
+	if o.index != nil {
+		o.index.clean(expires)
+	}
+	atomic.StoreInt64(&o.cleaned, time.Now().UnixNano())
 }
 
 // Dump cache content to writer.
 func (o *Cache) Dump(out io.Writer) {
-	o.mu.Lock()
-	defer o.mu.Unlock()
-
 	fmt.Fprintf(out, "dump: %s\n", time.Now())
-	fmt.Fprintf(out, "expires: %v\n", o.expires)
+	fmt.Fprintf(out, "expires: %v\n", o.Expires())
 	fmt.Fprintf(out, "limits: %+v\n\n", o.limits)
 	//for each client
-	for key, client := range o.clients {
+	now := time.Now()
+	for _, e := range o.clientList() {
+		client := e.client
+		st := client.stats(now)
 		client.mu.Lock()
-		fmt.Fprintf(out, "- key: %v\n", key)
+		fmt.Fprintf(out, "- key: %v", netString(client.network))
+		if co, ok := client.overflow(); ok {
+			fmt.Fprintf(out, " evicted-blocks: %v evicted-names: %v", co.Blocks, co.Names)
+		}
+		if nx, nd := atomic.LoadUint64(&client.nxdomain), atomic.LoadUint64(&client.nodata); nx > 0 || nd > 0 {
+			fmt.Fprintf(out, " nxdomain: %v nodata: %v", nx, nd)
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "  stats: first: %s names: %v domains: %v label-length: %.1f label-entropy: %.2f rate: %.1f\n",
+			st.First.Format("20060102150405"), st.Names, st.Domains, st.LabelLength, st.LabelEntropy, st.Rate)
 		//for each block
 		for n, b := range client.blocks {
 			b.mu.Lock()
@@ -144,10 +504,10 @@ func (o *Cache) Dump(out io.Writer) {
 			for k, i := range b.index {
 				node := b.nodes[i]
 				fmt.Fprintf(out, "    - key: %s index: %v last: %s\n", k, i, node.last.Format("20060102150405"))
-				fmt.Fprintf(out, "      name: %s ts: %s\n", node.item.name, node.item.ts.Format("20060102150405"))
+				dumpItem(out, node.item)
 				if len(node.others) > 0 {
 					for _, item := range node.others {
-						fmt.Fprintf(out, "      name: %s ts: %s\n", item.name, item.ts.Format("20060102150405"))
+						dumpItem(out, item)
 					}
 				}
 			}
@@ -157,31 +517,75 @@ func (o *Cache) Dump(out io.Writer) {
 	}
 }
 
-func (o *Cache) getClientBlock(ip net.IP) *clientBlock {
+// ClientNet returns the network used for grouping the client in the cache.
+func (o *Cache) ClientNet(ip net.IP) *net.IPNet {
+	return o.aggregate.ClientNet(ip)
+}
+
+func (o *Cache) clientKey(ip net.IP) ipKey {
+	if !o.aggregated {
+		return getIPKey(ip)
+	}
+	return o.aggregate.clientKey(ip)
+}
+
+func (o *Cache) findClientBlock(key ipKey) (*clientBlock, bool) {
+	s := o.shard(key)
+	s.mu.RLock()
+	c, ok := s.clients[key]
+	s.mu.RUnlock()
+	return c, ok
+}
+
+func (o *Cache) getClientBlock(key ipKey, ip net.IP) *clientBlock {
+	s := o.shard(key)
 	//use read lock for fatest path
-	o.mu.RLock()
-	c, ok := o.clients[getIPKey(ip)]
+	s.mu.RLock()
+	c, ok := s.clients[key]
+	s.mu.RUnlock()
 	if ok {
-		o.mu.RUnlock()
 		return c
 	}
-	o.mu.RUnlock()
 	//creates a new block
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	c, ok = o.clients[getIPKey(ip)]
-	if ok {
-		return c
+	s.mu.Lock()
+	c, ok = s.clients[key]
+	if !ok {
+		c = o.newClientBlock(o.aggregate.ClientNet(ip))
+		s.clients[key] = c
+	}
+	s.mu.Unlock()
+	if !ok {
+		o.evictClients()
 	}
-	return o.newClientBlock(ip)
+	return c
 }
 
-func (o *Cache) newClientBlock(ip net.IP) *clientBlock {
+func (o *Cache) newClientBlock(network *net.IPNet) *clientBlock {
 	c := &clientBlock{
-		cache:  o,
-		blocks: make([]*resolvBlock, 0),
+		updated: time.Now().UnixNano(),
+		cache:   o,
+		network: network,
+		limits:  o.clientLimits(network),
+		blocks:  make([]*resolvBlock, 0),
 	}
 	c.newResolvBlock()
-	o.clients[getIPKey(ip)] = c
+	atomic.AddInt64(&o.nclients, 1)
 	return c
 }
+
+func dumpItem(out io.Writer, i item) {
+	fmt.Fprintf(out, "      name: %s ts: %s", i.name, i.ts.Format("20060102150405"))
+	if !i.since.Equal(i.ts) {
+		fmt.Fprintf(out, " since: %s", i.since.Format("20060102150405"))
+	}
+	if len(i.past) > 0 {
+		fmt.Fprintf(out, " past: %v", len(i.past))
+	}
+	if i.ttl > 0 {
+		fmt.Fprintf(out, " ttl: %v", i.ttl)
+	}
+	if len(i.chain) > 0 {
+		fmt.Fprintf(out, " chain: %s", strings.Join(i.chain, ">"))
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	benchClients  = 4096
+	benchResolved = 256
+)
+
+var (
+	benchClientIPs   = benchIPs(10, benchClients)
+	benchResolvedIPs = benchIPs(192, benchResolved)
+)
+
+func benchIPs(prefix byte, n int) []net.IP {
+	ips := make([]net.IP, 0, n)
+	for i := 0; i < n; i++ {
+		ip := make(net.IP, net.IPv4len)
+		ip[0] = prefix
+		binary.BigEndian.PutUint16(ip[2:], uint16(i))
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+func benchCache() *Cache {
+	limits := DefaultLimits()
+	limits.MaxBlocksClient = 1024
+	return NewCache(time.Hour, limits)
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := benchCache()
+	clients := benchIPs(10, 256)
+	resolved := benchIPs(192, 16)
+	now := time.Now()
+	var failed int32
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		go func(w int) {
+			defer func() { done <- struct{}{} }()
+			for i := w; i < len(clients)*len(resolved); i += 8 {
+				client, ip := clients[i%len(clients)], resolved[i/len(clients)]
+				if err := c.Set(now, client, "www.example.com", []net.IP{ip}); err != nil {
+					atomic.AddInt32(&failed, 1)
+					continue
+				}
+				if ok, _ := c.Get(client, ip, "www.example.com"); !ok {
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}(w)
+	}
+	for w := 0; w < 8; w++ {
+		<-done
+	}
+	if failed > 0 {
+		t.Fatalf("%v sets or gets failed", failed)
+	}
+	if c.ClientCount() != len(clients) {
+		t.Errorf("ClientCount() = %v, want %v", c.ClientCount(), len(clients))
+	}
+	for _, client := range clients {
+		for _, ip := range resolved {
+			if ok, _ := c.Get(client, ip, "www.example.com"); !ok {
+				t.Fatalf("Get(%v, %v) not found", client, ip)
+			}
+		}
+	}
+}
+
+func TestCacheMatchMany(t *testing.T) {
+	c := NewCache(time.Hour, DefaultLimits(), KeepHistory(2))
+	now := time.Now()
+	a, b := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	ip1, ip2 := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	c.Set(now.Add(-50*time.Minute), a, "www.example.com", []net.IP{ip1})
+	c.Set(now.Add(-time.Minute), a, "mail.example.com", []net.IP{ip2})
+	c.Set(now.Add(-time.Minute), b, "www.example.org", []net.IP{ip1})
+
+	checks := []Check{
+		{Client: a, Resolved: ip1, Name: "www.example.com"},
+		{Client: b, Resolved: ip1},
+		{Client: a, Resolved: ip2, Name: "www.example.com"},
+		{Client: net.ParseIP("10.0.0.3"), Resolved: ip1},
+		{Client: a, Resolved: ip2, Name: "example.com"},
+		// before the resolution
+		{Client: b, Resolved: ip1, At: now.Add(-10 * time.Minute)},
+		{Client: a, Resolved: ip1, Name: "www.example.com", At: now.Add(-40 * time.Minute)},
+	}
+	want := []bool{true, true, false, false, false, false, true}
+	ms := c.MatchMany(checks, MatchExact)
+	if len(ms) != len(checks) {
+		t.Fatalf("MatchMany() = %v results, want %v", len(ms), len(checks))
+	}
+	for i, m := range ms {
+		if m.Result != want[i] {
+			t.Errorf("MatchMany()[%v] = %v, want %v", i, m.Result, want[i])
+		}
+		// results are the same of the single checks
+		chk := checks[i]
+		at := chk.At
+		if at.IsZero() {
+			at = now
+		}
+		single := c.MatchAt(chk.Client, chk.Resolved, chk.Name, MatchExact, at)
+		if single.Result != m.Result || !single.Last.Equal(m.Last) || single.Name != m.Name {
+			t.Errorf("MatchMany()[%v] = %+v, MatchAt() = %+v", i, m, single)
+		}
+	}
+	if ms := c.MatchMany(checks[4:5], MatchDomain); !ms[0].Result || ms[0].Name != "mail.example.com" {
+		t.Errorf("MatchMany() with domain mode = %+v", ms[0])
+	}
+	if ms := c.MatchMany(nil, MatchExact); len(ms) != 0 {
+		t.Errorf("MatchMany(nil) = %v", ms)
+	}
+}
+
+func BenchmarkCacheSet(b *testing.B) {
+	cache := benchCache()
+	now := time.Now()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resolved := benchResolvedIPs[i%benchResolved : i%benchResolved+1]
+		cache.Set(now, benchClientIPs[i%benchClients], "www.example.com", resolved)
+	}
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	cache := benchCache()
+	now := time.Now()
+	for i := 0; i < benchClients*benchResolved; i++ {
+		resolved := benchResolvedIPs[i%benchResolved : i%benchResolved+1]
+		cache.Set(now, benchClientIPs[i%benchClients], "www.example.com", resolved)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(benchClientIPs[i%benchClients], benchResolvedIPs[i%benchResolved], "www.example.com")
+	}
+}
+
+// BenchmarkCacheMatchMany checks batches of flows from a few clients.
+func BenchmarkCacheMatchMany(b *testing.B) {
+	const batch = 256
+	cache := benchCache()
+	now := time.Now()
+	for i := 0; i < benchClients*benchResolved; i++ {
+		resolved := benchResolvedIPs[i%benchResolved : i%benchResolved+1]
+		cache.Set(now, benchClientIPs[i%benchClients], "www.example.com", resolved)
+	}
+	cs := make([]Check, 0, batch)
+	for i := 0; i < batch; i++ {
+		cs = append(cs, Check{Client: benchClientIPs[i%8], Resolved: benchResolvedIPs[i%benchResolved]})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.MatchMany(cs, MatchExact)
+	}
+}
+
+// BenchmarkCacheParallel runs collects and checks concurrently, one collect
+// every ratio operations.
+func BenchmarkCacheParallel(b *testing.B) {
+	for _, ratio := range []int{2, 10} {
+		b.Run(fmt.Sprintf("collect1of%v", ratio), func(b *testing.B) {
+			cache := benchCache()
+			now := time.Now()
+			var seq uint64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := int(atomic.AddUint64(&seq, 1))
+					client := benchClientIPs[i%benchClients]
+					resolved := benchResolvedIPs[i%benchResolved : i%benchResolved+1]
+					if i%ratio == 0 {
+						cache.Set(now, client, "www.example.com", resolved)
+						continue
+					}
+					cache.Get(client, resolved[0], "www.example.com")
+				}
+			})
+		})
+	}
+}
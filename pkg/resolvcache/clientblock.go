@@ -4,7 +4,9 @@ package resolvcache
 
 import (
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/luids-io/api/dnsutil"
@@ -12,37 +14,71 @@ import (
 
 // this struct is per dns client ip
 type clientBlock struct {
-	cache *Cache
-	mu    sync.RWMutex
+	// atomic values, must be 64-bit aligned
+	updated       int64
+	evictedBlocks uint64
+	evictedNames  uint64
+	nxdomain      uint64
+	nodata        uint64
+	first         int64
+	cache         *Cache
+	network       *net.IPNet
+	// limits with the profile of the client applied
+	limits Limits
+	mu     sync.RWMutex
 	// blocks stores blocks
 	blocks []*resolvBlock
+	// evicted is true if the client was removed from the cache, its
+	// blocks are no longer accounted
+	evicted bool
+	// failed stores the recent names with negative answers
+	failed failureLog
+	// rate of queries
+	rate rateCounter
+	// names resolved
+	names nameCounter
 }
 
-func (c *clientBlock) doQuery(resolved net.IP, name string) (bool, time.Time) {
-	var blocks []*resolvBlock
-	//gets a copy of block pointers for iterate without lock the full client
+func (c *clientBlock) doQuery(resolved net.IP, m matcher, at time.Time) (item, bool) {
+	key := getIPKey(resolved)
+	//iterate blocks, newest first, without copying them
 	c.mu.RLock()
-	if c.blocks == nil {
-		blocks = nil
-	} else {
-		blocks = make([]*resolvBlock, len(c.blocks))
-		copy(blocks, c.blocks)
+	defer c.mu.RUnlock()
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		found, ok := c.blocks[i].doQuery(key, m, at)
+		if ok {
+			return found, true
+		}
+	}
+	return item{}, false
+}
+
+func (c *clientBlock) lookup(resolved net.IP) []NameInfo {
+	key := getIPKey(resolved)
+	//iterate blocks and merge names keeping the newest timestamp
+	found := make(map[string]item)
+	c.mu.RLock()
+	for _, b := range c.blocks {
+		b.lookup(key, found)
 	}
 	c.mu.RUnlock()
-	//iterate blocks
-	for i := len(blocks) - 1; i >= 0; i-- {
-		result, last := blocks[i].doQuery(resolved, name)
-		if result {
-			return result, last
-		}
+	if len(found) == 0 {
+		return nil
 	}
-	return false, time.Time{}
+	names := make([]NameInfo, 0, len(found))
+	for _, i := range found {
+		names = append(names, NameInfo{Name: i.name, Last: i.ts, Chain: i.chain})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Last.After(names[j].Last) })
+	return names
 }
 
-func (c *clientBlock) insert(resolved net.IP, name string, ts time.Time) error {
+func (c *clientBlock) insert(resolved net.IP, i item) error {
+	c.touch(i.ts)
+	key := getIPKey(resolved)
 	//gets current block
 	block := c.currentBlock()
-	ok, err := block.insert(resolved, name, ts)
+	ok, err := block.insert(key, i)
 	if err != nil {
 		return err
 	}
@@ -53,7 +89,7 @@ func (c *clientBlock) insert(resolved net.IP, name string, ts time.Time) error {
 		if err != nil {
 			return err
 		}
-		ok, err = block.insert(resolved, name, ts)
+		ok, err = block.insert(key, i)
 		if err != nil {
 			return err
 		}
@@ -91,44 +127,103 @@ func (c *clientBlock) nextFreeBlock() (*resolvBlock, error) {
 	}
 	//gets current block and check if it's full
 	block := c.blocks[idx]
-	if block.next < c.cache.limits.BlockSize {
+	if !block.full() {
 		return block, nil
 	}
 	//checks limits
-	if len(c.blocks) > c.cache.limits.MaxBlocksClient {
-		return nil, dnsutil.ErrLimitDNSClientQueries
+	if len(c.blocks) > c.limits.MaxBlocksClient {
+		if c.cache.overflow != OverflowEvict {
+			return nil, dnsutil.ErrLimitDNSClientQueries
+		}
+		c.evictBlock()
 	}
 	//returns a new block
 	return c.newResolvBlock(), nil
 }
 
 func (c *clientBlock) newResolvBlock() *resolvBlock {
-	bs := c.cache.limits.BlockSize
-	newblock := &resolvBlock{
-		cache: c.cache,
-		last:  time.Now(),
-		index: make(map[string]int, bs),
-		nodes: make([]node, bs, bs),
-	}
+	newblock := c.allocBlock(time.Now())
 	c.blocks = append(c.blocks, newblock)
+	if !c.evicted {
+		atomic.AddInt64(&c.cache.nblocks, 1)
+	}
 	return newblock
 }
 
+func (c *clientBlock) allocBlock(last time.Time) *resolvBlock {
+	bs := c.cache.limits.BlockSize
+	return &resolvBlock{
+		cache:  c.cache,
+		client: c,
+		last:   last,
+		index:  make(map[ipKey]int, bs),
+		nodes:  make([]node, bs, bs),
+	}
+}
+
 func (c *clientBlock) clean(d time.Duration) {
+	c.names.clean(time.Now(), d)
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	// iterate and append all updated
 	newblocks := make([]*resolvBlock, 0)
+	live := 0
 	for _, block := range c.blocks {
-		if time.Since(block.last) <= d {
-			block.clean(d)
+		if time.Since(block.updated()) <= d {
+			live += block.clean(d)
 			newblocks = append(newblocks, block)
+			continue
 		}
+		block.drop()
+	}
+	// move nodes in use to new blocks if less blocks are required
+	bs := c.cache.limits.BlockSize
+	if len(newblocks) > 1 && (live+bs-1)/bs < len(newblocks) {
+		newblocks = c.compact(newblocks)
+	}
+	if !c.evicted {
+		atomic.AddInt64(&c.cache.nblocks, int64(len(newblocks)-len(c.blocks)))
 	}
 	c.blocks = newblocks
 }
 
-func getIPKey(ip net.IP) string {
-	//return string(ip.To16())
-	return ip.String()
+// compact moves the nodes of the blocks to new blocks, oldest first, and
+// drops the blocks. Nodes are moved in slot order, so the result doesn't
+// depend on the order of the index. Nodes of the same resolved ip are
+// merged if they fall in the same block. Caller must hold the lock.
+func (c *clientBlock) compact(blocks []*resolvBlock) []*resolvBlock {
+	bs := c.cache.limits.BlockSize
+	newblocks := make([]*resolvBlock, 0, len(blocks))
+	var current *resolvBlock
+	for _, b := range blocks {
+		b.mu.Lock()
+		keys := make([]ipKey, b.next)
+		for key, idx := range b.index {
+			keys[idx] = key
+		}
+		for idx, n := range b.nodes[:b.next] {
+			if n.name == "" {
+				continue
+			}
+			key := keys[idx]
+			if current != nil {
+				if j, ok := current.index[key]; ok {
+					current.nodes[j].merge(n, c)
+					current.touch(n.last)
+					continue
+				}
+			}
+			if current == nil || current.next >= bs {
+				current = c.allocBlock(time.Time{})
+				newblocks = append(newblocks, current)
+			}
+			current.nodes[current.next] = n
+			current.index[key] = current.next
+			current.next++
+			current.touch(n.last)
+		}
+		b.dropped = true
+		b.mu.Unlock()
+	}
+	return newblocks
 }
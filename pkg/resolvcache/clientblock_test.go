@@ -0,0 +1,78 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientCompact(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 4
+	c := NewCache(time.Hour, limits)
+	client := net.ParseIP("10.0.0.1")
+	ip := func(s string) net.IP { return net.ParseIP("192.0.2." + s) }
+	now := time.Now()
+	inserts := []struct {
+		ago      time.Duration
+		resolved string
+		name     string
+	}{
+		// first block
+		{30 * time.Minute, "1", "a1.example.com"},
+		{90 * time.Minute, "2", "expired.example.com"},
+		{90 * time.Minute, "3", "expired.example.com"},
+		{20 * time.Minute, "4", "d.example.com"},
+		// second block, the ip .1 is stored again with other name
+		{90 * time.Minute, "5", "expired.example.com"},
+		{10 * time.Minute, "1", "a2.example.com"},
+		{90 * time.Minute, "6", "expired.example.com"},
+		{90 * time.Minute, "7", "expired.example.com"},
+		// third block
+		{5 * time.Minute, "8", "h.example.com"},
+	}
+	for _, in := range inserts {
+		if err := c.Set(now.Add(-in.ago), client, in.name, []net.IP{ip(in.resolved)}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	cb, _ := c.findClientBlock(c.clientKey(client))
+	if len(cb.blocks) != 3 {
+		t.Fatalf("blocks before clean = %v, want 3", len(cb.blocks))
+	}
+	old := append([]*resolvBlock{}, cb.blocks...)
+	c.Clean()
+
+	if len(cb.blocks) != 1 {
+		t.Fatalf("blocks after clean = %v, want 1", len(cb.blocks))
+	}
+	for _, b := range old {
+		if !b.dropped {
+			t.Errorf("compacted block not dropped")
+		}
+	}
+	// nodes are moved in slot order and duplicated ips are merged
+	b := cb.blocks[0]
+	want := []string{"192.0.2.1", "192.0.2.4", "192.0.2.8"}
+	if b.next != len(want) || len(b.index) != len(want) {
+		t.Fatalf("nodes = %v, index = %v, want %v", b.next, len(b.index), len(want))
+	}
+	for i, s := range want {
+		if idx, ok := b.index[getIPKey(net.ParseIP(s))]; !ok || idx != i {
+			t.Errorf("node %s in slot %v, want %v", s, idx, i)
+		}
+	}
+	if n := b.nodes[0]; n.name != "a1.example.com" || len(n.others) != 1 || n.others[0].name != "a2.example.com" {
+		t.Errorf("merged node = %v %v", n.name, n.others)
+	}
+	// every unexpired item is kept
+	for _, in := range inserts {
+		ok, _ := c.Get(client, ip(in.resolved), in.name)
+		if expired := in.ago > time.Hour; ok == expired {
+			t.Errorf("Get(%s,%s) = %v, want %v", in.resolved, in.name, ok, !expired)
+		}
+	}
+	checkAccounting(t, c)
+}
@@ -0,0 +1,240 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// rateWindow is the number of minutes used for the rate of resolutions.
+const rateWindow = 10
+
+// ClientStats stores behavioural information of a client. Names, domains
+// and labels are computed from the names resolved in the expiration time of
+// the cache, they are updated on each insert and the names expired are
+// discounted when the cache is cleaned. Label values are from the leftmost
+// label of each name, entropy is the Shannon entropy in bits per character.
+type ClientStats struct {
+	Client *net.IPNet `json:"-"`
+	// First is the time of the first activity of the client in the cache
+	First time.Time `json:"first"`
+	// Last is the time of the last activity
+	Last time.Time `json:"last"`
+	// Names and registrable domains resolved
+	Names   int `json:"names"`
+	Domains int `json:"domains"`
+	// averages of the leftmost label of the names
+	LabelLength  float64 `json:"label_length"`
+	LabelEntropy float64 `json:"label_entropy"`
+	// Rate of queries collected per minute in the last minutes, negative
+	// answers included
+	Rate float64 `json:"rate"`
+}
+
+// rateCounter counts events per minute in a ring of buckets.
+type rateCounter struct {
+	mu      sync.Mutex
+	minutes [rateWindow]int64
+	counts  [rateWindow]uint32
+}
+
+func (r *rateCounter) add(ts time.Time) {
+	m := ts.Unix() / 60
+	idx := int(m % rateWindow)
+	r.mu.Lock()
+	if r.minutes[idx] != m {
+		r.minutes[idx] = m
+		r.counts[idx] = 0
+	}
+	r.counts[idx]++
+	r.mu.Unlock()
+}
+
+// rate returns the events per minute in the window ending at now.
+func (r *rateCounter) rate(now time.Time) float64 {
+	m := now.Unix() / 60
+	var sum uint32
+	r.mu.Lock()
+	for i := range r.minutes {
+		if d := m - r.minutes[i]; d >= 0 && d < rateWindow {
+			sum += r.counts[i]
+		}
+	}
+	r.mu.Unlock()
+	return float64(sum) / rateWindow
+}
+
+// nameCounter counts the unique names and registrable domains resolved,
+// and the sums of the values of their labels.
+type nameCounter struct {
+	mu      sync.Mutex
+	names   map[string]nameEntry
+	domains map[string]int
+	length  int
+	entropy float64
+}
+
+// nameEntry stores the last resolution of a name and its values, so they
+// can be discounted when it expires.
+type nameEntry struct {
+	last    time.Time
+	domain  string
+	length  int
+	entropy float64
+}
+
+// add counts the name resolved at the time if it's new, otherwise updates
+// its last resolution.
+func (n *nameCounter) add(name string, ts time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if e, ok := n.names[name]; ok {
+		if ts.After(e.last) {
+			e.last = ts
+			n.names[name] = e
+		}
+		return
+	}
+	if n.names == nil {
+		n.names = make(map[string]nameEntry)
+		n.domains = make(map[string]int)
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		domain = name
+	}
+	label := name
+	if idx := strings.IndexByte(name, '.'); idx >= 0 {
+		label = name[:idx]
+	}
+	e := nameEntry{last: ts, domain: domain, length: len(label), entropy: labelEntropy(label)}
+	n.names[name] = e
+	n.domains[domain]++
+	n.length += e.length
+	n.entropy += e.entropy
+}
+
+// clean discounts the names not resolved in the duration.
+func (n *nameCounter) clean(now time.Time, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, e := range n.names {
+		if now.Sub(e.last) <= d {
+			continue
+		}
+		delete(n.names, name)
+		if n.domains[e.domain]--; n.domains[e.domain] <= 0 {
+			delete(n.domains, e.domain)
+		}
+		n.length -= e.length
+		n.entropy -= e.entropy
+	}
+	if len(n.names) == 0 {
+		// avoids the drift of the float sums
+		n.length, n.entropy = 0, 0
+	}
+}
+
+// read sets the values of the names in the stats.
+func (n *nameCounter) read(st *ClientStats) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.names) == 0 {
+		return
+	}
+	st.Names = len(n.names)
+	st.Domains = len(n.domains)
+	st.LabelLength = float64(n.length) / float64(len(n.names))
+	st.LabelEntropy = n.entropy / float64(len(n.names))
+}
+
+// activity registers a query of the client at the time.
+func (c *clientBlock) activity(ts time.Time) {
+	c.start(ts)
+	c.rate.add(ts)
+}
+
+// start updates the first activity of the client if ts is older.
+func (c *clientBlock) start(ts time.Time) {
+	nts := ts.UnixNano()
+	for {
+		first := atomic.LoadInt64(&c.first)
+		if first != 0 && first <= nts {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&c.first, first, nts) {
+			return
+		}
+	}
+}
+
+// ClientStats returns the behavioural information of the client.
+func (o *Cache) ClientStats(client net.IP) (ClientStats, bool) {
+	c, ok := o.findClientBlock(o.clientKey(client))
+	if !ok {
+		return ClientStats{}, false
+	}
+	return c.stats(time.Now()), true
+}
+
+// AllClientStats returns the behavioural information of the clients, most
+// recently updated first. If max is greater than zero, up to max clients
+// are returned.
+func (o *Cache) AllClientStats(max int) []ClientStats {
+	now := time.Now()
+	clients := o.clientList()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].client.lastUpdate() > clients[j].client.lastUpdate()
+	})
+	if max > 0 && len(clients) > max {
+		clients = clients[:max]
+	}
+	list := make([]ClientStats, 0, len(clients))
+	for _, e := range clients {
+		list = append(list, e.client.stats(now))
+	}
+	return list
+}
+
+// stats returns the values of the counters of the client.
+func (c *clientBlock) stats(now time.Time) ClientStats {
+	st := ClientStats{
+		Client: c.network,
+		Last:   time.Unix(0, c.lastUpdate()),
+		Rate:   c.rate.rate(now),
+	}
+	if first := atomic.LoadInt64(&c.first); first > 0 {
+		st.First = time.Unix(0, first)
+	}
+	c.names.read(&st)
+	return st
+}
+
+// labelEntropy returns the Shannon entropy of the label in bits per
+// character.
+func labelEntropy(label string) float64 {
+	if label == "" {
+		return 0
+	}
+	var freq [256]int
+	for i := 0; i < len(label); i++ {
+		freq[label[i]]++
+	}
+	n := float64(len(label))
+	e := 0.0
+	for _, f := range freq {
+		if f > 0 {
+			p := float64(f) / n
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
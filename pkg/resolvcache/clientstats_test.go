@@ -0,0 +1,97 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLabelEntropy(t *testing.T) {
+	tests := []struct {
+		label string
+		want  float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"ab", 1},
+		{"abcd", 2},
+		{"aabb", 1},
+	}
+	for _, tt := range tests {
+		if got := labelEntropy(tt.label); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("labelEntropy(%q) = %v, want %v", tt.label, got, tt.want)
+		}
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	c := NewCache(time.Hour, DefaultLimits())
+	client, resolved := net.ParseIP("10.0.0.1"), []net.IP{net.ParseIP("192.0.2.1")}
+	now := time.Now()
+	inserts := []struct {
+		ts time.Duration
+		r  Resolution
+	}{
+		{-2 * time.Hour, Resolution{Client: client, Name: "old.example.org", Resolved: resolved}},
+		{-3 * time.Minute, Resolution{Client: client, Name: "abcd.example.com", Resolved: resolved}},
+		{-2 * time.Minute, Resolution{Client: client, Name: "ABCD.example.com", Resolved: resolved}},
+		{-time.Minute, Resolution{Client: client, Name: "aa.example.com", CNAMEs: []string{"ab.example.co.uk"}, Resolved: resolved}},
+		{-time.Minute, Resolution{Client: client, Name: "gone.example.net", Negative: NXDomain}},
+	}
+	for _, in := range inserts {
+		if err := c.Insert(now.Add(in.ts), in.r); err != nil {
+			t.Fatalf("inserting %v: %v", in.r, err)
+		}
+	}
+	check := func(names, domains int, length, entropy float64) {
+		t.Helper()
+		st, ok := c.ClientStats(client)
+		if !ok {
+			t.Fatalf("ClientStats() not found")
+		}
+		if st.Names != names || st.Domains != domains ||
+			math.Abs(st.LabelLength-length) > 1e-9 || math.Abs(st.LabelEntropy-entropy) > 1e-9 {
+			t.Errorf("ClientStats() = %+v, want names %v domains %v length %v entropy %v", st, names, domains, length, entropy)
+		}
+		if !st.First.Equal(now.Add(-2 * time.Hour)) {
+			t.Errorf("ClientStats() first = %v, want %v", st.First, now.Add(-2*time.Hour))
+		}
+		// four queries in the window, negative answers included
+		if st.Rate != 0.4 {
+			t.Errorf("ClientStats() rate = %v, want 0.4", st.Rate)
+		}
+	}
+	// labels: old 3, abcd 4, aa 2, ab 2
+	check(4, 3, 11.0/4, (math.Log2(3)+2+0+1)/4)
+	// clean discounts the expired names
+	c.Clean()
+	check(3, 2, 8.0/3, (2+0+1)/3.0)
+	if _, ok := c.ClientStats(net.ParseIP("10.0.0.2")); ok {
+		t.Errorf("ClientStats() of unknown client found")
+	}
+}
+
+func TestAllClientStats(t *testing.T) {
+	c := NewCache(time.Hour, DefaultLimits())
+	clients := benchIPs(10, 5)
+	now := time.Now().Add(-time.Minute)
+	for i, client := range clients {
+		c.Set(now.Add(time.Duration(i)*time.Second), client, "www.example.com", []net.IP{net.ParseIP("192.0.2.1")})
+	}
+	if stats := c.AllClientStats(0); len(stats) != len(clients) {
+		t.Errorf("AllClientStats(0) = %v clients, want %v", len(stats), len(clients))
+	}
+	stats := c.AllClientStats(2)
+	if len(stats) != 2 {
+		t.Fatalf("AllClientStats(2) = %v clients, want 2", len(stats))
+	}
+	for i, st := range stats {
+		want := clients[len(clients)-1-i]
+		if !st.Client.IP.Equal(want) || st.Names != 1 {
+			t.Errorf("AllClientStats(2)[%v] = %v %v names, want %v", i, st.Client, st.Names, want)
+		}
+	}
+}
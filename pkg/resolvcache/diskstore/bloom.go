@@ -0,0 +1,57 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package diskstore
+
+import (
+	"hash/fnv"
+)
+
+// bloomHashes is the number of hashes used by the filters.
+const bloomHashes = 4
+
+// bloom is a bloom filter used for skipping the segments that don't store
+// a key.
+type bloom struct {
+	bits []uint64
+	mask uint64
+}
+
+// newBloom returns a filter of n bits rounded up to a power of two.
+func newBloom(n int) *bloom {
+	size := uint64(64)
+	for size < uint64(n) {
+		size <<= 1
+	}
+	return &bloom{bits: make([]uint64, size/64), mask: size - 1}
+}
+
+func (b *bloom) hashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
+
+func (b *bloom) add(key []byte) {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		pos := (h1 + i*h2) & b.mask
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloom) has(key []byte) bool {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < bloomHashes; i++ {
+		pos := (h1 + i*h2) & b.mask
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// size returns the memory used by the filter in bytes.
+func (b *bloom) size() int64 {
+	return int64(len(b.bits) * 8)
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package diskstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Index files store the offsets of the records of a segment sorted by the
+// hash of their keys, so checks only read the records of the client and
+// the resolved ip. Entries are the hash and the offset in big endian, the
+// file ends with the size of the segment indexed.
+
+const indexSuffix = ".idx"
+
+// indexEntrySize is the size of the entries of the index files.
+const indexEntrySize = 16
+
+// offsetsMemory is an estimation of the memory used by an entry of the
+// offsets in memory, without the offsets.
+const offsetsMemory = 48
+
+var errInvalidIndex = errors.New("diskstore: invalid index")
+
+// indexName returns the name of the index file of the segment.
+func indexName(fname string) string {
+	return strings.TrimSuffix(fname, segmentSuffix) + indexSuffix
+}
+
+// keyHash returns the hash of the key used in the indexes.
+func keyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+type indexEntry struct {
+	hash uint64
+	off  int64
+}
+
+// writeIndex writes the offsets of the segment of the size. The file is
+// replaced when complete, so readers never see a partial index.
+func writeIndex(fname string, offsets map[uint64][]int64, size int64) error {
+	entries := make([]indexEntry, 0, len(offsets))
+	for h, offs := range offsets {
+		for _, off := range offs {
+			entries = append(entries, indexEntry{hash: h, off: off})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hash != entries[j].hash {
+			return entries[i].hash < entries[j].hash
+		}
+		return entries[i].off < entries[j].off
+	})
+	tmpname := fname + ".tmp"
+	file, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	var buf [indexEntrySize]byte
+	for _, e := range entries {
+		binary.BigEndian.PutUint64(buf[:8], e.hash)
+		binary.BigEndian.PutUint64(buf[8:], uint64(e.off))
+		w.Write(buf[:])
+	}
+	binary.BigEndian.PutUint64(buf[:8], uint64(size))
+	w.Write(buf[:8])
+	err = w.Flush()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	return os.Rename(tmpname, fname)
+}
+
+// openIndex opens the index file and returns its number of entries.
+func openIndex(fname string) (*os.File, int64, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	if info.Size() < 8 || (info.Size()-8)%indexEntrySize != 0 {
+		file.Close()
+		return nil, 0, errInvalidIndex
+	}
+	return file, (info.Size() - 8) / indexEntrySize, nil
+}
+
+// indexSize returns the size of the segment indexed by the file.
+func indexSize(fname string) (int64, error) {
+	file, n, err := openIndex(fname)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var buf [8]byte
+	if _, err := file.ReadAt(buf[:], n*indexEntrySize); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf[:])), nil
+}
+
+// readIndex returns all the offsets of the index file.
+func readIndex(fname string) (map[uint64][]int64, error) {
+	file, n, err := openIndex(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	offsets := make(map[uint64][]int64)
+	r := bufio.NewReader(file)
+	var buf [indexEntrySize]byte
+	for i := int64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint64(buf[:8])
+		offsets[h] = append(offsets[h], int64(binary.BigEndian.Uint64(buf[8:])))
+	}
+	return offsets, nil
+}
+
+// lookupIndex returns the offsets of the hash in the index file.
+func lookupIndex(fname string, h uint64) ([]int64, error) {
+	file, n, err := openIndex(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var buf [indexEntrySize]byte
+	entry := func(i int64) (uint64, int64, error) {
+		if _, err := file.ReadAt(buf[:], i*indexEntrySize); err != nil {
+			return 0, 0, err
+		}
+		return binary.BigEndian.Uint64(buf[:8]), int64(binary.BigEndian.Uint64(buf[8:])), nil
+	}
+	var rerr error
+	first := sort.Search(int(n), func(i int) bool {
+		eh, _, err := entry(int64(i))
+		if err != nil {
+			rerr = err
+			return true
+		}
+		return eh >= h
+	})
+	if rerr != nil {
+		return nil, rerr
+	}
+	var offsets []int64
+	for i := int64(first); i < n; i++ {
+		eh, off, err := entry(i)
+		if err != nil {
+			return nil, err
+		}
+		if eh != h {
+			break
+		}
+		offsets = append(offsets, off)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package diskstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// segment is a file with the records stored in a period of time. First and
+// last are the oldest and newest timestamps of the records, size is the
+// length of the complete records of the file. The offsets of the records
+// are in the index file of the segment if indexed is true, offsets stores
+// the records not included in it.
+type segment struct {
+	fname   string
+	start   time.Time
+	first   time.Time
+	last    time.Time
+	records int
+	size    int64
+	filter  *bloom
+	indexed bool
+	offsets map[uint64][]int64
+}
+
+// record is a resolution stored in a segment, one line per record with
+// tab separated fields. Lists are separated by spaces.
+type record struct {
+	ts       time.Time
+	client   string
+	resolved []string
+	ttls     []time.Duration
+	name     string
+	cnames   []string
+}
+
+var (
+	errInvalidRecord = errors.New("diskstore: invalid record")
+	errTornRecord    = errors.New("diskstore: incomplete record")
+)
+
+// maxRecordSize limits the length of the records readed by offset.
+const maxRecordSize = 64 * 1024
+
+const segmentPrefix = "segment-"
+const segmentSuffix = ".log"
+
+// segmentName returns the file name of the segment started at the time.
+func segmentName(dir string, start time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%d%s", segmentPrefix, start.Unix(), segmentSuffix))
+}
+
+// segmentStart returns the start time from the file name of a segment.
+func segmentStart(fname string) (time.Time, bool) {
+	base := filepath.Base(fname)
+	if !strings.HasPrefix(base, segmentPrefix) || !strings.HasSuffix(base, segmentSuffix) {
+		return time.Time{}, false
+	}
+	secs, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(base, segmentPrefix), segmentSuffix), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+// add updates the segment information with the record stored at the
+// offset, end is the offset after the record.
+func (s *segment) add(r record, off, end int64) {
+	if s.records == 0 || r.ts.Before(s.first) {
+		s.first = r.ts
+	}
+	if s.records == 0 || r.ts.After(s.last) {
+		s.last = r.ts
+	}
+	s.records++
+	s.size = end
+	if s.offsets == nil {
+		s.offsets = make(map[uint64][]int64)
+	}
+	for _, resolved := range r.resolved {
+		key := filterKey(r.client, resolved)
+		s.filter.add(key)
+		h := keyHash(key)
+		s.offsets[h] = append(s.offsets[h], off)
+	}
+}
+
+// filterKey returns the key of the client and resolved ip in the filters.
+func filterKey(client, resolved string) []byte {
+	return []byte(client + " " + resolved)
+}
+
+// load rebuilds the segment information from its file and returns the
+// number of invalid records skipped. The index file is used if it's
+// valid, otherwise it's written again.
+func (s *segment) load() (int, error) {
+	file, err := os.Open(s.fname)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	invalid, err := readRecords(file, func(r record, off, end int64) bool {
+		s.add(r, off, end)
+		return true
+	})
+	if err != nil {
+		return invalid, err
+	}
+	if size, err := indexSize(indexName(s.fname)); err == nil && size == s.size {
+		s.indexed, s.offsets = true, nil
+		return invalid, nil
+	}
+	s.indexed = false
+	return invalid, s.seal()
+}
+
+// seal writes the offsets in memory to the index file, merged with the
+// offsets indexed before.
+func (s *segment) seal() error {
+	if len(s.offsets) == 0 {
+		return nil
+	}
+	offsets := s.offsets
+	if s.indexed {
+		indexed, err := readIndex(indexName(s.fname))
+		if err != nil {
+			return err
+		}
+		for h, offs := range s.offsets {
+			indexed[h] = append(indexed[h], offs...)
+		}
+		offsets = indexed
+	}
+	if err := writeIndex(indexName(s.fname), offsets, s.size); err != nil {
+		return err
+	}
+	s.indexed, s.offsets = true, nil
+	return nil
+}
+
+// remove deletes the files of the segment.
+func (s *segment) remove() {
+	os.Remove(s.fname)
+	os.Remove(indexName(s.fname))
+}
+
+// readSegment reads the records of the file and calls fn for each one
+// until it returns false. It returns the number of invalid records
+// skipped.
+func readSegment(fname string, fn func(record) bool) (int, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return readRecords(file, func(r record, off, end int64) bool {
+		return fn(r)
+	})
+}
+
+// readRecords reads the records with their offsets and returns the number
+// of invalid records skipped. An incomplete record at the end is ignored.
+func readRecords(in io.Reader, fn func(r record, off, end int64) bool) (int, error) {
+	reader := bufio.NewReader(in)
+	invalid := 0
+	var off int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return invalid, nil
+		}
+		if err != nil {
+			return invalid, err
+		}
+		end := off + int64(len(line))
+		r, perr := parseRecord(strings.TrimSuffix(line, "\n"))
+		if perr != nil {
+			invalid++
+		} else if !fn(r, off, end) {
+			return invalid, nil
+		}
+		off = end
+	}
+}
+
+// readRecordsAt reads the records stored at the offsets of the file.
+func readRecordsAt(fname string, offsets []int64) ([]record, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records := make([]record, 0, len(offsets))
+	for _, off := range offsets {
+		reader := bufio.NewReader(io.NewSectionReader(file, off, maxRecordSize))
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return records, fmt.Errorf("%v at offset %v", errTornRecord, off)
+		}
+		if err != nil {
+			return records, err
+		}
+		r, err := parseRecord(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return records, fmt.Errorf("%v at offset %v", err, off)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// String returns the line of the record.
+func (r record) String() string {
+	ttls := make([]string, 0, len(r.ttls))
+	for _, ttl := range r.ttls {
+		ttls = append(ttls, strconv.Itoa(int(ttl/time.Second)))
+	}
+	return fmt.Sprintf("%d\t%s\t%s\t%s\t%s\t%s\n", r.ts.UnixNano(), r.client,
+		strings.Join(r.resolved, " "), strings.Join(ttls, " "), r.name, strings.Join(r.cnames, " "))
+}
+
+func parseRecord(line string) (record, error) {
+	var r record
+	fields := strings.Split(line, "\t")
+	if len(fields) != 6 {
+		return r, errInvalidRecord
+	}
+	nsecs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return r, errInvalidRecord
+	}
+	r.ts = time.Unix(0, nsecs)
+	r.client = fields[1]
+	r.resolved = strings.Fields(fields[2])
+	for _, s := range strings.Fields(fields[3]) {
+		secs, err := strconv.Atoi(s)
+		if err != nil {
+			return r, errInvalidRecord
+		}
+		r.ttls = append(r.ttls, time.Duration(secs)*time.Second)
+	}
+	r.name = fields[4]
+	r.cnames = strings.Fields(fields[5])
+	if r.client == "" || r.name == "" || len(r.resolved) == 0 {
+		return r, errInvalidRecord
+	}
+	return r, nil
+}
+
+// ttl returns the ttl of the resolved ip, zero if unknown.
+func (r record) ttl(resolved string) time.Duration {
+	for i, s := range r.resolved {
+		if s == resolved && i < len(r.ttls) {
+			return r.ttls[i]
+		}
+	}
+	return 0
+}
+
+// hasResolved returns true if the record stores the resolved ip.
+func (r record) hasResolved(resolved string) bool {
+	for _, s := range r.resolved {
+		if s == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// ipString returns the ip in the format used in records.
+func ipString(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return ip.String()
+}
@@ -0,0 +1,531 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package diskstore implements a resolvcache.Store that keeps the
+// resolutions in files.
+//
+// Resolutions are appended to segment files, one per period of time. Each
+// segment has a bloom filter in memory with the clients and the resolved ips
+// stored, so checks only search the segments that may contain them, and an
+// index file with the offsets of the records by client and resolved ip, so
+// checks only read the records that match. The offsets of the segment in use
+// are kept in memory and written to its index when it's closed. Filters are
+// rebuilt from the files when the store is opened, indexes too if they are
+// missing or outdated. Expired segments are removed by Clean.
+package diskstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Store implements a resolvcache.Store in disk.
+type Store struct {
+	// atomic values
+	expires int64
+	flushed int64
+	cleaned int64
+
+	opts   options
+	logger yalogi.Logger
+	dir    string
+
+	mu       sync.Mutex
+	segments []*segment
+	current  *segment
+	file     *os.File
+	writer   *bufio.Writer
+	closed   bool
+}
+
+// Option is used for component configuration.
+type Option func(*options)
+
+type options struct {
+	logger    yalogi.Logger
+	segment   time.Duration
+	bits      int
+	aggregate resolvcache.Aggregation
+}
+
+var defaultOptions = options{
+	logger:  yalogi.LogNull,
+	segment: time.Hour,
+	bits:    1 << 20,
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// SegmentDuration option sets the period of time stored in each segment.
+func SegmentDuration(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.segment = d
+		}
+	}
+}
+
+// FilterBits option sets the size in bits of the filter of each segment.
+func FilterBits(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.bits = n
+		}
+	}
+}
+
+// AggregateClients option groups the client addresses in networks.
+func AggregateClients(a resolvcache.Aggregation) Option {
+	return func(o *options) {
+		o.aggregate = a
+	}
+}
+
+// ErrClosed is returned when the store is closed.
+var ErrClosed = errors.New("diskstore: store is closed")
+
+// New opens the store in the directory, creating it if it doesn't exist.
+func New(dir string, expires time.Duration, opt ...Option) (*Store, error) {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	if err := opts.aggregate.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid aggregation: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating dir '%s': %v", dir, err)
+	}
+	now := time.Now().UnixNano()
+	s := &Store{
+		expires: int64(expires),
+		flushed: now,
+		cleaned: now,
+		opts:    opts,
+		logger:  opts.logger,
+		dir:     dir,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load rebuilds the segments from the files of the directory.
+func (s *Store) load() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		return err
+	}
+	for _, fname := range files {
+		start, ok := segmentStart(fname)
+		if !ok {
+			continue
+		}
+		seg := &segment{fname: fname, start: start, filter: newBloom(s.opts.bits)}
+		invalid, err := seg.load()
+		if err != nil {
+			return fmt.Errorf("loading segment '%s': %v", fname, err)
+		}
+		if invalid > 0 {
+			s.logger.Warnf("diskstore: segment '%s': %v invalid records skipped", fname, invalid)
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].start.Before(s.segments[j].start)
+	})
+	// the oldest record sets the time from which the store has data
+	for _, seg := range s.segments {
+		if seg.records > 0 {
+			s.flushed = seg.first.UnixNano()
+			break
+		}
+	}
+	return nil
+}
+
+// Set stores the names resolved by the client.
+func (s *Store) Set(ts time.Time, client net.IP, name string, resolved []net.IP) error {
+	return s.Insert(ts, resolvcache.Resolution{Client: client, Name: name, Resolved: resolved})
+}
+
+// Insert stores the resolution. Negative answers are not supported.
+func (s *Store) Insert(ts time.Time, r resolvcache.Resolution) error {
+	if r.Negative != resolvcache.Positive {
+		return dnsutil.ErrNotSupported
+	}
+	if r.Name == "" {
+		return errors.New("name is empty")
+	}
+	if len(r.Resolved) == 0 {
+		return errors.New("resolved ips are empty")
+	}
+	rec := record{
+		ts:       ts,
+		client:   s.clientString(r.Client),
+		resolved: make([]string, 0, len(r.Resolved)),
+		ttls:     make([]time.Duration, 0, len(r.Resolved)),
+		name:     strings.ToLower(r.Name),
+		cnames:   make([]string, 0, len(r.CNAMEs)),
+	}
+	for _, cname := range r.CNAMEs {
+		rec.cnames = append(rec.cnames, strings.ToLower(cname))
+	}
+	for i, ip := range r.Resolved {
+		rec.resolved = append(rec.resolved, ipString(ip))
+		var ttl time.Duration
+		if i < len(r.TTLs) {
+			ttl = r.TTLs[i]
+		}
+		rec.ttls = append(rec.ttls, ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if err := s.rotate(ts); err != nil {
+		return err
+	}
+	line := rec.String()
+	if _, err := s.writer.WriteString(line); err != nil {
+		return err
+	}
+	off := s.current.size
+	s.current.add(rec, off, off+int64(len(line)))
+	return nil
+}
+
+// rotate opens a new segment if there is no current segment or the period
+// of the current one is over. It must be called with the lock.
+func (s *Store) rotate(ts time.Time) error {
+	if s.current != nil && ts.Before(s.current.start.Add(s.opts.segment)) {
+		return nil
+	}
+	if err := s.closeCurrent(); err != nil {
+		return err
+	}
+	start := ts.Truncate(s.opts.segment)
+	seg := s.findSegment(start)
+	if seg == nil {
+		seg = &segment{fname: segmentName(s.dir, start), start: start, filter: newBloom(s.opts.bits)}
+		s.segments = append(s.segments, seg)
+		sort.Slice(s.segments, func(i, j int) bool {
+			return s.segments[i].start.Before(s.segments[j].start)
+		})
+	}
+	file, err := os.OpenFile(seg.fname, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening segment '%s': %v", seg.fname, err)
+	}
+	// removes an incomplete record at the end, so offsets are valid
+	if info, err := file.Stat(); err == nil && info.Size() > seg.size {
+		s.logger.Warnf("diskstore: segment '%s': truncating incomplete record", seg.fname)
+		if err := file.Truncate(seg.size); err != nil {
+			file.Close()
+			return fmt.Errorf("truncating segment '%s': %v", seg.fname, err)
+		}
+	}
+	s.current, s.file, s.writer = seg, file, bufio.NewWriter(file)
+	return nil
+}
+
+func (s *Store) findSegment(start time.Time) *segment {
+	for _, seg := range s.segments {
+		if seg.start.Equal(start) {
+			return seg
+		}
+	}
+	return nil
+}
+
+// closeCurrent closes the file of the current segment and writes its index.
+// If the index can't be written, offsets are kept in memory. It must be
+// called with the lock.
+func (s *Store) closeCurrent() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.writer.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if ierr := s.current.seal(); ierr != nil {
+			s.logger.Warnf("diskstore: writing index of segment '%s': %v", s.current.fname, ierr)
+		}
+	}
+	s.current, s.file, s.writer = nil, nil, nil
+	return err
+}
+
+// Get returns true and the last resolution if the client resolved the ip
+// and the name, name can be empty.
+func (s *Store) Get(client, resolved net.IP, name string) (bool, time.Time) {
+	m := s.MatchAt(client, resolved, name, resolvcache.MatchExact, time.Now())
+	return m.Result, m.Last
+}
+
+// candidate is a segment that may contain the records of a key.
+type candidate struct {
+	fname   string
+	indexed bool
+	offsets []int64
+}
+
+// MatchAt returns the newest resolution that matches at the point in time.
+// Errors reading the segments are logged and their records are not found.
+func (s *Store) MatchAt(client, resolved net.IP, name string, mode resolvcache.MatchMode, at time.Time) resolvcache.Match {
+	// flush removes the segments, so records before it are not found
+	from := at.Add(-s.Expires())
+	sclient, sresolved := s.clientString(client), ipString(resolved)
+	key := filterKey(sclient, sresolved)
+	h := keyHash(key)
+
+	s.mu.Lock()
+	if s.writer != nil {
+		if err := s.writer.Flush(); err != nil {
+			s.logger.Warnf("diskstore: writing segment '%s': %v", s.current.fname, err)
+		}
+	}
+	candidates := make([]candidate, 0, len(s.segments))
+	for _, seg := range s.segments {
+		if seg.records == 0 || seg.last.Before(from) || seg.first.After(at) {
+			continue
+		}
+		if !seg.filter.has(key) {
+			continue
+		}
+		c := candidate{fname: seg.fname, indexed: seg.indexed}
+		if offs := seg.offsets[h]; len(offs) > 0 {
+			c.offsets = append(c.offsets, offs...)
+		}
+		candidates = append(candidates, c)
+	}
+	s.mu.Unlock()
+
+	var found record
+	var foundName string
+	var ok bool
+	for _, c := range candidates {
+		records, err := s.readCandidate(c, h)
+		if err != nil {
+			s.logger.Warnf("diskstore: reading segment '%s': %v", c.fname, err)
+		}
+		for _, r := range records {
+			if r.ts.Before(from) || r.ts.After(at) || (ok && !r.ts.After(found.ts)) {
+				continue
+			}
+			if r.client != sclient || !r.hasResolved(sresolved) {
+				continue
+			}
+			if matched, mok := r.match(name, mode); mok {
+				found, foundName, ok = r, matched, true
+			}
+		}
+	}
+	m := resolvcache.Match{Store: s.storeTime()}
+	if !ok {
+		return m
+	}
+	m.Result = true
+	m.Since, m.Last = found.ts, found.ts
+	m.TTL = found.ttl(sresolved)
+	m.InTTL = m.TTL > 0 && at.Sub(found.ts) <= m.TTL
+	m.Name = foundName
+	if len(found.cnames) > 0 {
+		m.Chain = append([]string{found.name}, found.cnames...)
+	}
+	return m
+}
+
+// readCandidate reads the records of the hash in the segment. Segments
+// removed by Clean or Flush are ignored.
+func (s *Store) readCandidate(c candidate, h uint64) ([]record, error) {
+	offsets := c.offsets
+	if c.indexed {
+		indexed, err := lookupIndex(indexName(c.fname), h)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(indexed, offsets...)
+	}
+	if len(offsets) == 0 {
+		return nil, nil
+	}
+	records, err := readRecordsAt(c.fname, offsets)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return records, err
+}
+
+// match returns the name of the record that matches the name queried.
+func (r record) match(name string, mode resolvcache.MatchMode) (string, bool) {
+	if resolvcache.MatchName(r.name, name, mode) {
+		return r.name, true
+	}
+	for _, cname := range r.cnames {
+		if resolvcache.MatchName(cname, name, mode) {
+			return cname, true
+		}
+	}
+	return "", false
+}
+
+// Clean removes the segments with all records expired.
+func (s *Store) Clean() {
+	from := time.Now().Add(-s.Expires())
+	s.mu.Lock()
+	segments := s.segments[:0]
+	for _, seg := range s.segments {
+		if seg != s.current && (seg.records == 0 || seg.last.Before(from)) {
+			seg.remove()
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	for i := len(segments); i < len(s.segments); i++ {
+		s.segments[i] = nil
+	}
+	s.segments = segments
+	s.mu.Unlock()
+	atomic.StoreInt64(&s.cleaned, time.Now().UnixNano())
+}
+
+// Flush removes all segments.
+func (s *Store) Flush() {
+	s.mu.Lock()
+	s.closeCurrent()
+	for _, seg := range s.segments {
+		seg.remove()
+	}
+	s.segments = nil
+	s.mu.Unlock()
+	atomic.StoreInt64(&s.flushed, time.Now().UnixNano())
+}
+
+// Dump writes the records not expired in text format, oldest segments
+// first. Errors reading the segments are logged.
+func (s *Store) Dump(out io.Writer) {
+	from := time.Now().Add(-s.Expires())
+	s.mu.Lock()
+	if s.writer != nil {
+		if err := s.writer.Flush(); err != nil {
+			s.logger.Warnf("diskstore: writing segment '%s': %v", s.current.fname, err)
+		}
+	}
+	files := make([]string, 0, len(s.segments))
+	for _, seg := range s.segments {
+		if seg.records > 0 && !seg.last.Before(from) {
+			files = append(files, seg.fname)
+		}
+	}
+	s.mu.Unlock()
+	for _, fname := range files {
+		fmt.Fprintf(out, "segment: %s\n", filepath.Base(fname))
+		invalid, err := readSegment(fname, func(r record) bool {
+			if r.ts.Before(from) {
+				return true
+			}
+			fmt.Fprintf(out, "  %s %s %s -> %v", r.ts.Format(time.RFC3339), r.client, r.name, r.resolved)
+			if len(r.cnames) > 0 {
+				fmt.Fprintf(out, " cnames: %v", r.cnames)
+			}
+			fmt.Fprintln(out)
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			s.logger.Warnf("diskstore: reading segment '%s': %v", fname, err)
+		}
+		if invalid > 0 {
+			s.logger.Warnf("diskstore: segment '%s': %v invalid records skipped", fname, invalid)
+		}
+	}
+}
+
+// Stats returns usage information. Blocks are the segments, names the
+// records stored and memory the size of the filters and an estimation of
+// the offsets not indexed.
+func (s *Store) Stats() resolvcache.Stats {
+	st := resolvcache.Stats{
+		Expires: s.Expires(),
+		Flushed: s.Flushed(),
+		Cleaned: time.Unix(0, atomic.LoadInt64(&s.cleaned)),
+	}
+	s.mu.Lock()
+	st.Blocks = len(s.segments)
+	for _, seg := range s.segments {
+		st.Names += seg.records
+		st.Memory += seg.filter.size()
+		for _, offs := range seg.offsets {
+			st.Memory += offsetsMemory + int64(cap(offs))*8
+		}
+	}
+	s.mu.Unlock()
+	return st
+}
+
+// Expires returns the expiration of the records.
+func (s *Store) Expires() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.expires))
+}
+
+// SetExpires sets the expiration of the records.
+func (s *Store) SetExpires(d time.Duration) {
+	atomic.StoreInt64(&s.expires, int64(d))
+}
+
+// Flushed returns the time of the last flush or the time of the oldest
+// record stored when the store was opened.
+func (s *Store) Flushed() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.flushed))
+}
+
+func (s *Store) storeTime() time.Time {
+	flushed, expires := s.Flushed(), s.Expires()
+	if time.Since(flushed) < expires {
+		return flushed
+	}
+	return time.Now().Add(-expires)
+}
+
+// Close flushes and closes the current segment.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.closeCurrent()
+}
+
+// clientString returns the client in the format used in records.
+func (s *Store) clientString(ip net.IP) string {
+	return ipString(s.opts.aggregate.ClientNet(ip).IP)
+}
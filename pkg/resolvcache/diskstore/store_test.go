@@ -0,0 +1,264 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package diskstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+func testStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := New(dir, time.Hour, SegmentDuration(time.Minute), FilterBits(1024))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return s
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSegmentRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := net.ParseIP("10.0.0.1")
+	base := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+	inserts := []struct {
+		ts       time.Duration
+		name     string
+		resolved string
+	}{
+		{10 * time.Second, "a.example.com", "192.0.2.1"},
+		{50 * time.Second, "b.example.com", "192.0.2.2"},
+		{70 * time.Second, "c.example.com", "192.0.2.3"},
+		{5*time.Minute + time.Second, "d.example.com", "192.0.2.4"},
+		// out of order, stored in the existing segment of its period
+		{20 * time.Second, "e.example.com", "192.0.2.5"},
+	}
+	s := testStore(t, dir)
+	for _, in := range inserts {
+		if err := s.Set(base.Add(in.ts), client, in.name, []net.IP{net.ParseIP(in.resolved)}); err != nil {
+			t.Fatalf("Set() = %v", err)
+		}
+	}
+	check := func(s *Store) {
+		t.Helper()
+		if files := segmentFiles(t, dir); len(files) != 3 {
+			t.Errorf("segment files = %v, want 3", files)
+		}
+		if st := s.Stats(); st.Blocks != 3 || st.Names != len(inserts) {
+			t.Errorf("Stats() = %v blocks, %v names", st.Blocks, st.Names)
+		}
+		for _, in := range inserts {
+			m := s.MatchAt(client, net.ParseIP(in.resolved), in.name, resolvcache.MatchExact, time.Now())
+			if !m.Result || !m.Last.Equal(base.Add(in.ts)) {
+				t.Errorf("MatchAt(%s) = %+v", in.name, m)
+			}
+		}
+		m := s.MatchAt(client, net.ParseIP("192.0.2.4"), "", resolvcache.MatchExact, base.Add(time.Minute))
+		if m.Result {
+			t.Errorf("MatchAt() before the resolution = %+v", m)
+		}
+	}
+	check(s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	// segments are rebuilt from the files
+	s = testStore(t, dir)
+	defer s.Close()
+	check(s)
+	if !s.Flushed().Equal(base.Add(10 * time.Second)) {
+		t.Errorf("Flushed() = %v, want the oldest record", s.Flushed())
+	}
+	// new records are appended to the segment of their period
+	now := time.Now()
+	if err := s.Set(now, client, "f.example.com", []net.IP{net.ParseIP("192.0.2.6")}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	s.SetExpires(time.Since(base.Add(2 * time.Minute)))
+	s.Clean()
+	if st := s.Stats(); st.Blocks != 2 {
+		t.Errorf("segments after clean = %v, want 2", st.Blocks)
+	}
+	if ok, _ := s.Get(client, net.ParseIP("192.0.2.1"), "a.example.com"); ok {
+		t.Errorf("record of a removed segment found")
+	}
+	if ok, _ := s.Get(client, net.ParseIP("192.0.2.6"), "f.example.com"); !ok {
+		t.Errorf("record of the current segment not found")
+	}
+}
+
+// warnLogger counts the warnings.
+type warnLogger struct {
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *warnLogger) Debugf(template string, args ...interface{}) {}
+func (l *warnLogger) Infof(template string, args ...interface{})  {}
+func (l *warnLogger) Errorf(template string, args ...interface{}) {}
+func (l *warnLogger) Fatalf(template string, args ...interface{}) {}
+func (l *warnLogger) Warnf(template string, args ...interface{}) {
+	l.mu.Lock()
+	l.warns = append(l.warns, fmt.Sprintf(template, args...))
+	l.mu.Unlock()
+}
+
+func (l *warnLogger) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.warns)
+}
+
+func TestSegmentIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	clients := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	resolved := net.ParseIP("192.0.2.1")
+	base := time.Now().Truncate(time.Minute).Add(-10 * time.Minute)
+	s := testStore(t, dir)
+	for i := 0; i < 100; i++ {
+		ts := base.Add(time.Duration(i) * time.Second)
+		name := fmt.Sprintf("n%v.example.com", i)
+		if err := s.Set(ts, clients[i%2], name, []net.IP{resolved}); err != nil {
+			t.Fatalf("Set() = %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	// closed segments are indexed
+	files := segmentFiles(t, dir)
+	for _, fname := range files {
+		size, err := indexSize(indexName(fname))
+		info, _ := os.Stat(fname)
+		if err != nil || size != info.Size() {
+			t.Errorf("index of '%s' = %v %v, want %v", fname, size, err, info.Size())
+		}
+	}
+	logger := &warnLogger{}
+	s, err = New(dir, time.Hour, SegmentDuration(time.Minute), FilterBits(1024), SetLogger(logger))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	defer s.Close()
+	for _, seg := range s.segments {
+		if !seg.indexed || seg.offsets != nil {
+			t.Errorf("segment '%s' loaded without index", seg.fname)
+		}
+	}
+	check := func(i int, want bool) {
+		t.Helper()
+		name := fmt.Sprintf("n%v.example.com", i)
+		m := s.MatchAt(clients[i%2], resolved, name, resolvcache.MatchExact, time.Now())
+		if m.Result != want || (want && !m.Last.Equal(base.Add(time.Duration(i)*time.Second))) {
+			t.Errorf("MatchAt(%s) = %+v, want %v", name, m, want)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		check(i, true)
+	}
+	if m := s.MatchAt(clients[1], resolved, "n0.example.com", resolvcache.MatchExact, time.Now()); m.Result {
+		t.Errorf("MatchAt() of other client = %+v", m)
+	}
+	// records appended to an indexed segment are merged in its index
+	if err := s.Set(base.Add(30*time.Second), clients[0], "late.example.com", []net.IP{resolved}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if ok, _ := s.Get(clients[0], resolved, "late.example.com"); !ok {
+		t.Errorf("record appended to indexed segment not found")
+	}
+	if err := s.Set(time.Now(), clients[0], "new.example.com", []net.IP{resolved}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if ok, _ := s.Get(clients[0], resolved, "late.example.com"); !ok {
+		t.Errorf("record merged in index not found")
+	}
+	check(0, true)
+	if logger.count() > 0 {
+		t.Errorf("warnings = %v", logger.warns)
+	}
+	// removed records are reported
+	s.mu.Lock()
+	fname := s.segments[0].fname
+	s.mu.Unlock()
+	if err := os.Truncate(fname, 10); err != nil {
+		t.Fatal(err)
+	}
+	check(0, false)
+	if logger.count() == 0 {
+		t.Errorf("read error not logged")
+	}
+}
+
+func TestSegmentIncomplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diskstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	ts := time.Now().Truncate(time.Minute).Add(-5 * time.Minute)
+	s := testStore(t, dir)
+	if err := s.Set(ts, client, "a.example.com", []net.IP{resolved}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	s.Close()
+	// a record written partially and an invalid one
+	fname := segmentFiles(t, dir)[0]
+	file, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("invalid\n")
+	file.WriteString(record{ts: ts, client: "10.0.0.1", resolved: []string{"192.0.2.2"}, name: "b.example.com"}.String()[:20])
+	file.Close()
+
+	logger := &warnLogger{}
+	s, err = New(dir, time.Hour, SegmentDuration(time.Minute), FilterBits(1024), SetLogger(logger))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	defer s.Close()
+	if logger.count() != 1 {
+		t.Errorf("warnings = %v, want the invalid record", logger.warns)
+	}
+	if ok, _ := s.Get(client, resolved, "a.example.com"); !ok {
+		t.Errorf("record before the incomplete one not found")
+	}
+	// the incomplete record is removed before appending
+	if err := s.Set(ts.Add(time.Second), client, "c.example.com", []net.IP{resolved}); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	for _, name := range []string{"a.example.com", "c.example.com"} {
+		if ok, _ := s.Get(client, resolved, name); !ok {
+			t.Errorf("record '%s' not found", name)
+		}
+	}
+	if st := s.Stats(); st.Names != 2 {
+		t.Errorf("Stats() names = %v, want 2", st.Names)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DumpFormat defines the format used in dumps.
+type DumpFormat int
+
+// Dump formats.
+const (
+	DumpText DumpFormat = iota
+	DumpJSON
+)
+
+// ToDumpFormat returns the dump format from a string.
+func ToDumpFormat(s string) (DumpFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "text":
+		return DumpText, nil
+	case "json", "ndjson":
+		return DumpJSON, nil
+	}
+	return DumpText, fmt.Errorf("invalid dump format '%s'", s)
+}
+
+func (f DumpFormat) String() string {
+	switch f {
+	case DumpText:
+		return "text"
+	case DumpJSON:
+		return "json"
+	}
+	return ""
+}
+
+// DumpRecord stores information of a resolved name in a dump.
+type DumpRecord struct {
+	Client    net.IP    `json:"client"`
+	Prefix    int       `json:"prefix,omitempty"`
+	Resolved  net.IP    `json:"resolved"`
+	Name      string    `json:"name"`
+	Timestamp time.Time `json:"ts"`
+	// Since is the first resolution of the period ended by Timestamp
+	Since time.Time `json:"since"`
+	Last  time.Time `json:"last"`
+	// TTL of the dns record in seconds, zero if unknown
+	TTL int `json:"ttl,omitempty"`
+	// Chain of names if it was resolved through cnames
+	Chain []string `json:"chain,omitempty"`
+	// Stats is only set in the record of the client stats, written before
+	// the records of the client
+	Stats *ClientStats `json:"stats,omitempty"`
+}
+
+// DumpFilter is used for filtering dump records.
+type DumpFilter struct {
+	Client   *net.IPNet
+	Resolved net.IP
+	Name     string
+}
+
+// Match returns true if record matches the filter. Client matches if the
+// network of the filter and the network of the client overlap, so a host
+// matches its aggregated client and a network matches its hosts.
+func (f DumpFilter) Match(r DumpRecord) bool {
+	if f.Client != nil {
+		n := r.network()
+		if n == nil || (!f.Client.Contains(n.IP) && !n.Contains(f.Client.IP)) {
+			return false
+		}
+	}
+	if f.Resolved != nil && !f.Resolved.Equal(r.Resolved) {
+		return false
+	}
+	if f.Name != "" && !strings.EqualFold(f.Name, r.Name) {
+		return false
+	}
+	return true
+}
+
+// network returns the network of the client, a host if it's not
+// aggregated.
+func (r DumpRecord) network() *net.IPNet {
+	ip, bits := r.Client.To4(), net.IPv4len*8
+	if ip == nil {
+		ip, bits = r.Client.To16(), net.IPv6len*8
+	}
+	if ip == nil {
+		return nil
+	}
+	prefix := r.Prefix
+	if prefix <= 0 || prefix > bits {
+		prefix = bits
+	}
+	mask := net.CIDRMask(prefix, bits)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// DumpRecords writes cache content to writer as newline delimited json,
+// one record per client, resolved ip and name. Each client is preceded by
+// a record with its stats.
+func (o *Cache) DumpRecords(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	now := time.Now()
+	for _, e := range o.clientList() {
+		client := e.client
+		clientIP := client.network.IP
+		prefix := 0
+		if aggregated(client.network) {
+			prefix, _ = client.network.Mask.Size()
+		}
+		st := client.stats(now)
+		err := enc.Encode(DumpRecord{Client: clientIP, Prefix: prefix, Stats: &st})
+		if err != nil {
+			return err
+		}
+		client.mu.RLock()
+		for _, b := range client.blocks {
+			b.mu.RLock()
+			for k, i := range b.index {
+				node := b.nodes[i]
+				if node.name == "" {
+					continue
+				}
+				resolvedIP := k.IP()
+				err := enc.Encode(DumpRecord{
+					Client:    clientIP,
+					Prefix:    prefix,
+					Resolved:  resolvedIP,
+					Name:      node.item.name,
+					Timestamp: node.item.ts,
+					Since:     node.item.since,
+					Last:      node.last,
+					TTL:       int(node.item.ttl / time.Second),
+					Chain:     node.item.chain,
+				})
+				for j := 0; err == nil && j < len(node.others); j++ {
+					err = enc.Encode(DumpRecord{
+						Client:    clientIP,
+						Prefix:    prefix,
+						Resolved:  resolvedIP,
+						Name:      node.others[j].name,
+						Timestamp: node.others[j].ts,
+						Since:     node.others[j].since,
+						Last:      node.last,
+						TTL:       int(node.others[j].ttl / time.Second),
+						Chain:     node.others[j].chain,
+					})
+				}
+				if err != nil {
+					b.mu.RUnlock()
+					client.mu.RUnlock()
+					return err
+				}
+			}
+			b.mu.RUnlock()
+		}
+		client.mu.RUnlock()
+	}
+	return w.Flush()
+}
+
+// ReadDump reads records from a json dump and calls fn for each record
+// matching the filter. Records of client stats are skipped.
+func ReadDump(in io.Reader, filter DumpFilter, fn func(DumpRecord) error) error {
+	dec := json.NewDecoder(bufio.NewReader(in))
+	for {
+		var r DumpRecord
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading dump: %v", err)
+		}
+		if r.Stats == nil && filter.Match(r) {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDumpFilterMatch(t *testing.T) {
+	cidr := func(s string) *net.IPNet {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	host := DumpRecord{Client: net.ParseIP("10.0.1.5"), Resolved: net.ParseIP("192.0.2.1"), Name: "www.example.com"}
+	aggregated := DumpRecord{Client: net.ParseIP("10.0.1.0"), Prefix: 24, Resolved: net.ParseIP("192.0.2.1"), Name: "www.example.com"}
+	v6 := DumpRecord{Client: net.ParseIP("2001:db8:1::"), Prefix: 48, Resolved: net.ParseIP("2001:db8::1"), Name: "www.example.com"}
+	tests := []struct {
+		name   string
+		filter DumpFilter
+		record DumpRecord
+		want   bool
+	}{
+		{"empty filter", DumpFilter{}, host, true},
+		{"host in network", DumpFilter{Client: cidr("10.0.0.0/16")}, host, true},
+		{"host equal", DumpFilter{Client: cidr("10.0.1.5/32")}, host, true},
+		{"host other", DumpFilter{Client: cidr("10.0.1.6/32")}, host, false},
+		{"host in aggregated", DumpFilter{Client: cidr("10.0.1.5/32")}, aggregated, true},
+		{"aggregated in network", DumpFilter{Client: cidr("10.0.0.0/8")}, aggregated, true},
+		{"aggregated equal", DumpFilter{Client: cidr("10.0.1.0/24")}, aggregated, true},
+		{"aggregated other", DumpFilter{Client: cidr("10.0.2.0/24")}, aggregated, false},
+		{"aggregated overlaps", DumpFilter{Client: cidr("10.0.1.128/25")}, aggregated, true},
+		{"ipv6 host in aggregated", DumpFilter{Client: cidr("2001:db8:1:2::1/128")}, v6, true},
+		{"ipv6 other", DumpFilter{Client: cidr("2001:db8:2::/48")}, v6, false},
+		{"ipv4 filter and ipv6 client", DumpFilter{Client: cidr("10.0.0.0/8")}, v6, false},
+		{"resolved", DumpFilter{Resolved: net.ParseIP("192.0.2.1")}, host, true},
+		{"resolved other", DumpFilter{Resolved: net.ParseIP("192.0.2.2")}, host, false},
+		{"name case", DumpFilter{Name: "WWW.example.com"}, host, true},
+		{"name other", DumpFilter{Name: "example.com"}, host, false},
+		{"client without ip", DumpFilter{Client: cidr("10.0.0.0/8")}, DumpRecord{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.record); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// indexEntrySize is an estimation of the memory used by an index entry
+const indexEntrySize = 64
+
+// evictRatio is the ratio of MaxClients evicted when limit is reached,
+// eviction in batches avoids sorting clients on each new client
+const evictRatio = 100
+
+// blockMemory returns the approximate memory used by a resolv block. Names
+// stored in nodes are not included.
+func (l Limits) blockMemory() int64 {
+	return int64(l.BlockSize) * (int64(unsafe.Sizeof(node{})) + indexEntrySize)
+}
+
+// Evicted returns the number of client blocks evicted.
+func (o *Cache) Evicted() uint64 {
+	return atomic.LoadUint64(&o.evicted)
+}
+
+// Memory returns the approximate memory used by the cache blocks.
+func (o *Cache) Memory() int64 {
+	return atomic.LoadInt64(&o.nblocks) * o.limits.blockMemory()
+}
+
+func (o *Cache) overMemory() bool {
+	if o.limits.MaxMemory <= 0 {
+		return false
+	}
+	return o.Memory() > int64(o.limits.MaxMemory)*1024*1024
+}
+
+// evictMemory removes least recently updated clients until memory used is
+// under the limit.
+func (o *Cache) evictMemory() {
+	o.evictMu.Lock()
+	defer o.evictMu.Unlock()
+	if !o.overMemory() {
+		return
+	}
+	removed := make(map[ipKey]struct{})
+	for _, e := range o.lruClients(o.ClientCount()) {
+		if o.evictClient(e) {
+			removed[e.key] = struct{}{}
+		}
+		if !o.overMemory() {
+			break
+		}
+	}
+	o.unindex(removed)
+}
+
+// evictClients removes least recently updated clients when MaxClients is
+// exceeded.
+func (o *Cache) evictClients() {
+	if o.limits.MaxClients <= 0 || o.ClientCount() <= o.limits.MaxClients {
+		return
+	}
+	o.evictMu.Lock()
+	defer o.evictMu.Unlock()
+	count := o.ClientCount() - o.limits.MaxClients
+	if count <= 0 {
+		return
+	}
+	if batch := o.limits.MaxClients / evictRatio; count < batch {
+		count = batch
+	}
+	removed := make(map[ipKey]struct{}, count)
+	for _, e := range o.lruClients(count) {
+		if o.evictClient(e) {
+			removed[e.key] = struct{}{}
+		}
+	}
+	o.unindex(removed)
+}
+
+// lruClients returns the n least recently updated clients.
+func (o *Cache) lruClients(n int) []clientEntry {
+	list := o.clientList()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].client.lastUpdate() < list[j].client.lastUpdate()
+	})
+	if n > len(list) {
+		n = len(list)
+	}
+	return list[:n]
+}
+
+// evictClient removes client from the cache. It returns false if the
+// client was already removed.
+func (o *Cache) evictClient(e clientEntry) bool {
+	s := o.shard(e.key)
+	s.mu.Lock()
+	c, ok := s.clients[e.key]
+	if ok && c == e.client {
+		delete(s.clients, e.key)
+	}
+	s.mu.Unlock()
+	if !ok || c != e.client {
+		return false
+	}
+	c.remove()
+	atomic.AddInt64(&o.nclients, -1)
+	atomic.AddUint64(&o.evicted, 1)
+	return true
+}
+
+// unindex removes the clients from the index.
+func (o *Cache) unindex(clients map[ipKey]struct{}) {
+	if o.index != nil && len(clients) > 0 {
+		o.index.remove(clients)
+	}
+}
+
+// remove marks the client as evicted and discounts its blocks, inserts in
+// progress after it don't change the count of blocks.
+func (c *clientBlock) remove() {
+	c.mu.Lock()
+	if !c.evicted {
+		c.evicted = true
+		atomic.AddInt64(&c.cache.nblocks, -int64(len(c.blocks)))
+	}
+	c.mu.Unlock()
+}
+
+// lastUpdate returns last update of the client in unix nanoseconds.
+func (c *clientBlock) lastUpdate() int64 {
+	return atomic.LoadInt64(&c.updated)
+}
+
+func (c *clientBlock) touch(ts time.Time) {
+	nts := ts.UnixNano()
+	if nts > atomic.LoadInt64(&c.updated) {
+		atomic.StoreInt64(&c.updated, nts)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blocksInUse returns the blocks of the clients stored in the cache.
+func blocksInUse(c *Cache) int64 {
+	var n int64
+	for _, e := range c.clientList() {
+		e.client.mu.RLock()
+		n += int64(len(e.client.blocks))
+		e.client.mu.RUnlock()
+	}
+	return n
+}
+
+func checkAccounting(t *testing.T, c *Cache) {
+	t.Helper()
+	if got, want := c.ClientCount(), len(c.clientList()); got != want {
+		t.Errorf("ClientCount() = %v, want %v", got, want)
+	}
+	if got, want := c.Memory(), blocksInUse(c)*c.limits.blockMemory(); got != want {
+		t.Errorf("Memory() = %v, want %v", got, want)
+	}
+}
+
+func TestEvictMaxClients(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 16
+	limits.MaxClients = 100
+	c := NewCache(time.Hour, limits, ClientIndex(true))
+	resolved := net.ParseIP("192.0.2.1")
+	clients := benchIPs(10, 250)
+	now := time.Now().Add(-time.Duration(len(clients)) * time.Millisecond)
+	for i, client := range clients {
+		if err := c.Set(now.Add(time.Duration(i)*time.Millisecond), client, "www.example.com", []net.IP{resolved}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if c.ClientCount() > limits.MaxClients {
+		t.Errorf("ClientCount() = %v, exceeds %v", c.ClientCount(), limits.MaxClients)
+	}
+	if c.Evicted() != uint64(len(clients)-c.ClientCount()) {
+		t.Errorf("Evicted() = %v, want %v", c.Evicted(), len(clients)-c.ClientCount())
+	}
+	checkAccounting(t, c)
+	// the newest client must be stored and the oldest evicted
+	if ok, _ := c.Get(clients[len(clients)-1], resolved, "www.example.com"); !ok {
+		t.Errorf("newest client not found")
+	}
+	if ok, _ := c.Get(clients[0], resolved, "www.example.com"); ok {
+		t.Errorf("oldest client not evicted")
+	}
+	// index must only return the clients stored
+	for _, query := range []struct {
+		resolved net.IP
+		name     string
+	}{{resolved, ""}, {nil, "www.example.com"}} {
+		list, err := c.Clients(query.resolved, query.name)
+		if err != nil {
+			t.Fatalf("Clients() = %v", err)
+		}
+		if len(list) != c.ClientCount() {
+			t.Errorf("Clients(%v,%q) = %v clients, want %v", query.resolved, query.name, len(list), c.ClientCount())
+		}
+		for _, ci := range list {
+			if _, ok := c.findClientBlock(c.clientKey(ci.Client)); !ok {
+				t.Errorf("Clients(%v,%q) returns evicted client %v", query.resolved, query.name, ci.Client)
+			}
+		}
+	}
+}
+
+func TestEvictMaxMemory(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 16
+	limits.MaxMemory = 1
+	c := NewCache(time.Hour, limits, ClientIndex(true))
+	max := int64(limits.MaxMemory) * 1024 * 1024
+	// each client uses several blocks
+	resolved := benchIPs(192, 40)
+	clients := benchIPs(10, 1000)
+	now := time.Now().Add(-time.Duration(len(clients)) * time.Millisecond)
+	for i, client := range clients {
+		ts := now.Add(time.Duration(i) * time.Millisecond)
+		if err := c.Set(ts, client, "www.example.com", resolved); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+		if c.Memory() > max {
+			t.Fatalf("Memory() = %v, exceeds %v", c.Memory(), max)
+		}
+	}
+	if c.Evicted() == 0 {
+		t.Fatalf("no clients evicted")
+	}
+	checkAccounting(t, c)
+	list, err := c.Clients(resolved[0], "")
+	if err != nil {
+		t.Fatalf("Clients() = %v", err)
+	}
+	if len(list) != c.ClientCount() {
+		t.Errorf("Clients() = %v clients, want %v", len(list), c.ClientCount())
+	}
+}
+
+func TestEvictConcurrentAccounting(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 4
+	limits.MaxClients = 50
+	c := NewCache(time.Hour, limits)
+	clients := benchIPs(10, 500)
+	resolved := benchIPs(192, 32)
+	now := time.Now().Add(-time.Duration(len(clients)*4) * time.Millisecond)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(clients)*4; i += 8 {
+				client := clients[i%len(clients)]
+				ts := now.Add(time.Duration(i) * time.Millisecond)
+				c.Set(ts, client, "www.example.com", resolved[i%len(resolved):i%len(resolved)+1])
+			}
+		}(w)
+	}
+	wg.Wait()
+	c.Clean()
+	checkAccounting(t, c)
+	c.FlushNet(&net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(24, 32)})
+	checkAccounting(t, c)
+	c.Flush()
+	checkAccounting(t, c)
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package jsoncodec implements a grpc codec that encodes messages in json
+// and the helpers used for describing the services that use it.
+//
+// Services of the resolvcache daemon that are not defined in the luids api
+// use plain go structs as messages. Clients must use CallOption in their
+// calls, servers only need to import this package.
+package jsoncodec
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name of the codec, used as grpc content-subtype. It's specific to the
+// resolvcache services, so it doesn't replace other json codecs.
+const Name = "resolvcache-json"
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return Name
+}
+
+// CallOption returns the grpc call option that selects the codec.
+func CallOption() grpc.CallOption {
+	return grpc.CallContentSubtype(Name)
+}
+
+// MethodName returns the full name of the method of the service.
+func MethodName(service, method string) string {
+	return "/" + service + "/" + method
+}
+
+// UnaryMethod returns the description of an unary method of the service.
+// Request returns a new request message and call invokes the method of the
+// server with it.
+func UnaryMethod(service, method string, request func() interface{},
+	call func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	handler := func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := request()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv, ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: MethodName(service, method),
+		}
+		return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv, ctx, req)
+		})
+	}
+	return grpc.MethodDesc{MethodName: method, Handler: handler}
+}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvadmin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Client provides a grpc client.
+type Client struct {
+	opts   clientOpts
+	logger yalogi.Logger
+	//grpc connection
+	conn *grpc.ClientConn
+	//control
+	closed bool
+}
+
+// ClientOption encapsules options for client.
+type ClientOption func(*clientOpts)
+
+type clientOpts struct {
+	logger    yalogi.Logger
+	closeConn bool
+}
+
+var defaultClientOpts = clientOpts{
+	logger:    yalogi.LogNull,
+	closeConn: true,
+}
+
+// CloseConnection option closes grpc connection on shutdown.
+func CloseConnection(b bool) ClientOption {
+	return func(o *clientOpts) {
+		o.closeConn = b
+	}
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) ClientOption {
+	return func(o *clientOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewClient returns a new Client.
+func NewClient(conn *grpc.ClientConn, opt ...ClientOption) *Client {
+	opts := defaultClientOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Client{
+		opts:   opts,
+		logger: opts.logger,
+		conn:   conn,
+	}
+}
+
+// Flush implements Admin interface.
+func (c *Client) Flush(ctx context.Context, network *net.IPNet) (int, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvadmin: flush(%v): client is closed", network)
+		return 0, dnsutil.ErrUnavailable
+	}
+	req := &FlushRequest{}
+	if network != nil {
+		req.CIDR = network.String()
+	}
+	resp := &FlushResponse{}
+	err := c.conn.Invoke(ctx, methodName("Flush"), req, resp, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvadmin: flush(%v): %v", network, err)
+		return 0, c.mapError(err)
+	}
+	return resp.Clients, nil
+}
+
+// Clean implements Admin interface.
+func (c *Client) Clean(ctx context.Context) error {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvadmin: clean(): client is closed")
+		return dnsutil.ErrUnavailable
+	}
+	err := c.conn.Invoke(ctx, methodName("Clean"), &CleanRequest{}, &CleanResponse{}, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvadmin: clean(): %v", err)
+		return c.mapError(err)
+	}
+	return nil
+}
+
+// Dump implements Admin interface. The file is written by the server.
+func (c *Client) Dump(ctx context.Context, filename string, format resolvcache.DumpFormat) error {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvadmin: dump(%s,%v): client is closed", filename, format)
+		return dnsutil.ErrUnavailable
+	}
+	req := &DumpRequest{Path: filename, Format: format.String()}
+	err := c.conn.Invoke(ctx, methodName("Dump"), req, &DumpResponse{}, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvadmin: dump(%s,%v): %v", filename, format, err)
+		return c.mapError(err)
+	}
+	return nil
+}
+
+// Stats implements Admin interface.
+func (c *Client) Stats(ctx context.Context) (resolvcache.Stats, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvadmin: stats(): client is closed")
+		return resolvcache.Stats{}, dnsutil.ErrUnavailable
+	}
+	resp := &StatsResponse{}
+	err := c.conn.Invoke(ctx, methodName("Stats"), &StatsRequest{}, resp, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvadmin: stats(): %v", err)
+		return resolvcache.Stats{}, c.mapError(err)
+	}
+	st := resolvcache.Stats{
+		Expires:   time.Duration(resp.ExpiresSecs) * time.Second,
+		Flushed:   time.Unix(resp.FlushedTs, 0),
+		Clients:   resp.Clients,
+		Blocks:    resp.Blocks,
+		Nodes:     resp.Nodes,
+		Names:     resp.Names,
+		NamesNode: resp.NamesNode,
+		Memory:    resp.Memory,
+		Evicted:   resp.Evicted,
+		// overflows
+		EvictedBlocks: resp.EvictedBlocks,
+		EvictedNames:  resp.EvictedNames,
+		// negative answers
+		NXDomain: resp.NXDomain,
+		NoData:   resp.NoData,
+	}
+	if resp.CleanedTs > 0 {
+		st.Cleaned = time.Unix(resp.CleanedTs, 0)
+	}
+	for _, co := range resp.Overflows {
+		_, client, err := net.ParseCIDR(co.Client)
+		if err != nil {
+			continue
+		}
+		st.Overflows = append(st.Overflows, resolvcache.ClientOverflow{
+			Client: client,
+			Blocks: co.Blocks,
+			Names:  co.Names,
+		})
+	}
+	return st, nil
+}
+
+// SetExpires implements Admin interface.
+func (c *Client) SetExpires(ctx context.Context, d time.Duration) error {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvadmin: setexpires(%v): client is closed", d)
+		return dnsutil.ErrUnavailable
+	}
+	req := &SetExpiresRequest{Secs: int(d / time.Second)}
+	err := c.conn.Invoke(ctx, methodName("SetExpires"), req, &SetExpiresResponse{}, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvadmin: setexpires(%v): %v", d, err)
+		return c.mapError(err)
+	}
+	return nil
+}
+
+// mapping errors
+func (c *Client) mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return dnsutil.ErrCanceledRequest
+	case codes.InvalidArgument:
+		return dnsutil.ErrBadRequest
+	case codes.Unimplemented:
+		return dnsutil.ErrNotSupported
+	case codes.Internal:
+		return dnsutil.ErrInternal
+	case codes.Unavailable:
+		return dnsutil.ErrUnavailable
+	default:
+		return dnsutil.ErrUnavailable
+	}
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	c.closed = true
+	if c.opts.closeConn {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Ping checks connectivity with the api.
+func (c *Client) Ping() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	st := c.conn.GetState()
+	switch st {
+	case connectivity.TransientFailure:
+		return fmt.Errorf("connection state: %v", st)
+	case connectivity.Shutdown:
+		return fmt.Errorf("connection state: %v", st)
+	}
+	return nil
+}
+
+// API returns API service name implemented.
+func (c *Client) API() string {
+	return ServiceName()
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvadmin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/jsoncodec"
+)
+
+// adminServer is the server api, messages are encoded with jsoncodec.
+type adminServer interface {
+	Flush(context.Context, *FlushRequest) (*FlushResponse, error)
+	Clean(context.Context, *CleanRequest) (*CleanResponse, error)
+	Dump(context.Context, *DumpRequest) (*DumpResponse, error)
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	SetExpires(context.Context, *SetExpiresRequest) (*SetExpiresResponse, error)
+}
+
+func methodName(method string) string {
+	return jsoncodec.MethodName(ServiceName(), method)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName(),
+	HandlerType: (*adminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(ServiceName(), "Flush", func() interface{} { return new(FlushRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(adminServer).Flush(ctx, req.(*FlushRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Clean", func() interface{} { return new(CleanRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(adminServer).Clean(ctx, req.(*CleanRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Dump", func() interface{} { return new(DumpRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(adminServer).Dump(ctx, req.(*DumpRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Stats", func() interface{} { return new(StatsRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(adminServer).Stats(ctx, req.(*StatsRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "SetExpires", func() interface{} { return new(SetExpiresRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(adminServer).SetExpires(ctx, req.(*SetExpiresRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "resolvadmin",
+}
+
+// callOpts are the options used by the client in all calls.
+var callOpts = []grpc.CallOption{jsoncodec.CallOption()}
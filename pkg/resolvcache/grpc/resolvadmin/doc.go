@@ -0,0 +1,21 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package resolvadmin implements a grpc client and a ready to use service
+// component for the administration api of the resolvcache daemon. The api
+// is not part of the luids api, its messages are encoded with jsoncodec.
+// The service can also be exported as http with json messages.
+package resolvadmin
+
+import "fmt"
+
+// Constants for api description.
+const (
+	APIName    = "luids.resolvcache"
+	APIVersion = "v1"
+	APIService = "ResolvAdmin"
+)
+
+// ServiceName returns service name.
+func ServiceName() string {
+	return fmt.Sprintf("%s.%s.%s", APIName, APIVersion, APIService)
+}
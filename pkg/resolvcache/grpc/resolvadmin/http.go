@@ -0,0 +1,119 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvadmin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxHTTPBody limits the size of the http request bodies.
+const maxHTTPBody = 64 * 1024
+
+// NewHandler returns an http handler that exports the service using json
+// messages. Methods are available as POST requests in paths /flush, /clean,
+// /dump and /expires, and as GET request in path /stats.
+func NewHandler(s *Service) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flush", httpMethod(http.MethodPost, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		in := &FlushRequest{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return s.Flush(ctx, in)
+	}))
+	mux.HandleFunc("/clean", httpMethod(http.MethodPost, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		in := &CleanRequest{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return s.Clean(ctx, in)
+	}))
+	mux.HandleFunc("/dump", httpMethod(http.MethodPost, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		in := &DumpRequest{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return s.Dump(ctx, in)
+	}))
+	mux.HandleFunc("/stats", httpMethod(http.MethodGet, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		return s.Stats(ctx, &StatsRequest{})
+	}))
+	mux.HandleFunc("/expires", httpMethod(http.MethodPost, func(ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+		in := &SetExpiresRequest{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		return s.SetExpires(ctx, in)
+	}))
+	return mux
+}
+
+type httpHandlerFn func(ctx context.Context, dec func(interface{}) error) (interface{}, error)
+
+// httpMethod adapts a service method to an http handler.
+func httpMethod(method string, fn httpHandlerFn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			httpError(w, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		// peer is used by the service in logs
+		ctx := r.Context()
+		if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+		}
+		dec := func(v interface{}) error {
+			err := json.NewDecoder(io.LimitReader(r.Body, maxHTTPBody)).Decode(v)
+			if err == io.EOF {
+				// empty bodies are allowed
+				return nil
+			}
+			return err
+		}
+		resp, err := fn(ctx, dec)
+		if err != nil {
+			st, ok := status.FromError(err)
+			if !ok {
+				httpError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			httpError(w, httpStatus(st.Code()), st.Message())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: msg})
+}
+
+// httpStatus maps grpc codes to http status
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Canceled:
+		return http.StatusRequestTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvadmin
+
+// FlushRequest is the message for Flush. If CIDR is empty all clients are
+// flushed.
+type FlushRequest struct {
+	CIDR string `json:"cidr,omitempty"`
+}
+
+// FlushResponse is the response message for Flush.
+type FlushResponse struct {
+	Clients int `json:"clients"`
+}
+
+// CleanRequest is the message for Clean.
+type CleanRequest struct{}
+
+// CleanResponse is the response message for Clean.
+type CleanResponse struct{}
+
+// DumpRequest is the message for Dump. Format is "text" or "json", the
+// default is "text".
+type DumpRequest struct {
+	Path   string `json:"path"`
+	Format string `json:"format,omitempty"`
+}
+
+// DumpResponse is the response message for Dump.
+type DumpResponse struct{}
+
+// StatsRequest is the message for Stats.
+type StatsRequest struct{}
+
+// StatsResponse is the response message for Stats. Timestamps are in unix
+// seconds.
+type StatsResponse struct {
+	ExpiresSecs int    `json:"expires_secs"`
+	FlushedTs   int64  `json:"flushed_ts"`
+	CleanedTs   int64  `json:"cleaned_ts,omitempty"`
+	Clients     int    `json:"clients"`
+	Blocks      int    `json:"blocks"`
+	Nodes       int    `json:"nodes"`
+	Names       int    `json:"names"`
+	NamesNode   []int  `json:"names_node"`
+	Memory      int64  `json:"memory"`
+	Evicted     uint64 `json:"evicted"`
+	// evictions by the overflow policy
+	EvictedBlocks uint64           `json:"evicted_blocks"`
+	EvictedNames  uint64           `json:"evicted_names"`
+	Overflows     []ClientOverflow `json:"overflows,omitempty"`
+	// negative answers collected
+	NXDomain uint64 `json:"nxdomain"`
+	NoData   uint64 `json:"nodata"`
+}
+
+// ClientOverflow stores the evictions of a client.
+type ClientOverflow struct {
+	Client string `json:"client"`
+	Blocks uint64 `json:"blocks"`
+	Names  uint64 `json:"names"`
+}
+
+// SetExpiresRequest is the message for SetExpires.
+type SetExpiresRequest struct {
+	Secs int `json:"secs"`
+}
+
+// SetExpiresResponse is the response message for SetExpires.
+type SetExpiresResponse struct{}
@@ -0,0 +1,188 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvadmin
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Admin is the interface for the administration of a resolv cache.
+type Admin interface {
+	Flush(ctx context.Context, network *net.IPNet) (int, error)
+	Clean(ctx context.Context) error
+	Dump(ctx context.Context, filename string, format resolvcache.DumpFormat) error
+	Stats(ctx context.Context) (resolvcache.Stats, error)
+	SetExpires(ctx context.Context, d time.Duration) error
+}
+
+// Service implements a grpc service wrapper.
+type Service struct {
+	logger yalogi.Logger
+	admin  Admin
+}
+
+// ServiceOption is used for service configuration
+type ServiceOption func(*serviceOpts)
+
+type serviceOpts struct {
+	logger yalogi.Logger
+}
+
+var defaultServiceOpts = serviceOpts{logger: yalogi.LogNull}
+
+// SetServiceLogger option allows set a custom logger.
+func SetServiceLogger(l yalogi.Logger) ServiceOption {
+	return func(o *serviceOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewService returns a new Service
+func NewService(a Admin, opt ...ServiceOption) *Service {
+	opts := defaultServiceOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Service{admin: a, logger: opts.logger}
+}
+
+// RegisterServer registers a service in the grpc server.
+func RegisterServer(server *grpc.Server, service *Service) {
+	server.RegisterService(&serviceDesc, service)
+}
+
+// Flush implements grpc api.
+func (s *Service) Flush(ctx context.Context, in *FlushRequest) (*FlushResponse, error) {
+	var network *net.IPNet
+	if in.CIDR != "" {
+		var err error
+		_, network, err = net.ParseCIDR(in.CIDR)
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] flush(%s): %v", getPeerAddr(ctx), in.CIDR, err)
+			return nil, s.mapError(dnsutil.ErrBadRequest)
+		}
+	}
+	count, err := s.admin.Flush(ctx, network)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] flush(%s): %v", getPeerAddr(ctx), in.CIDR, err)
+		return nil, s.mapError(err)
+	}
+	s.logger.Infof("service.dnsutil.resolvadmin: [peer=%s] flush(%s): %v clients", getPeerAddr(ctx), in.CIDR, count)
+	return &FlushResponse{Clients: count}, nil
+}
+
+// Clean implements grpc api.
+func (s *Service) Clean(ctx context.Context, in *CleanRequest) (*CleanResponse, error) {
+	err := s.admin.Clean(ctx)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] clean(): %v", getPeerAddr(ctx), err)
+		return nil, s.mapError(err)
+	}
+	s.logger.Infof("service.dnsutil.resolvadmin: [peer=%s] clean()", getPeerAddr(ctx))
+	return &CleanResponse{}, nil
+}
+
+// Dump implements grpc api.
+func (s *Service) Dump(ctx context.Context, in *DumpRequest) (*DumpResponse, error) {
+	format, err := resolvcache.ToDumpFormat(in.Format)
+	if err != nil || in.Path == "" {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] dump(%s,%s): bad request", getPeerAddr(ctx), in.Path, in.Format)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	err = s.admin.Dump(ctx, in.Path, format)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] dump(%s,%v): %v", getPeerAddr(ctx), in.Path, format, err)
+		return nil, s.mapError(err)
+	}
+	s.logger.Infof("service.dnsutil.resolvadmin: [peer=%s] dump(%s,%v)", getPeerAddr(ctx), in.Path, format)
+	return &DumpResponse{}, nil
+}
+
+// Stats implements grpc api.
+func (s *Service) Stats(ctx context.Context, in *StatsRequest) (*StatsResponse, error) {
+	st, err := s.admin.Stats(ctx)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] stats(): %v", getPeerAddr(ctx), err)
+		return nil, s.mapError(err)
+	}
+	response := &StatsResponse{
+		ExpiresSecs: int(st.Expires / time.Second),
+		FlushedTs:   st.Flushed.Unix(),
+		Clients:     st.Clients,
+		Blocks:      st.Blocks,
+		Nodes:       st.Nodes,
+		Names:       st.Names,
+		NamesNode:   st.NamesNode,
+		Memory:      st.Memory,
+		Evicted:     st.Evicted,
+		// overflows
+		EvictedBlocks: st.EvictedBlocks,
+		EvictedNames:  st.EvictedNames,
+		// negative answers
+		NXDomain: st.NXDomain,
+		NoData:   st.NoData,
+	}
+	if !st.Cleaned.IsZero() {
+		response.CleanedTs = st.Cleaned.Unix()
+	}
+	for _, co := range st.Overflows {
+		response.Overflows = append(response.Overflows, ClientOverflow{
+			Client: co.Client.String(),
+			Blocks: co.Blocks,
+			Names:  co.Names,
+		})
+	}
+	return response, nil
+}
+
+// SetExpires implements grpc api.
+func (s *Service) SetExpires(ctx context.Context, in *SetExpiresRequest) (*SetExpiresResponse, error) {
+	if in.Secs <= 0 {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] setexpires(%v): secs must be greater than zero", getPeerAddr(ctx), in.Secs)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	err := s.admin.SetExpires(ctx, time.Duration(in.Secs)*time.Second)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvadmin: [peer=%s] setexpires(%v): %v", getPeerAddr(ctx), in.Secs, err)
+		return nil, s.mapError(err)
+	}
+	s.logger.Infof("service.dnsutil.resolvadmin: [peer=%s] setexpires(%v)", getPeerAddr(ctx), in.Secs)
+	return &SetExpiresResponse{}, nil
+}
+
+// mapping admin errors
+func (s *Service) mapError(err error) error {
+	switch err {
+	case dnsutil.ErrCanceledRequest:
+		return status.Error(codes.Canceled, err.Error())
+	case dnsutil.ErrBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case dnsutil.ErrNotSupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	case dnsutil.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, dnsutil.ErrInternal.Error())
+	}
+}
+
+func getPeerAddr(ctx context.Context) (paddr string) {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		paddr = p.Addr.String()
+	}
+	return
+}
@@ -0,0 +1,345 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Client provides a grpc client.
+type Client struct {
+	opts   clientOpts
+	logger yalogi.Logger
+	//grpc connection
+	conn *grpc.ClientConn
+	//control
+	closed bool
+}
+
+// ClientOption encapsules options for client.
+type ClientOption func(*clientOpts)
+
+type clientOpts struct {
+	logger    yalogi.Logger
+	closeConn bool
+}
+
+var defaultClientOpts = clientOpts{
+	logger:    yalogi.LogNull,
+	closeConn: true,
+}
+
+// CloseConnection option closes grpc connection on shutdown.
+func CloseConnection(b bool) ClientOption {
+	return func(o *clientOpts) {
+		o.closeConn = b
+	}
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) ClientOption {
+	return func(o *clientOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewClient returns a new Client.
+func NewClient(conn *grpc.ClientConn, opt ...ClientOption) *Client {
+	opts := defaultClientOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Client{
+		opts:   opts,
+		logger: opts.logger,
+		conn:   conn,
+	}
+}
+
+// Lookup implements Querier interface.
+func (c *Client) Lookup(ctx context.Context, client, resolved net.IP) ([]resolvcache.NameInfo, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: lookup(%v,%v): client is closed", client, resolved)
+		return nil, dnsutil.ErrUnavailable
+	}
+	req := &LookupRequest{ClientIP: client.String(), ResolvedIP: resolved.String()}
+	response := &LookupResponse{}
+	err := c.conn.Invoke(ctx, methodName("Lookup"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: lookup(%v,%v): %v", client, resolved, err)
+		return nil, c.mapError(err)
+	}
+	names := make([]resolvcache.NameInfo, 0, len(response.Names))
+	for _, n := range response.Names {
+		names = append(names, resolvcache.NameInfo{Name: n.Name, Last: n.LastTs, Chain: n.Chain})
+	}
+	return names, nil
+}
+
+// Clients implements Querier interface.
+func (c *Client) Clients(ctx context.Context, resolved net.IP, name string) ([]resolvcache.ClientInfo, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: clients(%v,%s): client is closed", resolved, name)
+		return nil, dnsutil.ErrUnavailable
+	}
+	req := &ClientsRequest{Name: name}
+	if resolved != nil {
+		req.ResolvedIP = resolved.String()
+	}
+	response := &ClientsResponse{}
+	err := c.conn.Invoke(ctx, methodName("Clients"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: clients(%v,%s): %v", resolved, name, err)
+		return nil, c.mapError(err)
+	}
+	clients := make([]resolvcache.ClientInfo, 0, len(response.Clients))
+	for _, r := range response.Clients {
+		clients = append(clients, resolvcache.ClientInfo{Client: net.ParseIP(r.ClientIP), Last: r.LastTs})
+	}
+	return clients, nil
+}
+
+// Match implements Querier interface.
+func (c *Client) Match(ctx context.Context, client, resolved net.IP, name string, mode resolvcache.MatchMode, at time.Time) (resolvcache.Match, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: match(%v,%v,%s,%v,%v): client is closed", client, resolved, name, mode, at)
+		return resolvcache.Match{}, dnsutil.ErrUnavailable
+	}
+	req := &MatchRequest{ClientIP: client.String(), ResolvedIP: resolved.String(), Name: name, AtTs: at}
+	if mode != resolvcache.MatchExact {
+		req.Mode = mode.String()
+	}
+	response := &MatchResponse{}
+	err := c.conn.Invoke(ctx, methodName("Match"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: match(%v,%v,%s,%v,%v): %v", client, resolved, name, mode, at, err)
+		return resolvcache.Match{}, c.mapError(err)
+	}
+	return resolvcache.Match{
+		Result: response.Result,
+		Since:  response.SinceTs,
+		Last:   response.LastTs,
+		Store:  response.StoreTs,
+		TTL:    time.Duration(response.TTL) * time.Second,
+		InTTL:  response.InTTL,
+		Name:   response.Name,
+		Chain:  response.Chain,
+	}, nil
+}
+
+// CheckMany implements Querier interface. Checks are sent in a batch, the
+// request fails if any check is invalid.
+func (c *Client) CheckMany(ctx context.Context, cs []resolvcache.Check) ([]dnsutil.CacheResponse, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: checkmany(%v): client is closed", len(cs))
+		return nil, dnsutil.ErrUnavailable
+	}
+	if len(cs) == 0 {
+		return nil, nil
+	}
+	req := &CheckManyRequest{Checks: make([]CheckRequest, 0, len(cs))}
+	for _, chk := range cs {
+		req.Checks = append(req.Checks, CheckRequest{
+			ClientIP:   chk.Client.String(),
+			ResolvedIP: chk.Resolved.String(),
+			Name:       chk.Name,
+			AtTs:       chk.At,
+		})
+	}
+	response := &CheckManyResponse{}
+	err := c.conn.Invoke(ctx, methodName("CheckMany"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: checkmany(%v): %v", len(cs), err)
+		return nil, c.mapError(err)
+	}
+	if len(response.Results) != len(cs) {
+		c.logger.Warnf("client.dnsutil.resolvquery: checkmany(%v): invalid response", len(cs))
+		return nil, dnsutil.ErrInternal
+	}
+	resps := make([]dnsutil.CacheResponse, 0, len(cs))
+	for i, r := range response.Results {
+		if r.Error != "" {
+			c.logger.Warnf("client.dnsutil.resolvquery: checkmany(%v,%v,%s): %s", cs[i].Client, cs[i].Resolved, cs[i].Name, r.Error)
+			return nil, dnsutil.ErrBadRequest
+		}
+		resps = append(resps, dnsutil.CacheResponse{Result: r.Result, Last: r.LastTs, Store: r.StoreTs})
+	}
+	return resps, nil
+}
+
+// Failures implements Querier interface.
+func (c *Client) Failures(ctx context.Context, client net.IP) (resolvcache.FailureInfo, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: failures(%v): client is closed", client)
+		return resolvcache.FailureInfo{}, dnsutil.ErrUnavailable
+	}
+	req := &FailuresRequest{ClientIP: client.String()}
+	response := &FailuresResponse{}
+	err := c.conn.Invoke(ctx, methodName("Failures"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: failures(%v): %v", client, err)
+		return resolvcache.FailureInfo{}, c.mapError(err)
+	}
+	info := resolvcache.FailureInfo{
+		NXDomain: response.NXDomain,
+		NoData:   response.NoData,
+		Recent:   make([]resolvcache.FailedName, 0, len(response.Recent)),
+	}
+	_, info.Client, _ = net.ParseCIDR(response.Client)
+	for _, f := range response.Recent {
+		negative, _ := resolvcache.ToNegative(f.Negative)
+		info.Recent = append(info.Recent, resolvcache.FailedName{Name: f.Name, Last: f.LastTs, Negative: negative})
+	}
+	return info, nil
+}
+
+// ClientStats implements Querier interface.
+func (c *Client) ClientStats(ctx context.Context, client net.IP) ([]resolvcache.ClientStats, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: clientstats(%v): client is closed", client)
+		return nil, dnsutil.ErrUnavailable
+	}
+	req := &ClientStatsRequest{}
+	if client != nil {
+		req.ClientIP = client.String()
+	}
+	response := &ClientStatsResponse{}
+	err := c.conn.Invoke(ctx, methodName("ClientStats"), req, response, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: clientstats(%v): %v", client, err)
+		return nil, c.mapError(err)
+	}
+	stats := make([]resolvcache.ClientStats, 0, len(response.Clients))
+	for _, r := range response.Clients {
+		_, network, err := net.ParseCIDR(r.Client)
+		if err != nil {
+			continue
+		}
+		stats = append(stats, resolvcache.ClientStats{
+			Client:       network,
+			First:        r.FirstTs,
+			Last:         r.LastTs,
+			Names:        r.Names,
+			Domains:      r.Domains,
+			LabelLength:  r.LabelLength,
+			LabelEntropy: r.LabelEntropy,
+			Rate:         r.Rate,
+		})
+	}
+	return stats, nil
+}
+
+// History implements Querier interface. Records are received from a
+// stream until the end of the response.
+func (c *Client) History(ctx context.Context, client net.IP, from, to time.Time) ([]resolvcache.HistoryRecord, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvquery: history(%v,%v,%v): client is closed", client, from, to)
+		return nil, dnsutil.ErrUnavailable
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.conn.NewStream(ctx, &serviceDesc.Streams[0], methodName("History"), callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: history(%v,%v,%v): %v", client, from, to, err)
+		return nil, c.mapError(err)
+	}
+	req := &HistoryRequest{ClientIP: client.String(), FromTs: from, ToTs: to}
+	if err := stream.SendMsg(req); err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: history(%v,%v,%v): %v", client, from, to, err)
+		return nil, c.mapError(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		c.logger.Warnf("client.dnsutil.resolvquery: history(%v,%v,%v): %v", client, from, to, err)
+		return nil, c.mapError(err)
+	}
+	var records []resolvcache.HistoryRecord
+	for {
+		r := &HistoryResponse{}
+		err := stream.RecvMsg(r)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			c.logger.Warnf("client.dnsutil.resolvquery: history(%v,%v,%v): %v", client, from, to, err)
+			return nil, c.mapError(err)
+		}
+		records = append(records, resolvcache.HistoryRecord{
+			Resolved: net.ParseIP(r.ResolvedIP),
+			Name:     r.Name,
+			Since:    r.SinceTs,
+			Last:     r.LastTs,
+			TTL:      time.Duration(r.TTL) * time.Second,
+			Chain:    r.Chain,
+		})
+	}
+}
+
+// mapping errors
+func (c *Client) mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return dnsutil.ErrCanceledRequest
+	case codes.InvalidArgument:
+		return dnsutil.ErrBadRequest
+	case codes.Unimplemented:
+		return dnsutil.ErrNotSupported
+	case codes.Internal:
+		return dnsutil.ErrInternal
+	case codes.Unavailable:
+		return dnsutil.ErrUnavailable
+	default:
+		return dnsutil.ErrUnavailable
+	}
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	c.closed = true
+	if c.opts.closeConn {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Ping checks connectivity with the api.
+func (c *Client) Ping() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	st := c.conn.GetState()
+	switch st {
+	case connectivity.TransientFailure:
+		return fmt.Errorf("connection state: %v", st)
+	case connectivity.Shutdown:
+		return fmt.Errorf("connection state: %v", st)
+	}
+	return nil
+}
+
+// API returns API service name implemented.
+func (c *Client) API() string {
+	return ServiceName()
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvquery
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/jsoncodec"
+)
+
+// queryServer is the server api, messages are encoded with jsoncodec.
+type queryServer interface {
+	Lookup(context.Context, *LookupRequest) (*LookupResponse, error)
+	Clients(context.Context, *ClientsRequest) (*ClientsResponse, error)
+	Match(context.Context, *MatchRequest) (*MatchResponse, error)
+	CheckMany(context.Context, *CheckManyRequest) (*CheckManyResponse, error)
+	Failures(context.Context, *FailuresRequest) (*FailuresResponse, error)
+	ClientStats(context.Context, *ClientStatsRequest) (*ClientStatsResponse, error)
+	History(*HistoryRequest, HistoryServer) error
+}
+
+// HistoryServer is the server stream of History.
+type HistoryServer interface {
+	Send(*HistoryResponse) error
+	grpc.ServerStream
+}
+
+type historyServer struct {
+	grpc.ServerStream
+}
+
+func (x *historyServer) Send(m *HistoryResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func methodName(method string) string {
+	return jsoncodec.MethodName(ServiceName(), method)
+}
+
+func historyHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(HistoryRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(queryServer).History(in, &historyServer{stream})
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName(),
+	HandlerType: (*queryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(ServiceName(), "Lookup", func() interface{} { return new(LookupRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).Lookup(ctx, req.(*LookupRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Clients", func() interface{} { return new(ClientsRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).Clients(ctx, req.(*ClientsRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Match", func() interface{} { return new(MatchRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).Match(ctx, req.(*MatchRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "CheckMany", func() interface{} { return new(CheckManyRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).CheckMany(ctx, req.(*CheckManyRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "Failures", func() interface{} { return new(FailuresRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).Failures(ctx, req.(*FailuresRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "ClientStats", func() interface{} { return new(ClientStatsRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(queryServer).ClientStats(ctx, req.(*ClientStatsRequest))
+			}),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "History",
+			Handler:       historyHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "resolvquery",
+}
+
+// callOpts are the options used by the client in all calls.
+var callOpts = []grpc.CallOption{jsoncodec.CallOption()}
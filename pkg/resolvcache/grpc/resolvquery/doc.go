@@ -0,0 +1,20 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package resolvquery implements a grpc client and a ready to use service
+// component for the query api of the resolvcache daemon. The api is not
+// part of the luids api, its messages are encoded with jsoncodec.
+package resolvquery
+
+import "fmt"
+
+// Constants for api description.
+const (
+	APIName    = "luids.resolvcache"
+	APIVersion = "v1"
+	APIService = "ResolvQuery"
+)
+
+// ServiceName returns service name.
+func ServiceName() string {
+	return fmt.Sprintf("%s.%s.%s", APIName, APIVersion, APIService)
+}
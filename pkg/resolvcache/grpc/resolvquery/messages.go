@@ -0,0 +1,160 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvquery
+
+import (
+	"time"
+)
+
+// LookupRequest is the message for Lookup.
+type LookupRequest struct {
+	ClientIP   string `json:"client_ip"`
+	ResolvedIP string `json:"resolved_ip"`
+}
+
+// LookupResponse is the response message for Lookup.
+type LookupResponse struct {
+	Names []NameInfo `json:"names,omitempty"`
+}
+
+// NameInfo stores a name and its last resolution.
+type NameInfo struct {
+	Name   string    `json:"name"`
+	LastTs time.Time `json:"last_ts"`
+	Chain  []string  `json:"chain,omitempty"`
+}
+
+// ClientsRequest is the message for Clients, resolved ip or name is
+// required.
+type ClientsRequest struct {
+	ResolvedIP string `json:"resolved_ip,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// ClientsResponse is the response message for Clients.
+type ClientsResponse struct {
+	Clients []ClientInfo `json:"clients,omitempty"`
+}
+
+// ClientInfo stores a client and its last resolution.
+type ClientInfo struct {
+	ClientIP string    `json:"client_ip"`
+	LastTs   time.Time `json:"last_ts"`
+}
+
+// MatchRequest is the message for Match, name can be empty. Mode is
+// "exact", "subdomain" or "domain", the default is "exact". AtTs is the
+// time of the check, zero is now.
+type MatchRequest struct {
+	ClientIP   string    `json:"client_ip"`
+	ResolvedIP string    `json:"resolved_ip"`
+	Name       string    `json:"name,omitempty"`
+	Mode       string    `json:"mode,omitempty"`
+	AtTs       time.Time `json:"at_ts,omitempty"`
+}
+
+// MatchResponse is the response message for Match. TTL is in seconds and
+// Name is the name stored that matched.
+type MatchResponse struct {
+	Result  bool      `json:"result"`
+	SinceTs time.Time `json:"since_ts,omitempty"`
+	LastTs  time.Time `json:"last_ts,omitempty"`
+	StoreTs time.Time `json:"store_ts"`
+	TTL     uint32    `json:"ttl,omitempty"`
+	InTTL   bool      `json:"in_ttl,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Chain   []string  `json:"chain,omitempty"`
+}
+
+// CheckManyRequest is the message for CheckMany.
+type CheckManyRequest struct {
+	Checks []CheckRequest `json:"checks"`
+}
+
+// CheckRequest is a check in a batch, name can be empty. AtTs is the time
+// of the check, zero is now.
+type CheckRequest struct {
+	ClientIP   string    `json:"client_ip"`
+	ResolvedIP string    `json:"resolved_ip"`
+	Name       string    `json:"name,omitempty"`
+	AtTs       time.Time `json:"at_ts,omitempty"`
+}
+
+// CheckManyResponse is the response message for CheckMany. Results are
+// related by position to the checks.
+type CheckManyResponse struct {
+	Results []CheckResult `json:"results"`
+}
+
+// CheckResult is the result of a check, Error is empty if the check was
+// done.
+type CheckResult struct {
+	Result  bool      `json:"result"`
+	LastTs  time.Time `json:"last_ts,omitempty"`
+	StoreTs time.Time `json:"store_ts,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// HistoryRequest is the message for History. ToTs zero is now.
+type HistoryRequest struct {
+	ClientIP string    `json:"client_ip"`
+	FromTs   time.Time `json:"from_ts"`
+	ToTs     time.Time `json:"to_ts,omitempty"`
+}
+
+// HistoryResponse is the message streamed by History, one for each period
+// of resolution. TTL is in seconds.
+type HistoryResponse struct {
+	ResolvedIP string    `json:"resolved_ip"`
+	Name       string    `json:"name"`
+	SinceTs    time.Time `json:"since_ts"`
+	LastTs     time.Time `json:"last_ts"`
+	TTL        uint32    `json:"ttl,omitempty"`
+	Chain      []string  `json:"chain,omitempty"`
+}
+
+// FailuresRequest is the message for Failures.
+type FailuresRequest struct {
+	ClientIP string `json:"client_ip"`
+}
+
+// FailuresResponse is the response message for Failures. Client is the
+// network of the client in the cache and Recent the failed names not
+// expired, newest first.
+type FailuresResponse struct {
+	Client   string       `json:"client"`
+	NXDomain uint64       `json:"nxdomain"`
+	NoData   uint64       `json:"nodata"`
+	Recent   []FailedName `json:"recent,omitempty"`
+}
+
+// FailedName stores a name with a negative answer, "nxdomain" or "nodata".
+type FailedName struct {
+	Name     string    `json:"name"`
+	LastTs   time.Time `json:"last_ts"`
+	Negative string    `json:"negative"`
+}
+
+// ClientStatsRequest is the message for ClientStats, an empty client ip
+// requests the most recently updated clients.
+type ClientStatsRequest struct {
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+// ClientStatsResponse is the response message for ClientStats.
+type ClientStatsResponse struct {
+	Clients []ClientStats `json:"clients,omitempty"`
+}
+
+// ClientStats stores the behavioural information of a client. Client is
+// the network of the client in the cache and Rate is per minute.
+type ClientStats struct {
+	Client       string    `json:"client"`
+	FirstTs      time.Time `json:"first_ts"`
+	LastTs       time.Time `json:"last_ts"`
+	Names        int       `json:"names"`
+	Domains      int       `json:"domains"`
+	LabelLength  float64   `json:"label_length"`
+	LabelEntropy float64   `json:"label_entropy"`
+	Rate         float64   `json:"rate"`
+}
@@ -0,0 +1,301 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvquery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Querier is the interface for queries in a resolv cache.
+type Querier interface {
+	Lookup(ctx context.Context, client, resolved net.IP) ([]resolvcache.NameInfo, error)
+	Clients(ctx context.Context, resolved net.IP, name string) ([]resolvcache.ClientInfo, error)
+	Match(ctx context.Context, client, resolved net.IP, name string, mode resolvcache.MatchMode, at time.Time) (resolvcache.Match, error)
+	CheckMany(ctx context.Context, cs []resolvcache.Check) ([]dnsutil.CacheResponse, error)
+	Failures(ctx context.Context, client net.IP) (resolvcache.FailureInfo, error)
+	ClientStats(ctx context.Context, client net.IP) ([]resolvcache.ClientStats, error)
+	History(ctx context.Context, client net.IP, from, to time.Time) ([]resolvcache.HistoryRecord, error)
+}
+
+// MaxBatch is the max number of checks in a batch.
+const MaxBatch = 4096
+
+// Service implements a grpc service wrapper.
+type Service struct {
+	logger  yalogi.Logger
+	querier Querier
+}
+
+// ServiceOption is used for service configuration
+type ServiceOption func(*serviceOpts)
+
+type serviceOpts struct {
+	logger yalogi.Logger
+}
+
+var defaultServiceOpts = serviceOpts{logger: yalogi.LogNull}
+
+// SetServiceLogger option allows set a custom logger.
+func SetServiceLogger(l yalogi.Logger) ServiceOption {
+	return func(o *serviceOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewService returns a new Service
+func NewService(q Querier, opt ...ServiceOption) *Service {
+	opts := defaultServiceOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Service{querier: q, logger: opts.logger}
+}
+
+// RegisterServer registers a service in the grpc server.
+func RegisterServer(server *grpc.Server, service *Service) {
+	server.RegisterService(&serviceDesc, service)
+}
+
+// Lookup implements grpc api.
+func (s *Service) Lookup(ctx context.Context, in *LookupRequest) (*LookupResponse, error) {
+	client, resolved, err := parseIPs(in.ClientIP, in.ResolvedIP)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] lookup(%s,%s): %v", getPeerAddr(ctx), in.ClientIP, in.ResolvedIP, err)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	names, err := s.querier.Lookup(ctx, client, resolved)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] lookup(%v,%v): %v", getPeerAddr(ctx), client, resolved, err)
+		return nil, s.mapError(err)
+	}
+	response := &LookupResponse{Names: make([]NameInfo, 0, len(names))}
+	for _, n := range names {
+		response.Names = append(response.Names, NameInfo{Name: n.Name, LastTs: n.Last, Chain: n.Chain})
+	}
+	return response, nil
+}
+
+// Clients implements grpc api.
+func (s *Service) Clients(ctx context.Context, in *ClientsRequest) (*ClientsResponse, error) {
+	var resolved net.IP
+	if in.ResolvedIP != "" {
+		resolved = net.ParseIP(in.ResolvedIP)
+		if resolved == nil {
+			s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] clients(%s,%s): resolved must be an ip", getPeerAddr(ctx), in.ResolvedIP, in.Name)
+			return nil, s.mapError(dnsutil.ErrBadRequest)
+		}
+	}
+	clients, err := s.querier.Clients(ctx, resolved, in.Name)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] clients(%s,%s): %v", getPeerAddr(ctx), in.ResolvedIP, in.Name, err)
+		return nil, s.mapError(err)
+	}
+	response := &ClientsResponse{Clients: make([]ClientInfo, 0, len(clients))}
+	for _, c := range clients {
+		response.Clients = append(response.Clients, ClientInfo{ClientIP: c.Client.String(), LastTs: c.Last})
+	}
+	return response, nil
+}
+
+// Match implements grpc api.
+func (s *Service) Match(ctx context.Context, in *MatchRequest) (*MatchResponse, error) {
+	client, resolved, err := parseIPs(in.ClientIP, in.ResolvedIP)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] match(%s,%s,%s): %v", getPeerAddr(ctx), in.ClientIP, in.ResolvedIP, in.Name, err)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	mode, err := resolvcache.ToMatchMode(in.Mode)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] match(%s,%s,%s): %v", getPeerAddr(ctx), in.ClientIP, in.ResolvedIP, in.Name, err)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	m, err := s.querier.Match(ctx, client, resolved, in.Name, mode, in.AtTs)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] match(%v,%v,%s,%v,%v): %v", getPeerAddr(ctx), client, resolved, in.Name, mode, in.AtTs, err)
+		return nil, s.mapError(err)
+	}
+	return &MatchResponse{
+		Result:  m.Result,
+		SinceTs: m.Since,
+		LastTs:  m.Last,
+		StoreTs: m.Store,
+		TTL:     uint32(m.TTL / time.Second),
+		InTTL:   m.InTTL,
+		Name:    m.Name,
+		Chain:   m.Chain,
+	}, nil
+}
+
+// CheckMany implements grpc api. Checks with invalid values are not done
+// and their results have the error.
+func (s *Service) CheckMany(ctx context.Context, in *CheckManyRequest) (*CheckManyResponse, error) {
+	if len(in.Checks) > MaxBatch {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] checkmany(%v): too many checks", getPeerAddr(ctx), len(in.Checks))
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	response := &CheckManyResponse{Results: make([]CheckResult, len(in.Checks))}
+	cs := make([]resolvcache.Check, 0, len(in.Checks))
+	pos := make([]int, 0, len(in.Checks))
+	for i, req := range in.Checks {
+		client, resolved, err := parseIPs(req.ClientIP, req.ResolvedIP)
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] checkmany(%s,%s,%s): %v", getPeerAddr(ctx), req.ClientIP, req.ResolvedIP, req.Name, err)
+			response.Results[i].Error = dnsutil.ErrBadRequest.Error()
+			continue
+		}
+		cs = append(cs, resolvcache.Check{Client: client, Resolved: resolved, Name: req.Name, At: req.AtTs})
+		pos = append(pos, i)
+	}
+	if len(cs) == 0 {
+		return response, nil
+	}
+	resps, err := s.querier.CheckMany(ctx, cs)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] checkmany(%v): %v", getPeerAddr(ctx), len(in.Checks), err)
+		return nil, s.mapError(err)
+	}
+	for i, r := range resps {
+		response.Results[pos[i]] = CheckResult{Result: r.Result, LastTs: r.Last, StoreTs: r.Store}
+	}
+	return response, nil
+}
+
+// Failures implements grpc api.
+func (s *Service) Failures(ctx context.Context, in *FailuresRequest) (*FailuresResponse, error) {
+	client := net.ParseIP(in.ClientIP)
+	if client == nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] failures(%s): client must be an ip", getPeerAddr(ctx), in.ClientIP)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	info, err := s.querier.Failures(ctx, client)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] failures(%v): %v", getPeerAddr(ctx), client, err)
+		return nil, s.mapError(err)
+	}
+	response := &FailuresResponse{
+		NXDomain: info.NXDomain,
+		NoData:   info.NoData,
+		Recent:   make([]FailedName, 0, len(info.Recent)),
+	}
+	if info.Client != nil {
+		response.Client = info.Client.String()
+	}
+	for _, f := range info.Recent {
+		response.Recent = append(response.Recent, FailedName{Name: f.Name, LastTs: f.Last, Negative: f.Negative.String()})
+	}
+	return response, nil
+}
+
+// ClientStats implements grpc api.
+func (s *Service) ClientStats(ctx context.Context, in *ClientStatsRequest) (*ClientStatsResponse, error) {
+	var client net.IP
+	if in.ClientIP != "" {
+		client = net.ParseIP(in.ClientIP)
+		if client == nil {
+			s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] clientstats(%s): client must be an ip", getPeerAddr(ctx), in.ClientIP)
+			return nil, s.mapError(dnsutil.ErrBadRequest)
+		}
+	}
+	stats, err := s.querier.ClientStats(ctx, client)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] clientstats(%v): %v", getPeerAddr(ctx), client, err)
+		return nil, s.mapError(err)
+	}
+	response := &ClientStatsResponse{Clients: make([]ClientStats, 0, len(stats))}
+	for _, st := range stats {
+		response.Clients = append(response.Clients, ClientStats{
+			Client:       st.Client.String(),
+			FirstTs:      st.First,
+			LastTs:       st.Last,
+			Names:        st.Names,
+			Domains:      st.Domains,
+			LabelLength:  st.LabelLength,
+			LabelEntropy: st.LabelEntropy,
+			Rate:         st.Rate,
+		})
+	}
+	return response, nil
+}
+
+// History implements grpc api.
+func (s *Service) History(in *HistoryRequest, stream HistoryServer) error {
+	ctx := stream.Context()
+	client := net.ParseIP(in.ClientIP)
+	if client == nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] history(%s): client must be an ip", getPeerAddr(ctx), in.ClientIP)
+		return s.mapError(dnsutil.ErrBadRequest)
+	}
+	records, err := s.querier.History(ctx, client, in.FromTs, in.ToTs)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] history(%v,%v,%v): %v", getPeerAddr(ctx), client, in.FromTs, in.ToTs, err)
+		return s.mapError(err)
+	}
+	for _, r := range records {
+		err := stream.Send(&HistoryResponse{
+			ResolvedIP: r.Resolved.String(),
+			Name:       r.Name,
+			SinceTs:    r.Since,
+			LastTs:     r.Last,
+			TTL:        uint32(r.TTL / time.Second),
+			Chain:      r.Chain,
+		})
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvquery: [peer=%s] history(%v,%v,%v): %v", getPeerAddr(ctx), client, in.FromTs, in.ToTs, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func parseIPs(client, resolved string) (net.IP, net.IP, error) {
+	if client == "" || resolved == "" {
+		return nil, nil, errors.New("client and resolved are required")
+	}
+	clientIP := net.ParseIP(client)
+	if clientIP == nil {
+		return nil, nil, errors.New("client must be an ip")
+	}
+	resolvedIP := net.ParseIP(resolved)
+	if resolvedIP == nil {
+		return nil, nil, errors.New("resolved must be an ip")
+	}
+	return clientIP, resolvedIP, nil
+}
+
+// mapping query errors
+func (s *Service) mapError(err error) error {
+	switch err {
+	case dnsutil.ErrCanceledRequest:
+		return status.Error(codes.Canceled, err.Error())
+	case dnsutil.ErrBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case dnsutil.ErrNotSupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	case dnsutil.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, dnsutil.ErrInternal.Error())
+	}
+}
+
+func getPeerAddr(ctx context.Context) (paddr string) {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		paddr = p.Addr.String()
+	}
+	return
+}
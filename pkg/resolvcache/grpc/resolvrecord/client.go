@@ -0,0 +1,252 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Client provides a grpc client.
+type Client struct {
+	opts   clientOpts
+	logger yalogi.Logger
+	//grpc connection
+	conn *grpc.ClientConn
+	//control
+	closed bool
+}
+
+// ClientOption encapsules options for client.
+type ClientOption func(*clientOpts)
+
+type clientOpts struct {
+	logger    yalogi.Logger
+	closeConn bool
+}
+
+var defaultClientOpts = clientOpts{
+	logger:    yalogi.LogNull,
+	closeConn: true,
+}
+
+// CloseConnection option closes grpc connection on shutdown.
+func CloseConnection(b bool) ClientOption {
+	return func(o *clientOpts) {
+		o.closeConn = b
+	}
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) ClientOption {
+	return func(o *clientOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewClient returns a new Client.
+func NewClient(conn *grpc.ClientConn, opt ...ClientOption) *Client {
+	opts := defaultClientOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Client{
+		opts:   opts,
+		logger: opts.logger,
+		conn:   conn,
+	}
+}
+
+// Collect implements dnsutil.ResolvCollector interface.
+func (c *Client) Collect(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string) error {
+	return c.CollectTTL(ctx, client, name, resolved, cnames, nil)
+}
+
+// CollectTTL implements Collector interface.
+func (c *Client) CollectTTL(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string, ttls []time.Duration) error {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collect(%v,%s,%v,%v): client is closed", client, name, resolved, cnames)
+		return dnsutil.ErrUnavailable
+	}
+	req := getRequest(client, name, resolved, cnames, ttls)
+	err := c.conn.Invoke(ctx, methodName("Collect"), &req, &CollectResponse{}, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collect(%v,%s,%v,%v): %v", client, name, resolved, cnames, err)
+		return c.mapError(err)
+	}
+	return nil
+}
+
+// CollectNegative implements NegativeCollector interface.
+func (c *Client) CollectNegative(ctx context.Context, client net.IP, name string, n resolvcache.Negative) error {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collect(%v,%s,%v): client is closed", client, name, n)
+		return dnsutil.ErrUnavailable
+	}
+	req := getNegativeRequest(client, name, n)
+	err := c.conn.Invoke(ctx, methodName("Collect"), &req, &CollectResponse{}, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collect(%v,%s,%v): %v", client, name, n, err)
+		return c.mapError(err)
+	}
+	return nil
+}
+
+// CollectMany implements BatchCollector interface.
+func (c *Client) CollectMany(ctx context.Context, rs []resolvcache.Resolution) ([]error, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collectmany(%v): client is closed", len(rs))
+		return nil, dnsutil.ErrUnavailable
+	}
+	if len(rs) == 0 {
+		return nil, nil
+	}
+	req := &CollectManyRequest{Requests: make([]CollectRequest, 0, len(rs))}
+	for _, r := range rs {
+		if r.Negative != resolvcache.Positive {
+			req.Requests = append(req.Requests, getNegativeRequest(r.Client, r.Name, r.Negative))
+			continue
+		}
+		req.Requests = append(req.Requests, getRequest(r.Client, r.Name, r.Resolved, r.CNAMEs, r.TTLs))
+	}
+	resp := &CollectManyResponse{}
+	err := c.conn.Invoke(ctx, methodName("CollectMany"), req, resp, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collectmany(%v): %v", len(rs), err)
+		return nil, c.mapError(err)
+	}
+	if len(resp.Errors) == 0 {
+		return nil, nil
+	}
+	if len(resp.Errors) != len(rs) {
+		c.logger.Warnf("client.dnsutil.resolvrecord: collectmany(%v): invalid response", len(rs))
+		return nil, dnsutil.ErrInternal
+	}
+	errs := make([]error, len(rs))
+	for i, msg := range resp.Errors {
+		if msg != "" {
+			errs[i] = toError(msg)
+		}
+	}
+	return errs, nil
+}
+
+func getRequest(client net.IP, name string, resolved []net.IP, cnames []string, ttls []time.Duration) CollectRequest {
+	req := CollectRequest{
+		ClientIP:       client.String(),
+		Name:           name,
+		ResolvedIPs:    make([]string, 0, len(resolved)),
+		ResolvedCNAMEs: cnames,
+	}
+	for _, r := range resolved {
+		req.ResolvedIPs = append(req.ResolvedIPs, r.String())
+	}
+	if len(ttls) > 0 {
+		req.TTLs = make([]uint32, 0, len(ttls))
+		for _, ttl := range ttls {
+			req.TTLs = append(req.TTLs, uint32(ttl/time.Second))
+		}
+	}
+	return req
+}
+
+func getNegativeRequest(client net.IP, name string, n resolvcache.Negative) CollectRequest {
+	return CollectRequest{
+		ClientIP: client.String(),
+		Name:     name,
+		Negative: n.String(),
+	}
+}
+
+// toError returns the dnsutil error from the message
+func toError(msg string) error {
+	for _, err := range []error{
+		dnsutil.ErrLimitDNSClientQueries,
+		dnsutil.ErrLimitResolvedNamesIP,
+		dnsutil.ErrBadRequest,
+		dnsutil.ErrUnavailable,
+		dnsutil.ErrNotSupported,
+		dnsutil.ErrCanceledRequest,
+	} {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return dnsutil.ErrInternal
+}
+
+// mapping errors
+func (c *Client) mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return dnsutil.ErrCanceledRequest
+	case codes.InvalidArgument:
+		return dnsutil.ErrBadRequest
+	case codes.Unimplemented:
+		return dnsutil.ErrNotSupported
+	case codes.Internal:
+		return dnsutil.ErrInternal
+	case codes.Unavailable:
+		return dnsutil.ErrUnavailable
+	case codes.ResourceExhausted:
+		if st.Message() == dnsutil.ErrLimitDNSClientQueries.Error() {
+			return dnsutil.ErrLimitDNSClientQueries
+		}
+		if st.Message() == dnsutil.ErrLimitResolvedNamesIP.Error() {
+			return dnsutil.ErrLimitResolvedNamesIP
+		}
+		return dnsutil.ErrUnavailable
+	default:
+		return dnsutil.ErrUnavailable
+	}
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	c.closed = true
+	if c.opts.closeConn {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Ping checks connectivity with the api.
+func (c *Client) Ping() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	st := c.conn.GetState()
+	switch st {
+	case connectivity.TransientFailure:
+		return fmt.Errorf("connection state: %v", st)
+	case connectivity.Shutdown:
+		return fmt.Errorf("connection state: %v", st)
+	}
+	return nil
+}
+
+// API returns API service name implemented.
+func (c *Client) API() string {
+	return ServiceName()
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvrecord
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/jsoncodec"
+)
+
+// recordServer is the server api, messages are encoded with jsoncodec.
+type recordServer interface {
+	Collect(context.Context, *CollectRequest) (*CollectResponse, error)
+	CollectMany(context.Context, *CollectManyRequest) (*CollectManyResponse, error)
+}
+
+func methodName(method string) string {
+	return jsoncodec.MethodName(ServiceName(), method)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName(),
+	HandlerType: (*recordServer)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(ServiceName(), "Collect", func() interface{} { return new(CollectRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(recordServer).Collect(ctx, req.(*CollectRequest))
+			}),
+		jsoncodec.UnaryMethod(ServiceName(), "CollectMany", func() interface{} { return new(CollectManyRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(recordServer).CollectMany(ctx, req.(*CollectManyRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "resolvrecord",
+}
+
+// callOpts are the options used by the client in all calls.
+var callOpts = []grpc.CallOption{jsoncodec.CallOption()}
@@ -0,0 +1,21 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package resolvrecord implements a grpc client and a ready to use service
+// component for the record api of the resolvcache daemon. This api extends
+// dnsutil.ResolvCollector with the ttls of the dns records and negative
+// answers, its messages are encoded with jsoncodec.
+package resolvrecord
+
+import "fmt"
+
+// Constants for api description.
+const (
+	APIName    = "luids.resolvcache"
+	APIVersion = "v1"
+	APIService = "ResolvRecord"
+)
+
+// ServiceName returns service name.
+func ServiceName() string {
+	return fmt.Sprintf("%s.%s.%s", APIName, APIVersion, APIService)
+}
@@ -0,0 +1,30 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvrecord
+
+// CollectRequest is the message for Collect. TTLs are in seconds and are
+// related by position to ResolvedIPs, zero values are unknown. Negative is
+// "nxdomain" or "nodata" for negative answers, without resolved ips.
+type CollectRequest struct {
+	ClientIP       string   `json:"client_ip"`
+	Name           string   `json:"name"`
+	ResolvedIPs    []string `json:"resolved_ips"`
+	TTLs           []uint32 `json:"ttls,omitempty"`
+	ResolvedCNAMEs []string `json:"resolved_cnames,omitempty"`
+	Negative       string   `json:"negative,omitempty"`
+}
+
+// CollectResponse is the response message for Collect.
+type CollectResponse struct{}
+
+// CollectManyRequest is the message for CollectMany.
+type CollectManyRequest struct {
+	Requests []CollectRequest `json:"requests"`
+}
+
+// CollectManyResponse is the response message for CollectMany. Errors are
+// related by position to the requests, empty values are collected. Errors
+// is empty if all requests were collected.
+type CollectManyResponse struct {
+	Errors []string `json:"errors,omitempty"`
+}
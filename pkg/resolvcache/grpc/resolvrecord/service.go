@@ -0,0 +1,229 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvrecord
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Collector is the interface for collecting resolutions with the ttls of
+// the resolved ips. Missing or zero ttls are unknown.
+type Collector interface {
+	CollectTTL(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string, ttls []time.Duration) error
+}
+
+// BatchCollector is the interface for collecting resolutions in batches.
+// It returns the errors related by position to the resolutions, nil if all
+// resolutions were collected.
+type BatchCollector interface {
+	CollectMany(ctx context.Context, rs []resolvcache.Resolution) ([]error, error)
+}
+
+// NegativeCollector is the interface for collecting negative answers.
+type NegativeCollector interface {
+	CollectNegative(ctx context.Context, client net.IP, name string, n resolvcache.Negative) error
+}
+
+// MaxBatch is the max number of resolutions in a batch.
+const MaxBatch = 4096
+
+// Service implements a grpc service wrapper.
+type Service struct {
+	logger    yalogi.Logger
+	collector Collector
+	// batch is nil if collector doesn't implement BatchCollector
+	batch BatchCollector
+	// negative is nil if collector doesn't implement NegativeCollector
+	negative NegativeCollector
+}
+
+// ServiceOption is used for service configuration
+type ServiceOption func(*serviceOpts)
+
+type serviceOpts struct {
+	logger yalogi.Logger
+}
+
+var defaultServiceOpts = serviceOpts{logger: yalogi.LogNull}
+
+// SetServiceLogger option allows set a custom logger.
+func SetServiceLogger(l yalogi.Logger) ServiceOption {
+	return func(o *serviceOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewService returns a new Service
+func NewService(c Collector, opt ...ServiceOption) *Service {
+	opts := defaultServiceOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	s := &Service{collector: c, logger: opts.logger}
+	s.batch, _ = c.(BatchCollector)
+	s.negative, _ = c.(NegativeCollector)
+	return s
+}
+
+// RegisterServer registers a service in the grpc server.
+func RegisterServer(server *grpc.Server, service *Service) {
+	server.RegisterService(&serviceDesc, service)
+}
+
+// Collect implements grpc api.
+func (s *Service) Collect(ctx context.Context, in *CollectRequest) (*CollectResponse, error) {
+	r, err := parseRequest(in)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collect(%s,%s,%v,%v): %v", getPeerAddr(ctx), in.ClientIP, in.Name, in.ResolvedIPs, in.ResolvedCNAMEs, err)
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	if r.Negative != resolvcache.Positive {
+		if s.negative == nil {
+			return nil, s.mapError(dnsutil.ErrNotSupported)
+		}
+		err = s.negative.CollectNegative(ctx, r.Client, r.Name, r.Negative)
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collect(%v,%s,%v): %v", getPeerAddr(ctx), r.Client, r.Name, r.Negative, err)
+			return nil, s.mapError(err)
+		}
+		return &CollectResponse{}, nil
+	}
+	err = s.collector.CollectTTL(ctx, r.Client, r.Name, r.Resolved, r.CNAMEs, r.TTLs)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collect(%v,%s,%v,%v): %v", getPeerAddr(ctx), r.Client, r.Name, r.Resolved, r.CNAMEs, err)
+		return nil, s.mapError(err)
+	}
+	return &CollectResponse{}, nil
+}
+
+// CollectMany implements grpc api.
+func (s *Service) CollectMany(ctx context.Context, in *CollectManyRequest) (*CollectManyResponse, error) {
+	if s.batch == nil {
+		return nil, s.mapError(dnsutil.ErrNotSupported)
+	}
+	if len(in.Requests) > MaxBatch {
+		s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collectmany(%v): too many requests", getPeerAddr(ctx), len(in.Requests))
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	response := &CollectManyResponse{}
+	setError := func(i int, err error) {
+		if response.Errors == nil {
+			response.Errors = make([]string, len(in.Requests))
+		}
+		response.Errors[i] = err.Error()
+	}
+	// requests with errors are not collected
+	rs := make([]resolvcache.Resolution, 0, len(in.Requests))
+	pos := make([]int, 0, len(in.Requests))
+	for i, req := range in.Requests {
+		r, err := parseRequest(&req)
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collectmany(%s,%s,%v,%v): %v", getPeerAddr(ctx), req.ClientIP, req.Name, req.ResolvedIPs, req.ResolvedCNAMEs, err)
+			setError(i, dnsutil.ErrBadRequest)
+			continue
+		}
+		rs = append(rs, r)
+		pos = append(pos, i)
+	}
+	if len(rs) == 0 {
+		return response, nil
+	}
+	errs, err := s.batch.CollectMany(ctx, rs)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvrecord: [peer=%s] collectmany(%v): %v", getPeerAddr(ctx), len(in.Requests), err)
+		return nil, s.mapError(err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			setError(pos[i], err)
+		}
+	}
+	return response, nil
+}
+
+func parseRequest(req *CollectRequest) (resolvcache.Resolution, error) {
+	var r resolvcache.Resolution
+	r.Client = net.ParseIP(req.ClientIP)
+	if r.Client == nil {
+		return r, errors.New("bad client ip")
+	}
+	if req.Name == "" {
+		return r, errors.New("bad dns name")
+	}
+	r.Name = req.Name
+	negative, err := resolvcache.ToNegative(req.Negative)
+	if err != nil {
+		return r, err
+	}
+	if negative != resolvcache.Positive {
+		if len(req.ResolvedIPs) > 0 {
+			return r, errors.New("resolved ips in negative answer")
+		}
+		r.Negative = negative
+		return r, nil
+	}
+	if len(req.ResolvedIPs) == 0 {
+		return r, errors.New("resolved ips empty")
+	}
+	if len(req.TTLs) > len(req.ResolvedIPs) {
+		return r, errors.New("too many ttls")
+	}
+	r.Resolved = make([]net.IP, 0, len(req.ResolvedIPs))
+	for _, s := range req.ResolvedIPs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return r, errors.New("bad resolved ip")
+		}
+		r.Resolved = append(r.Resolved, ip)
+	}
+	if len(req.TTLs) > 0 {
+		r.TTLs = make([]time.Duration, 0, len(req.TTLs))
+		for _, ttl := range req.TTLs {
+			r.TTLs = append(r.TTLs, time.Duration(ttl)*time.Second)
+		}
+	}
+	r.CNAMEs = req.ResolvedCNAMEs
+	return r, nil
+}
+
+// mapping collect errors
+func (s *Service) mapError(err error) error {
+	switch err {
+	case dnsutil.ErrCanceledRequest:
+		return status.Error(codes.Canceled, err.Error())
+	case dnsutil.ErrBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case dnsutil.ErrNotSupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	case dnsutil.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	case dnsutil.ErrLimitDNSClientQueries:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case dnsutil.ErrLimitResolvedNamesIP:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, dnsutil.ErrInternal.Error())
+	}
+}
+
+func getPeerAddr(ctx context.Context) (paddr string) {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		paddr = p.Addr.String()
+	}
+	return
+}
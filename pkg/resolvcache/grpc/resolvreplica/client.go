@@ -0,0 +1,174 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvreplica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Client provides a grpc client.
+type Client struct {
+	opts   clientOpts
+	logger yalogi.Logger
+	//grpc connection
+	conn *grpc.ClientConn
+	//control
+	closed bool
+}
+
+// ClientOption encapsules options for client.
+type ClientOption func(*clientOpts)
+
+type clientOpts struct {
+	logger    yalogi.Logger
+	closeConn bool
+}
+
+var defaultClientOpts = clientOpts{
+	logger:    yalogi.LogNull,
+	closeConn: true,
+}
+
+// CloseConnection option closes grpc connection on shutdown.
+func CloseConnection(b bool) ClientOption {
+	return func(o *clientOpts) {
+		o.closeConn = b
+	}
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) ClientOption {
+	return func(o *clientOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewClient returns a new Client.
+func NewClient(conn *grpc.ClientConn, opt ...ClientOption) *Client {
+	opts := defaultClientOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Client{
+		opts:   opts,
+		logger: opts.logger,
+		conn:   conn,
+	}
+}
+
+// Replicate implements resolvcache.Peer interface.
+func (c *Client) Replicate(ctx context.Context, origin string, records []resolvcache.Record) (string, error) {
+	if c.closed {
+		c.logger.Warnf("client.dnsutil.resolvreplica: replicate(%s): client is closed", origin)
+		return "", dnsutil.ErrUnavailable
+	}
+	req := &ReplicateRequest{Origin: origin}
+	if len(records) > 0 {
+		req.Records = make([]Record, 0, len(records))
+		for _, r := range records {
+			req.Records = append(req.Records, getRecord(r))
+		}
+	}
+	resp := &ReplicateResponse{}
+	err := c.conn.Invoke(ctx, methodName("Replicate"), req, resp, callOpts...)
+	if err != nil {
+		c.logger.Warnf("client.dnsutil.resolvreplica: replicate(%s): %v", origin, err)
+		return "", c.mapError(err)
+	}
+	return resp.Instance, nil
+}
+
+func getRecord(r resolvcache.Record) Record {
+	record := Record{
+		Ts:             r.Ts,
+		ClientIP:       r.Client.String(),
+		Name:           r.Name,
+		ResolvedIPs:    make([]string, 0, len(r.Resolved)),
+		ResolvedCNAMEs: r.CNAMEs,
+	}
+	if !r.Since.IsZero() {
+		since := r.Since
+		record.Since = &since
+	}
+	for _, p := range r.Past {
+		record.Past = append(record.Past, Period{Since: p.Since, Last: p.Last, TTL: uint32(p.TTL / time.Second)})
+	}
+	for _, ip := range r.Resolved {
+		record.ResolvedIPs = append(record.ResolvedIPs, ip.String())
+	}
+	if len(r.TTLs) > 0 {
+		record.TTLs = make([]uint32, 0, len(r.TTLs))
+		for _, ttl := range r.TTLs {
+			record.TTLs = append(record.TTLs, uint32(ttl/time.Second))
+		}
+	}
+	return record
+}
+
+// mapping errors
+func (c *Client) mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Canceled:
+		return dnsutil.ErrCanceledRequest
+	case codes.InvalidArgument:
+		return dnsutil.ErrBadRequest
+	case codes.Unimplemented:
+		return dnsutil.ErrNotSupported
+	case codes.Internal:
+		return dnsutil.ErrInternal
+	case codes.Unavailable:
+		return dnsutil.ErrUnavailable
+	default:
+		return dnsutil.ErrUnavailable
+	}
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	c.closed = true
+	if c.opts.closeConn {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Ping checks connectivity with the api.
+func (c *Client) Ping() error {
+	if c.closed {
+		return errors.New("client closed")
+	}
+	st := c.conn.GetState()
+	switch st {
+	case connectivity.TransientFailure:
+		return fmt.Errorf("connection state: %v", st)
+	case connectivity.Shutdown:
+		return fmt.Errorf("connection state: %v", st)
+	}
+	return nil
+}
+
+// API returns API service name implemented.
+func (c *Client) API() string {
+	return ServiceName()
+}
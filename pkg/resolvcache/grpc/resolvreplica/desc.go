@@ -0,0 +1,36 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvreplica
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/luids-io/dns/pkg/resolvcache/grpc/jsoncodec"
+)
+
+// replicaServer is the server api, messages are encoded with jsoncodec.
+type replicaServer interface {
+	Replicate(context.Context, *ReplicateRequest) (*ReplicateResponse, error)
+}
+
+func methodName(method string) string {
+	return jsoncodec.MethodName(ServiceName(), method)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName(),
+	HandlerType: (*replicaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		jsoncodec.UnaryMethod(ServiceName(), "Replicate", func() interface{} { return new(ReplicateRequest) },
+			func(srv interface{}, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(replicaServer).Replicate(ctx, req.(*ReplicateRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "resolvreplica",
+}
+
+// callOpts are the options used by the client in all calls.
+var callOpts = []grpc.CallOption{jsoncodec.CallOption()}
@@ -0,0 +1,21 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package resolvreplica implements a grpc client and a ready to use service
+// component for the replication of records between resolvcache daemons.
+// The api is not part of the luids api, its messages are encoded with
+// jsoncodec.
+package resolvreplica
+
+import "fmt"
+
+// Constants for api description.
+const (
+	APIName    = "luids.resolvcache"
+	APIVersion = "v1"
+	APIService = "ResolvReplica"
+)
+
+// ServiceName returns service name.
+func ServiceName() string {
+	return fmt.Sprintf("%s.%s.%s", APIName, APIVersion, APIService)
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvreplica
+
+import "time"
+
+// Record is a resolution collected. TTLs are in seconds and are related by
+// position to ResolvedIPs, zero values are unknown. Since and Past are
+// only sent in the catch-up of the peers.
+type Record struct {
+	Ts             time.Time  `json:"ts"`
+	Since          *time.Time `json:"since,omitempty"`
+	Past           []Period   `json:"past,omitempty"`
+	ClientIP       string     `json:"client_ip"`
+	Name           string     `json:"name"`
+	ResolvedIPs    []string   `json:"resolved_ips"`
+	TTLs           []uint32   `json:"ttls,omitempty"`
+	ResolvedCNAMEs []string   `json:"resolved_cnames,omitempty"`
+}
+
+// Period is a previous period of resolution of a record. TTL is in seconds.
+type Period struct {
+	Since time.Time `json:"since"`
+	Last  time.Time `json:"last"`
+	TTL   uint32    `json:"ttl,omitempty"`
+}
+
+// ReplicateRequest is the message for Replicate. Origin is the instance
+// that sends the records, a request without records checks the peer.
+type ReplicateRequest struct {
+	Origin  string   `json:"origin"`
+	Records []Record `json:"records,omitempty"`
+}
+
+// ReplicateResponse is the response message for Replicate.
+type ReplicateResponse struct {
+	Instance string `json:"instance"`
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvreplica
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Service implements a grpc service wrapper.
+type Service struct {
+	logger yalogi.Logger
+	peer   resolvcache.Peer
+}
+
+// ServiceOption is used for service configuration
+type ServiceOption func(*serviceOpts)
+
+type serviceOpts struct {
+	logger yalogi.Logger
+}
+
+var defaultServiceOpts = serviceOpts{logger: yalogi.LogNull}
+
+// SetServiceLogger option allows set a custom logger.
+func SetServiceLogger(l yalogi.Logger) ServiceOption {
+	return func(o *serviceOpts) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// NewService returns a new Service
+func NewService(p resolvcache.Peer, opt ...ServiceOption) *Service {
+	opts := defaultServiceOpts
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Service{peer: p, logger: opts.logger}
+}
+
+// RegisterServer registers a service in the grpc server.
+func RegisterServer(server *grpc.Server, service *Service) {
+	server.RegisterService(&serviceDesc, service)
+}
+
+// Replicate implements grpc api.
+func (s *Service) Replicate(ctx context.Context, in *ReplicateRequest) (*ReplicateResponse, error) {
+	if in.Origin == "" {
+		s.logger.Warnf("service.dnsutil.resolvreplica: [peer=%s] replicate(): origin is required", getPeerAddr(ctx))
+		return nil, s.mapError(dnsutil.ErrBadRequest)
+	}
+	records := make([]resolvcache.Record, 0, len(in.Records))
+	for _, r := range in.Records {
+		record, err := parseRecord(r)
+		if err != nil {
+			s.logger.Warnf("service.dnsutil.resolvreplica: [peer=%s] replicate(%s): %v", getPeerAddr(ctx), in.Origin, err)
+			return nil, s.mapError(dnsutil.ErrBadRequest)
+		}
+		records = append(records, record)
+	}
+	instance, err := s.peer.Replicate(ctx, in.Origin, records)
+	if err != nil {
+		s.logger.Warnf("service.dnsutil.resolvreplica: [peer=%s] replicate(%s): %v", getPeerAddr(ctx), in.Origin, err)
+		return nil, s.mapError(err)
+	}
+	return &ReplicateResponse{Instance: instance}, nil
+}
+
+func parseRecord(r Record) (resolvcache.Record, error) {
+	client := net.ParseIP(r.ClientIP)
+	if client == nil {
+		return resolvcache.Record{}, errors.New("bad client ip")
+	}
+	if r.Name == "" {
+		return resolvcache.Record{}, errors.New("bad dns name")
+	}
+	if len(r.ResolvedIPs) == 0 {
+		return resolvcache.Record{}, errors.New("resolved ips empty")
+	}
+	if len(r.TTLs) > len(r.ResolvedIPs) {
+		return resolvcache.Record{}, errors.New("too many ttls")
+	}
+	if len(r.Past) > maxPast {
+		return resolvcache.Record{}, errors.New("too many periods")
+	}
+	record := resolvcache.Record{Ts: r.Ts, Resolution: resolvcache.Resolution{
+		Client:   client,
+		Name:     r.Name,
+		CNAMEs:   r.ResolvedCNAMEs,
+		Resolved: make([]net.IP, 0, len(r.ResolvedIPs)),
+	}}
+	for _, s := range r.ResolvedIPs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return resolvcache.Record{}, errors.New("bad resolved ip")
+		}
+		record.Resolved = append(record.Resolved, ip)
+	}
+	if len(r.TTLs) > 0 {
+		record.TTLs = make([]time.Duration, 0, len(r.TTLs))
+		for _, ttl := range r.TTLs {
+			record.TTLs = append(record.TTLs, time.Duration(ttl)*time.Second)
+		}
+	}
+	if r.Since != nil {
+		record.Since = *r.Since
+	}
+	for _, p := range r.Past {
+		record.Past = append(record.Past, resolvcache.Period{Since: p.Since, Last: p.Last, TTL: time.Duration(p.TTL) * time.Second})
+	}
+	return record, nil
+}
+
+// maxPast limits the number of periods of a record
+const maxPast = 1024
+
+// mapping replicate errors
+func (s *Service) mapError(err error) error {
+	switch err {
+	case dnsutil.ErrCanceledRequest:
+		return status.Error(codes.Canceled, err.Error())
+	case dnsutil.ErrBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case dnsutil.ErrNotSupported:
+		return status.Error(codes.Unimplemented, err.Error())
+	case dnsutil.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, dnsutil.ErrInternal.Error())
+	}
+}
+
+func getPeerAddr(ctx context.Context) (paddr string) {
+	p, ok := peer.FromContext(ctx)
+	if ok {
+		paddr = p.Addr.String()
+	}
+	return
+}
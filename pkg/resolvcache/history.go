@@ -0,0 +1,196 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"time"
+)
+
+// period stores a time interval in which a name was resolved continuously,
+// each resolution before the record of the previous one expired. Since is
+// the first resolution and ts the last one.
+type period struct {
+	since time.Time
+	ts    time.Time
+	ttl   time.Duration
+}
+
+// KeepHistory option stores up to n previous periods of resolution for
+// each name, used by checks at a point in time. The current period is
+// always stored.
+func KeepHistory(n int) CacheOption {
+	return func(o *cacheOptions) {
+		if n > 0 {
+			o.history = n
+		}
+	}
+}
+
+// HistorySize returns the number of previous periods stored for each name.
+func (o *Cache) HistorySize() int {
+	return o.history
+}
+
+// collect adds the resolution n of the same name to the item, updating
+// its periods. Resolutions older than the last one are merged in history.
+func (i *item) collect(n item, c *Cache) {
+	// fast path, continuous resolution
+	if len(n.past) == 0 && !n.since.Before(i.ts) && n.since.Sub(i.ts) <= c.lifetime(i.ttl) {
+		i.ts, i.ttl, i.chain = n.ts, n.ttl, n.chain
+		return
+	}
+	periods := make([]period, 0, len(i.past)+len(n.past)+2)
+	periods = append(periods, i.past...)
+	periods = append(periods, period{since: i.since, ts: i.ts, ttl: i.ttl})
+	for _, p := range n.past {
+		periods = c.addPeriod(periods, p)
+	}
+	periods = c.addPeriod(periods, period{since: n.since, ts: n.ts, ttl: n.ttl})
+	if !n.ts.Before(i.ts) {
+		i.chain = n.chain
+	}
+	last := periods[len(periods)-1]
+	i.since, i.ts, i.ttl = last.since, last.ts, last.ttl
+	// discard periods expired and exceeding the history
+	past := periods[:len(periods)-1]
+	for len(past) > 0 && last.ts.Sub(past[0].ts) > c.Expires() {
+		past = past[1:]
+	}
+	if len(past) > c.history {
+		past = past[len(past)-c.history:]
+	}
+	i.past = nil
+	if len(past) > 0 {
+		i.past = append(make([]period, 0, len(past)), past...)
+	}
+}
+
+// addPeriod inserts p in the periods sorted by time, merging the periods
+// that overlap or became continuous.
+func (o *Cache) addPeriod(periods []period, p period) []period {
+	j := sort.Search(len(periods), func(k int) bool { return periods[k].since.After(p.since) })
+	periods = append(periods, period{})
+	copy(periods[j+1:], periods[j:])
+	periods[j] = p
+	merged := periods[:1]
+	for _, q := range periods[1:] {
+		last := &merged[len(merged)-1]
+		if q.since.Sub(last.ts) <= o.lifetime(last.ttl) {
+			if q.ts.After(last.ts) {
+				last.ts, last.ttl = q.ts, q.ttl
+			}
+			continue
+		}
+		merged = append(merged, q)
+	}
+	return merged
+}
+
+// itemAt returns the item with the period that contains the time, it
+// returns false if the item was expired at that time.
+func (o *Cache) itemAt(i item, at time.Time) (item, bool) {
+	if !at.Before(i.since) {
+		return i, at.Sub(i.ts) <= o.lifetime(i.ttl)
+	}
+	for j := len(i.past) - 1; j >= 0; j-- {
+		p := i.past[j]
+		if !at.Before(p.since) {
+			i.since, i.ts, i.ttl = p.since, p.ts, p.ttl
+			return i, at.Sub(p.ts) <= o.lifetime(p.ttl)
+		}
+	}
+	return item{}, false
+}
+
+// HistoryRecord stores a period in which the client resolved the name to
+// the ip. Since is the first resolution of the period and Last the last
+// one.
+type HistoryRecord struct {
+	Resolved net.IP
+	Name     string
+	Since    time.Time
+	Last     time.Time
+	// TTL of the dns record of the last resolution, zero if unknown
+	TTL   time.Duration
+	Chain []string
+}
+
+// History returns the periods of resolution of the client that overlap the
+// time window, oldest first. Periods expired in the cache are not
+// returned and past periods are limited by the history stored.
+func (o *Cache) History(client net.IP, from, to time.Time) []HistoryRecord {
+	c, ok := o.findClientBlock(o.clientKey(client))
+	if !ok {
+		return nil
+	}
+	return c.history(from, to, time.Now().Add(-o.Expires()), o)
+}
+
+// historyKey identifies the periods of a name resolved to an ip.
+type historyKey struct {
+	resolved ipKey
+	name     string
+}
+
+func (c *clientBlock) history(from, to, expired time.Time, o *Cache) []HistoryRecord {
+	// periods of the same name and ip can be stored in several blocks
+	found := make(map[historyKey][]period)
+	chains := make(map[historyKey][]string)
+	add := func(k ipKey, i item) {
+		hk := historyKey{resolved: k, name: i.name}
+		periods := found[hk]
+		for _, p := range i.past {
+			periods = o.addPeriod(periods, p)
+		}
+		found[hk] = o.addPeriod(periods, period{since: i.since, ts: i.ts, ttl: i.ttl})
+		if i.chain != nil {
+			chains[hk] = i.chain
+		}
+	}
+	c.mu.RLock()
+	for _, b := range c.blocks {
+		b.mu.RLock()
+		for k, idx := range b.index {
+			node := b.nodes[idx]
+			if node.name == "" {
+				continue
+			}
+			add(k, node.item)
+			for _, other := range node.others {
+				add(k, other)
+			}
+		}
+		b.mu.RUnlock()
+	}
+	c.mu.RUnlock()
+
+	var records []HistoryRecord
+	for hk, periods := range found {
+		for _, p := range periods {
+			if p.ts.Before(expired) || p.ts.Before(from) || p.since.After(to) {
+				continue
+			}
+			records = append(records, HistoryRecord{
+				Resolved: hk.resolved.IP(),
+				Name:     hk.name,
+				Since:    p.since,
+				Last:     p.ts,
+				TTL:      p.ttl,
+				Chain:    chains[hk],
+			})
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Since.Equal(records[j].Since) {
+			return records[i].Since.Before(records[j].Since)
+		}
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return bytes.Compare(records[i].Resolved, records[j].Resolved) < 0
+	})
+	return records
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+var periodBase = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// per returns a period with the ttl used in the tests, times are relative
+// to periodBase.
+func per(since, ts time.Duration) period {
+	return period{since: periodBase.Add(since), ts: periodBase.Add(ts), ttl: time.Minute}
+}
+
+func periodCache(history int) *Cache {
+	return NewCache(time.Hour, DefaultLimits(), HonourTTL(0, 0), KeepHistory(history))
+}
+
+func samePeriods(got, want []period) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].since.Equal(want[i].since) || !got[i].ts.Equal(want[i].ts) || got[i].ttl != want[i].ttl {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddPeriod(t *testing.T) {
+	m := time.Minute
+	tests := []struct {
+		name    string
+		periods []period
+		add     period
+		want    []period
+	}{
+		{"empty", nil, per(0, m), []period{per(0, m)}},
+		{"in order", []period{per(0, m)}, per(5*m, 6*m), []period{per(0, m), per(5*m, 6*m)}},
+		{"continuous", []period{per(0, m)}, per(90*time.Second, 2*m), []period{per(0, 2*m)}},
+		{"out of order", []period{per(10*m, 11*m)}, per(0, m), []period{per(0, m), per(10*m, 11*m)}},
+		{"out of order between", []period{per(0, m), per(10*m, 11*m)}, per(5*m, 6*m),
+			[]period{per(0, m), per(5*m, 6*m), per(10*m, 11*m)}},
+		{"bridges periods", []period{per(0, m), per(3*m, 4*m)}, per(90*time.Second, 150*time.Second), []period{per(0, 4*m)}},
+		{"contained", []period{per(0, 10*m)}, per(2*m, 3*m), []period{per(0, 10*m)}},
+		{"extends", []period{per(2*m, 3*m)}, per(0, 10*m), []period{per(0, 10*m)}},
+	}
+	c := periodCache(4)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods := append([]period{}, tt.periods...)
+			if got := c.addPeriod(periods, tt.add); !samePeriods(got, tt.want) {
+				t.Errorf("addPeriod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemAt(t *testing.T) {
+	m := time.Minute
+	i := item{
+		name:  "www.example.com",
+		since: periodBase.Add(10 * m),
+		ts:    periodBase.Add(12 * m),
+		ttl:   m,
+		past:  []period{per(0, m), per(5*m, 6*m)},
+	}
+	tests := []struct {
+		name  string
+		at    time.Duration
+		want  bool
+		since time.Duration
+	}{
+		{"before all periods", -m, false, 0},
+		{"inside first period", 30 * time.Second, true, 0},
+		{"after first period in ttl", 90 * time.Second, true, 0},
+		{"between periods", 3 * m, false, 0},
+		{"inside second period", 330 * time.Second, true, 5 * m},
+		{"inside current period", 11 * m, true, 10 * m},
+		{"after current period in ttl", 12*m + 30*time.Second, true, 10 * m},
+		{"after current period expired", 20 * m, false, 0},
+	}
+	c := periodCache(4)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := c.itemAt(i, periodBase.Add(tt.at))
+			if ok != tt.want {
+				t.Fatalf("itemAt() = %v, want %v", ok, tt.want)
+			}
+			if ok && !got.since.Equal(periodBase.Add(tt.since)) {
+				t.Errorf("itemAt() since = %v, want %v", got.since, periodBase.Add(tt.since))
+			}
+			if ok && got.name != i.name {
+				t.Errorf("itemAt() name = %v", got.name)
+			}
+		})
+	}
+}
+
+func TestItemCollect(t *testing.T) {
+	m := time.Minute
+	resolution := func(since, ts time.Duration, chain ...string) item {
+		p := per(since, ts)
+		return item{name: "www.example.com", since: p.since, ts: p.ts, ttl: p.ttl, chain: chain}
+	}
+	tests := []struct {
+		name    string
+		history int
+		stored  item
+		add     []item
+		want    item
+	}{
+		{"continuous", 4, resolution(0, 0), []item{resolution(30*time.Second, 30*time.Second)},
+			resolution(0, 30*time.Second)},
+		{"new period", 4, resolution(0, 0), []item{resolution(5*m, 5*m)},
+			item{since: periodBase.Add(5 * m), ts: periodBase.Add(5 * m), past: []period{per(0, 0)}}},
+		{"out of order", 4, resolution(5*m, 5*m), []item{resolution(0, 0)},
+			item{since: periodBase.Add(5 * m), ts: periodBase.Add(5 * m), past: []period{per(0, 0)}}},
+		{"out of order merged", 4, resolution(5*m, 5*m), []item{resolution(4*m+30*time.Second, 4*m+30*time.Second)},
+			resolution(4*m+30*time.Second, 5*m)},
+		{"bridges past", 4, item{since: periodBase.Add(3 * m), ts: periodBase.Add(4 * m), ttl: m, past: []period{per(0, m)}},
+			[]item{resolution(90*time.Second, 150*time.Second)},
+			resolution(0, 4*m)},
+		{"merges past of other item", 4, resolution(10*m, 10*m),
+			[]item{{since: periodBase.Add(20 * m), ts: periodBase.Add(20 * m), ttl: m, past: []period{per(0, 0), per(15*m, 15*m)}}},
+			item{since: periodBase.Add(20 * m), ts: periodBase.Add(20 * m), past: []period{per(0, 0), per(10*m, 10*m), per(15*m, 15*m)}}},
+		{"history limit", 2, resolution(0, 0), []item{resolution(5*m, 5*m), resolution(10*m, 10*m), resolution(15*m, 15*m)},
+			item{since: periodBase.Add(15 * m), ts: periodBase.Add(15 * m), past: []period{per(5*m, 5*m), per(10*m, 10*m)}}},
+		{"expired past", 4, resolution(0, 0), []item{resolution(90*m, 90*m)},
+			resolution(90*m, 90*m)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := periodCache(tt.history)
+			i := tt.stored
+			for _, n := range tt.add {
+				i.collect(n, c)
+			}
+			if !i.since.Equal(tt.want.since) || !i.ts.Equal(tt.want.ts) {
+				t.Errorf("collect() period = %v - %v, want %v - %v", i.since, i.ts, tt.want.since, tt.want.ts)
+			}
+			if !samePeriods(i.past, tt.want.past) {
+				t.Errorf("collect() past = %v, want %v", i.past, tt.want.past)
+			}
+		})
+	}
+}
+
+func TestItemCollectChain(t *testing.T) {
+	c := periodCache(4)
+	i := item{name: "edge.example.net", since: periodBase, ts: periodBase, chain: []string{"www.example.com", "edge.example.net"}}
+	// older resolutions keep the chain of the newest
+	i.collect(item{name: "edge.example.net", since: periodBase.Add(-time.Minute), ts: periodBase.Add(-time.Minute)}, c)
+	if len(i.chain) != 2 {
+		t.Errorf("chain = %v, want the newest", i.chain)
+	}
+	i.collect(item{name: "edge.example.net", since: periodBase.Add(time.Minute), ts: periodBase.Add(time.Minute)}, c)
+	if i.chain != nil {
+		t.Errorf("chain = %v, want nil", i.chain)
+	}
+}
+
+func TestCacheHistory(t *testing.T) {
+	c := periodCache(4)
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	base := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	ttl := []time.Duration{time.Minute}
+	for _, d := range []time.Duration{0, 30 * time.Second, 10 * time.Minute, 20 * time.Minute} {
+		if err := c.SetTTL(base.Add(d), client, "www.example.com", []net.IP{resolved}, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.SetTTL(base.Add(15*time.Minute), client, "mail.example.com", []net.IP{resolved}, ttl)
+
+	h := c.History(client, time.Time{}, time.Now())
+	want := []struct {
+		name  string
+		since time.Duration
+		last  time.Duration
+	}{
+		{"www.example.com", 0, 30 * time.Second},
+		{"www.example.com", 10 * time.Minute, 10 * time.Minute},
+		{"mail.example.com", 15 * time.Minute, 15 * time.Minute},
+		{"www.example.com", 20 * time.Minute, 20 * time.Minute},
+	}
+	if len(h) != len(want) {
+		t.Fatalf("History() = %v, want %v records", h, len(want))
+	}
+	for i, w := range want {
+		if h[i].Name != w.name || !h[i].Since.Equal(base.Add(w.since)) || !h[i].Last.Equal(base.Add(w.last)) || h[i].TTL != time.Minute {
+			t.Errorf("History()[%v] = %+v, want %v", i, h[i], w)
+		}
+	}
+	// window filters the periods that overlap it
+	h = c.History(client, base.Add(5*time.Minute), base.Add(16*time.Minute))
+	if len(h) != 2 || h[0].Name != "www.example.com" || h[1].Name != "mail.example.com" {
+		t.Errorf("History() in window = %v", h)
+	}
+	if h := c.History(net.ParseIP("10.0.0.2"), time.Time{}, time.Now()); h != nil {
+		t.Errorf("History() of unknown client = %v", h)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientInfo stores a client and its last resolution time.
+type ClientInfo struct {
+	Client net.IP    `json:"client"`
+	Last   time.Time `json:"last"`
+}
+
+// clientIndex is a secondary index from resolved ips and names to clients
+type clientIndex struct {
+	mu     sync.RWMutex
+	byIP   map[ipKey]clientSet
+	byName map[string]clientSet
+}
+
+// clientSet stores the last resolution of each client
+type clientSet map[ipKey]time.Time
+
+func newClientIndex() *clientIndex {
+	return &clientIndex{
+		byIP:   make(map[ipKey]clientSet),
+		byName: make(map[string]clientSet),
+	}
+}
+
+func (x *clientIndex) add(ts time.Time, client ipKey, name string, resolved []net.IP) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	set, ok := x.byName[name]
+	if !ok {
+		set = make(clientSet)
+		x.byName[name] = set
+	}
+	set.update(client, ts)
+	for _, r := range resolved {
+		key := getIPKey(r)
+		set, ok := x.byIP[key]
+		if !ok {
+			set = make(clientSet)
+			x.byIP[key] = set
+		}
+		set.update(client, ts)
+	}
+}
+
+func (x *clientIndex) getByIP(resolved net.IP, expires time.Duration) []ClientInfo {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.byIP[getIPKey(resolved)].list(expires)
+}
+
+func (x *clientIndex) getByName(name string, expires time.Duration) []ClientInfo {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.byName[name].list(expires)
+}
+
+func (x *clientIndex) clean(expires time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key, set := range x.byIP {
+		if set.clean(expires) {
+			delete(x.byIP, key)
+		}
+	}
+	for key, set := range x.byName {
+		if set.clean(expires) {
+			delete(x.byName, key)
+		}
+	}
+}
+
+// remove deletes the clients from the index
+func (x *clientIndex) remove(clients map[ipKey]struct{}) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for key, set := range x.byIP {
+		if set.remove(clients) {
+			delete(x.byIP, key)
+		}
+	}
+	for key, set := range x.byName {
+		if set.remove(clients) {
+			delete(x.byName, key)
+		}
+	}
+}
+
+func (x *clientIndex) flush() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.byIP = make(map[ipKey]clientSet)
+	x.byName = make(map[string]clientSet)
+}
+
+func (set clientSet) update(client ipKey, ts time.Time) {
+	if last, ok := set[client]; !ok || ts.After(last) {
+		set[client] = ts
+	}
+}
+
+func (set clientSet) list(expires time.Duration) []ClientInfo {
+	if len(set) == 0 {
+		return nil
+	}
+	list := make([]ClientInfo, 0, len(set))
+	for client, last := range set {
+		if time.Since(last) > expires {
+			continue
+		}
+		list = append(list, ClientInfo{Client: client.IP(), Last: last})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Last.After(list[j].Last) })
+	return list
+}
+
+// clean removes expired clients and returns true if set is empty
+func (set clientSet) clean(expires time.Duration) bool {
+	for client, last := range set {
+		if time.Since(last) > expires {
+			delete(set, client)
+		}
+	}
+	return len(set) == 0
+}
+
+// remove deletes the clients and returns true if set is empty
+func (set clientSet) remove(clients map[ipKey]struct{}) bool {
+	for client := range set {
+		if _, ok := clients[client]; ok {
+			delete(set, client)
+		}
+	}
+	return len(set) == 0
+}
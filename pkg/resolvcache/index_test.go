@@ -0,0 +1,39 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIndexRejected(t *testing.T) {
+	limits := DefaultLimits()
+	limits.MaxNamesNode = 1
+	c := NewCache(time.Hour, limits, ClientIndex(true))
+	resolved := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+	now := time.Now()
+	a, b := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	c.Set(now, a, "a.example.com", resolved[:1])
+	c.Set(now, a, "b.example.com", resolved[:1])
+	if err := c.Set(now, a, "c.example.com", resolved[:1]); err == nil {
+		t.Fatalf("set over the limit without error")
+	}
+	if clients, _ := c.Clients(nil, "c.example.com"); len(clients) != 0 {
+		t.Errorf("Clients() of rejected name = %v", clients)
+	}
+	// only the ips stored are indexed
+	c.Set(now, b, "a.example.com", resolved[1:])
+	c.Set(now, b, "b.example.com", resolved[1:])
+	if err := c.Set(now, b, "c.example.com", resolved); err == nil {
+		t.Fatalf("set over the limit without error")
+	}
+	clients, _ := c.Clients(nil, "c.example.com")
+	if len(clients) != 1 || !clients[0].Client.Equal(b) {
+		t.Errorf("Clients() of partial resolution = %v, want %v", clients, b)
+	}
+	if clients, _ := c.Clients(resolved[0], ""); len(clients) != 2 {
+		t.Errorf("Clients() by ip = %v, want 2 clients", clients)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// MatchMode defines how names are compared in checks.
+type MatchMode int
+
+// Match modes.
+const (
+	// MatchExact matches the same name
+	MatchExact MatchMode = iota
+	// MatchSubdomain matches the name and any subdomain of the name
+	MatchSubdomain
+	// MatchDomain matches any name with the same registrable domain, using
+	// the public suffix list. Names that are public suffixes use exact
+	// match.
+	MatchDomain
+)
+
+// ToMatchMode returns the match mode from a string.
+func ToMatchMode(s string) (MatchMode, error) {
+	switch strings.ToLower(s) {
+	case "", "exact":
+		return MatchExact, nil
+	case "subdomain":
+		return MatchSubdomain, nil
+	case "domain":
+		return MatchDomain, nil
+	}
+	return MatchExact, fmt.Errorf("invalid match mode '%s'", s)
+}
+
+func (m MatchMode) String() string {
+	switch m {
+	case MatchExact:
+		return "exact"
+	case MatchSubdomain:
+		return "subdomain"
+	case MatchDomain:
+		return "domain"
+	}
+	return ""
+}
+
+// matcher compares names stored with the name queried. An empty name
+// matches all names. Names are stored in lower case, so the name queried is
+// converted.
+type matcher struct {
+	name   string
+	suffix string
+}
+
+func newMatcher(name string, mode MatchMode) matcher {
+	name = strings.ToLower(name)
+	switch mode {
+	case MatchSubdomain:
+		if name != "" {
+			return matcher{name: name, suffix: "." + name}
+		}
+	case MatchDomain:
+		domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+		if err == nil {
+			return matcher{name: domain, suffix: "." + domain}
+		}
+	}
+	return matcher{name: name}
+}
+
+// exact returns true if only the same name matches
+func (m matcher) exact() bool {
+	return m.suffix == "" && m.name != ""
+}
+
+func (m matcher) match(name string) bool {
+	if m.name == "" || m.name == name {
+		return true
+	}
+	return m.suffix != "" && strings.HasSuffix(name, m.suffix)
+}
+
+// MatchName returns true if the name stored matches the name queried with
+// the mode. An empty query matches all names. Names are compared case
+// insensitive.
+func MatchName(name, query string, mode MatchMode) bool {
+	return newMatcher(query, mode).match(strings.ToLower(name))
+}
+
+// lowerNames returns a copy of the names in lower case.
+func lowerNames(names []string) []string {
+	if len(names) == 0 {
+		return nil
+	}
+	lower := make([]string, 0, len(names))
+	for _, name := range names {
+		lower = append(lower, strings.ToLower(name))
+	}
+	return lower
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatchName(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		mode  MatchMode
+		want  bool
+	}{
+		{"www.example.com", "", MatchExact, true},
+		{"www.example.com", "www.example.com", MatchExact, true},
+		{"www.example.com", "example.com", MatchExact, false},
+		// subdomains
+		{"www.example.com", "example.com", MatchSubdomain, true},
+		{"example.com", "example.com", MatchSubdomain, true},
+		{"a.b.example.com", "example.com", MatchSubdomain, true},
+		{"badexample.com", "example.com", MatchSubdomain, false},
+		{"example.com", "www.example.com", MatchSubdomain, false},
+		{"example.co.uk", "co.uk", MatchSubdomain, true},
+		{"www.example.com", "", MatchSubdomain, true},
+		// registrable domains
+		{"mail.example.com", "www.example.com", MatchDomain, true},
+		{"example.com", "www.example.com", MatchDomain, true},
+		{"badexample.com", "www.example.com", MatchDomain, false},
+		{"mail.example.co.uk", "www.example.co.uk", MatchDomain, true},
+		{"example.co.uk", "www.example.co.uk", MatchDomain, true},
+		{"other.co.uk", "www.example.co.uk", MatchDomain, false},
+		{"co.uk", "www.example.co.uk", MatchDomain, false},
+		// public suffixes use exact match
+		{"co.uk", "co.uk", MatchDomain, true},
+		{"example.co.uk", "co.uk", MatchDomain, false},
+		{"github.io", "github.io", MatchDomain, true},
+		{"user.github.io", "github.io", MatchDomain, false},
+		// private suffixes of the list
+		{"www.user.github.io", "user.github.io", MatchDomain, true},
+		{"user.github.io", "www.user.github.io", MatchDomain, true},
+		{"other.github.io", "user.github.io", MatchDomain, false},
+		{"gist.github.com", "github.com", MatchDomain, true},
+		// names without registrable domain
+		{"localhost", "localhost", MatchDomain, true},
+		{"www.localhost", "localhost", MatchDomain, false},
+		// case insensitive
+		{"www.example.com", "WWW.Example.com", MatchExact, true},
+		{"WWW.Example.COM", "www.example.com", MatchExact, true},
+		{"www.example.com", "Example.com", MatchSubdomain, true},
+		{"Mail.Example.com", "www.EXAMPLE.com", MatchDomain, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String()+"/"+tt.query+"/"+tt.name, func(t *testing.T) {
+			if got := MatchName(tt.name, tt.query, tt.mode); got != tt.want {
+				t.Errorf("MatchName(%q, %q, %v) = %v, want %v", tt.name, tt.query, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheMatchWith(t *testing.T) {
+	c := NewCache(time.Hour, DefaultLimits())
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	now := time.Now()
+	c.Set(now.Add(-time.Minute), client, "cdn.user.github.io", []net.IP{resolved})
+	c.Set(now, client, "WWW.Example.co.uk", []net.IP{resolved})
+	tests := []struct {
+		query string
+		mode  MatchMode
+		want  string
+	}{
+		{"www.example.co.uk", MatchExact, "www.example.co.uk"},
+		{"example.co.uk", MatchExact, ""},
+		{"example.co.uk", MatchSubdomain, "www.example.co.uk"},
+		{"mail.example.co.uk", MatchDomain, "www.example.co.uk"},
+		{"co.uk", MatchDomain, ""},
+		{"user.github.io", MatchDomain, "cdn.user.github.io"},
+		{"other.github.io", MatchDomain, ""},
+		// names are stored in lower case
+		{"www.EXAMPLE.co.uk", MatchExact, "www.example.co.uk"},
+		{"Example.Co.UK", MatchSubdomain, "www.example.co.uk"},
+		{"User.GitHub.io", MatchDomain, "cdn.user.github.io"},
+		// the newest name is returned
+		{"", MatchSubdomain, "www.example.co.uk"},
+	}
+	for _, tt := range tests {
+		m := c.MatchWith(client, resolved, tt.query, tt.mode)
+		if m.Result != (tt.want != "") || m.Name != tt.want {
+			t.Errorf("MatchWith(%q, %v) = %v %q, want %q", tt.query, tt.mode, m.Result, m.Name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/luids-io/api/dnsutil"
+)
+
+const (
+	metricsNamespace = "luids"
+	metricsSubsystem = "resolvcache"
+)
+
+// namesNodeBuckets are the buckets of the names per node histogram
+var namesNodeBuckets = []float64{1, 2, 4, 8, 16, 32, 64}
+
+// metrics implements a prometheus collector for the service. Counters are
+// updated by the service, cache values are computed on each scrape.
+type metrics struct {
+	// atomic counters, must be 64-bit aligned
+	collects      uint64
+	checks        uint64
+	hits          uint64
+	store         Store
+	errors        *prometheus.CounterVec
+	cleanDuration prometheus.Histogram
+	dumpDuration  prometheus.Histogram
+	// descriptions for values computed
+	collectsDesc *prometheus.Desc
+	checksDesc   *prometheus.Desc
+	hitsDesc     *prometheus.Desc
+	clients      *prometheus.Desc
+	blocks       *prometheus.Desc
+	nodes        *prometheus.Desc
+	names        *prometheus.Desc
+	namesNode    *prometheus.Desc
+	memory       *prometheus.Desc
+	evicted      *prometheus.Desc
+	evictBlocks  *prometheus.Desc
+	evictNames   *prometheus.Desc
+	negatives    *prometheus.Desc
+	hitRatio     *prometheus.Desc
+}
+
+func newMetrics(st Store) *metrics {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, metricsSubsystem, name), help, nil, nil)
+	}
+	return &metrics{
+		store: st,
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "collect_errors_total",
+			Help:      "Counter of collect errors by type.",
+		}, []string{"error"}),
+		cleanDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "clean_duration_seconds",
+			Help:      "Histogram of the time spent cleaning the cache.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		dumpDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: metricsSubsystem,
+			Name:      "dump_duration_seconds",
+			Help:      "Histogram of the time spent dumping the cache.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+		}),
+		collectsDesc: desc("collects_total", "Counter of collect requests."),
+		checksDesc:   desc("checks_total", "Counter of check requests."),
+		hitsDesc:     desc("check_hits_total", "Counter of check requests with positive result."),
+		clients:      desc("clients", "Number of clients in the cache."),
+		blocks:       desc("blocks", "Number of blocks in use."),
+		nodes:        desc("nodes", "Number of nodes in use."),
+		names:        desc("names", "Number of names stored in nodes."),
+		namesNode:    desc("names_per_node", "Histogram of the number of names stored per node."),
+		memory:       desc("memory_bytes", "Approximate memory used by blocks."),
+		evicted:      desc("evicted_clients_total", "Counter of clients evicted."),
+		evictBlocks:  desc("overflow_evicted_blocks_total", "Counter of blocks evicted by the overflow policy."),
+		evictNames:   desc("overflow_evicted_names_total", "Counter of names evicted by the overflow policy."),
+		negatives: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "negative_answers_total"),
+			"Counter of negative answers collected by rcode.", []string{"rcode"}, nil),
+		hitRatio: desc("check_hit_ratio", "Ratio of checks with positive result since start."),
+	}
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.errors, m.cleanDuration, m.dumpDuration}
+}
+
+// Describe implements prometheus.Collector.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+	ch <- m.collectsDesc
+	ch <- m.checksDesc
+	ch <- m.hitsDesc
+	ch <- m.clients
+	ch <- m.blocks
+	ch <- m.nodes
+	ch <- m.names
+	ch <- m.namesNode
+	ch <- m.memory
+	ch <- m.evicted
+	ch <- m.evictBlocks
+	ch <- m.evictNames
+	ch <- m.negatives
+	ch <- m.hitRatio
+}
+
+// Collect implements prometheus.Collector.
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+	collects := atomic.LoadUint64(&m.collects)
+	checks := atomic.LoadUint64(&m.checks)
+	hits := atomic.LoadUint64(&m.hits)
+	ch <- prometheus.MustNewConstMetric(m.collectsDesc, prometheus.CounterValue, float64(collects))
+	ch <- prometheus.MustNewConstMetric(m.checksDesc, prometheus.CounterValue, float64(checks))
+	ch <- prometheus.MustNewConstMetric(m.hitsDesc, prometheus.CounterValue, float64(hits))
+	st := m.store.Stats()
+	ch <- prometheus.MustNewConstMetric(m.clients, prometheus.GaugeValue, float64(st.Clients))
+	ch <- prometheus.MustNewConstMetric(m.blocks, prometheus.GaugeValue, float64(st.Blocks))
+	ch <- prometheus.MustNewConstMetric(m.nodes, prometheus.GaugeValue, float64(st.Nodes))
+	ch <- prometheus.MustNewConstMetric(m.names, prometheus.GaugeValue, float64(st.Names))
+	ch <- prometheus.MustNewConstMetric(m.memory, prometheus.GaugeValue, float64(st.Memory))
+	ch <- prometheus.MustNewConstMetric(m.evicted, prometheus.CounterValue, float64(st.Evicted))
+	ch <- prometheus.MustNewConstMetric(m.evictBlocks, prometheus.CounterValue, float64(st.EvictedBlocks))
+	ch <- prometheus.MustNewConstMetric(m.evictNames, prometheus.CounterValue, float64(st.EvictedNames))
+	ch <- prometheus.MustNewConstMetric(m.negatives, prometheus.CounterValue, float64(st.NXDomain), NXDomain.String())
+	ch <- prometheus.MustNewConstMetric(m.negatives, prometheus.CounterValue, float64(st.NoData), NoData.String())
+	// names per node
+	buckets := make(map[float64]uint64, len(namesNodeBuckets))
+	for i, count := range st.NamesNode {
+		for _, b := range namesNodeBuckets {
+			if float64(i+1) <= b {
+				buckets[b] += uint64(count)
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstHistogram(m.namesNode, uint64(st.Nodes), float64(st.Names), buckets)
+	// hit ratio
+	ratio := 0.0
+	if checks > 0 {
+		ratio = float64(hits) / float64(checks)
+	}
+	ch <- prometheus.MustNewConstMetric(m.hitRatio, prometheus.GaugeValue, ratio)
+}
+
+func (m *metrics) collect(err error) {
+	atomic.AddUint64(&m.collects, 1)
+	switch err {
+	case nil:
+	case dnsutil.ErrLimitDNSClientQueries:
+		m.errors.WithLabelValues("limit_client_queries").Inc()
+	case dnsutil.ErrLimitResolvedNamesIP:
+		m.errors.WithLabelValues("limit_names_ip").Inc()
+	default:
+		m.errors.WithLabelValues("other").Inc()
+	}
+}
+
+func (m *metrics) check(result bool) {
+	atomic.AddUint64(&m.checks, 1)
+	if result {
+		atomic.AddUint64(&m.hits, 1)
+	}
+}
+
+func (m *metrics) clean(d time.Duration) {
+	m.cleanDuration.Observe(d.Seconds())
+}
+
+func (m *metrics) dump(d time.Duration) {
+	m.dumpDuration.Observe(d.Seconds())
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Negative defines the type of a negative answer.
+type Negative int
+
+// Negative answers.
+const (
+	// Positive is not a negative answer
+	Positive Negative = iota
+	// NXDomain is an answer with rcode NXDOMAIN
+	NXDomain
+	// NoData is an answer with rcode NOERROR and no records of the type
+	// queried
+	NoData
+)
+
+// ToNegative returns the negative answer from a string.
+func ToNegative(s string) (Negative, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return Positive, nil
+	case "nxdomain":
+		return NXDomain, nil
+	case "nodata":
+		return NoData, nil
+	}
+	return Positive, fmt.Errorf("invalid negative answer '%s'", s)
+}
+
+func (n Negative) String() string {
+	switch n {
+	case NXDomain:
+		return "nxdomain"
+	case NoData:
+		return "nodata"
+	}
+	return ""
+}
+
+// defaultFailures is the default number of failed names stored per client.
+const defaultFailures = 32
+
+// KeepFailures option sets the number of recent failed names stored for
+// each client.
+func KeepFailures(n int) CacheOption {
+	return func(o *cacheOptions) {
+		if n > 0 {
+			o.failures = n
+		}
+	}
+}
+
+// FailedName stores a name with a negative answer and its last time.
+type FailedName struct {
+	Name     string
+	Last     time.Time
+	Negative Negative
+}
+
+// FailureInfo stores the negative answers received by a client. Counters
+// are from the first query of the client in the cache and Recent stores
+// the failed names not expired, newest first.
+type FailureInfo struct {
+	Client   *net.IPNet
+	NXDomain uint64
+	NoData   uint64
+	Recent   []FailedName
+}
+
+// failureLog stores the recent failed names of a client in a ring buffer.
+type failureLog struct {
+	mu    sync.Mutex
+	names []FailedName
+	next  int
+}
+
+var errEmptyName = errors.New("name is empty")
+
+// insertNegative stores the negative answer of the resolution.
+func (o *Cache) insertNegative(c *clientBlock, ts time.Time, r Resolution) error {
+	if r.Name == "" {
+		return errEmptyName
+	}
+	switch r.Negative {
+	case NXDomain:
+		atomic.AddUint64(&c.nxdomain, 1)
+		atomic.AddUint64(&o.nxdomain, 1)
+	case NoData:
+		atomic.AddUint64(&c.nodata, 1)
+		atomic.AddUint64(&o.nodata, 1)
+	default:
+		return fmt.Errorf("invalid negative answer '%v'", r.Negative)
+	}
+	c.touch(ts)
+	c.failed.add(FailedName{Name: r.Name, Last: ts, Negative: r.Negative}, o.failures)
+	return nil
+}
+
+// add inserts the failed name, replacing the oldest if the log is full.
+func (l *failureLog) add(f FailedName, size int) {
+	l.mu.Lock()
+	if len(l.names) < size {
+		l.names = append(l.names, f)
+	} else {
+		l.names[l.next] = f
+		l.next = (l.next + 1) % size
+	}
+	l.mu.Unlock()
+}
+
+// recent returns the failed names from the time, newest first. Repeated
+// names are returned once with the last time.
+func (l *failureLog) recent(from time.Time) []FailedName {
+	l.mu.Lock()
+	found := make(map[string]FailedName, len(l.names))
+	for _, f := range l.names {
+		if f.Last.Before(from) {
+			continue
+		}
+		if prev, ok := found[f.Name]; ok && prev.Last.After(f.Last) {
+			continue
+		}
+		found[f.Name] = f
+	}
+	l.mu.Unlock()
+	if len(found) == 0 {
+		return nil
+	}
+	list := make([]FailedName, 0, len(found))
+	for _, f := range found {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Last.After(list[j].Last) })
+	return list
+}
+
+// Failures returns the negative answers received by the client.
+func (o *Cache) Failures(client net.IP) (FailureInfo, bool) {
+	c, ok := o.findClientBlock(o.clientKey(client))
+	if !ok {
+		return FailureInfo{}, false
+	}
+	return c.failures(time.Now().Add(-o.Expires())), true
+}
+
+func (c *clientBlock) failures(from time.Time) FailureInfo {
+	return FailureInfo{
+		Client:   c.network,
+		NXDomain: atomic.LoadUint64(&c.nxdomain),
+		NoData:   atomic.LoadUint64(&c.nodata),
+		Recent:   c.failed.recent(from),
+	}
+}
+
+// NXDomains returns the number of NXDOMAIN answers collected.
+func (o *Cache) NXDomains() uint64 {
+	return atomic.LoadUint64(&o.nxdomain)
+}
+
+// NoDatas returns the number of NODATA answers collected.
+func (o *Cache) NoDatas() uint64 {
+	return atomic.LoadUint64(&o.nodata)
+}
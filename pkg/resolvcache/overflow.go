@@ -0,0 +1,134 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// OverflowPolicy defines the behaviour when a client reaches the limits of
+// blocks or names per resolved ip.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	// OverflowError rejects new resolutions with an error
+	OverflowError OverflowPolicy = iota
+	// OverflowEvict evicts the oldest block of the client or the oldest
+	// name of the resolved ip, so the newest resolutions are stored
+	OverflowEvict
+)
+
+// ToOverflowPolicy returns the overflow policy from a string.
+func ToOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "error":
+		return OverflowError, nil
+	case "evict", "fifo":
+		return OverflowEvict, nil
+	}
+	return OverflowError, fmt.Errorf("invalid overflow policy '%s'", s)
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowError:
+		return "error"
+	case OverflowEvict:
+		return "evict"
+	}
+	return ""
+}
+
+// SetOverflow option sets the policy used when a client reaches its limits.
+func SetOverflow(p OverflowPolicy) CacheOption {
+	return func(o *cacheOptions) {
+		o.overflow = p
+	}
+}
+
+// Overflow returns the overflow policy of the cache.
+func (o *Cache) Overflow() OverflowPolicy {
+	return o.overflow
+}
+
+// ClientOverflow stores the evictions of a client caused by the overflow
+// policy.
+type ClientOverflow struct {
+	Client *net.IPNet
+	Blocks uint64
+	Names  uint64
+}
+
+// EvictedBlocks returns the number of blocks evicted by the overflow policy.
+func (o *Cache) EvictedBlocks() uint64 {
+	return atomic.LoadUint64(&o.evictedBlocks)
+}
+
+// EvictedNames returns the number of names evicted by the overflow policy.
+func (o *Cache) EvictedNames() uint64 {
+	return atomic.LoadUint64(&o.evictedNames)
+}
+
+// Overflows returns the clients in the cache with evictions, most evicted
+// first.
+func (o *Cache) Overflows() []ClientOverflow {
+	list := make([]ClientOverflow, 0)
+	for _, e := range o.clientList() {
+		if co, ok := e.client.overflow(); ok {
+			list = append(list, co)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Blocks+list[i].Names > list[j].Blocks+list[j].Names
+	})
+	return list
+}
+
+func (c *clientBlock) overflow() (ClientOverflow, bool) {
+	co := ClientOverflow{
+		Client: c.network,
+		Blocks: atomic.LoadUint64(&c.evictedBlocks),
+		Names:  atomic.LoadUint64(&c.evictedNames),
+	}
+	return co, co.Blocks > 0 || co.Names > 0
+}
+
+// evictBlock removes the oldest block of the client. Caller must hold the
+// lock.
+func (c *clientBlock) evictBlock() {
+	c.blocks[0].drop()
+	copy(c.blocks, c.blocks[1:])
+	c.blocks[len(c.blocks)-1] = nil
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	if !c.evicted {
+		atomic.AddInt64(&c.cache.nblocks, -1)
+	}
+	atomic.AddUint64(&c.evictedBlocks, 1)
+	atomic.AddUint64(&c.cache.evictedBlocks, 1)
+}
+
+func (c *clientBlock) evictName() {
+	atomic.AddUint64(&c.evictedNames, 1)
+	atomic.AddUint64(&c.cache.evictedNames, 1)
+}
+
+// evictOldest replaces the oldest item of the node with i. If i is older
+// than all items, it's discarded and returns false.
+func (n *node) evictOldest(i item) bool {
+	oldest := &n.item
+	for j := range n.others {
+		if n.others[j].ts.Before(oldest.ts) {
+			oldest = &n.others[j]
+		}
+	}
+	if i.ts.Before(oldest.ts) {
+		return false
+	}
+	*oldest = i
+	return true
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOverflowEvictNames(t *testing.T) {
+	limits := DefaultLimits()
+	limits.MaxNamesNode = 2
+	c := NewCache(time.Hour, limits, SetOverflow(OverflowEvict))
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	base := time.Now().Add(-time.Minute)
+	set := func(d time.Duration, name string) {
+		t.Helper()
+		if err := c.Set(base.Add(d), client, name, []net.IP{resolved}); err != nil {
+			t.Fatalf("set %s: %v", name, err)
+		}
+	}
+	set(0, "a.example.com")
+	set(time.Second, "b.example.com")
+	set(2*time.Second, "c.example.com")
+	if c.EvictedNames() != 0 {
+		t.Fatalf("EvictedNames() = %v, want 0", c.EvictedNames())
+	}
+	// the oldest name is replaced
+	set(3*time.Second, "d.example.com")
+	if c.EvictedNames() != 1 {
+		t.Errorf("EvictedNames() = %v, want 1", c.EvictedNames())
+	}
+	if ok, _ := c.Get(client, resolved, "a.example.com"); ok {
+		t.Errorf("oldest name not evicted")
+	}
+	// a resolution older than all names stored is discarded
+	set(-time.Second, "old.example.com")
+	if c.EvictedNames() != 1 {
+		t.Errorf("EvictedNames() = %v after discarding, want 1", c.EvictedNames())
+	}
+	if ok, _ := c.Get(client, resolved, "old.example.com"); ok {
+		t.Errorf("discarded name stored")
+	}
+	for _, name := range []string{"b.example.com", "c.example.com", "d.example.com"} {
+		if ok, _ := c.Get(client, resolved, name); !ok {
+			t.Errorf("name %s not found", name)
+		}
+	}
+	list := c.Overflows()
+	if len(list) != 1 || list[0].Names != 1 || list[0].Blocks != 0 {
+		t.Errorf("Overflows() = %+v", list)
+	}
+}
+
+func TestOverflowEvictBlocks(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 4
+	limits.MaxBlocksClient = 2
+	c := NewCache(time.Hour, limits, SetOverflow(OverflowEvict))
+	client := net.ParseIP("10.0.0.1")
+	resolved := benchIPs(192, 20)
+	base := time.Now().Add(-time.Minute)
+	for i, ip := range resolved {
+		if err := c.Set(base.Add(time.Duration(i)*time.Second), client, "www.example.com", []net.IP{ip}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if c.EvictedBlocks() == 0 {
+		t.Fatalf("no blocks evicted")
+	}
+	if ok, _ := c.Get(client, resolved[len(resolved)-1], "www.example.com"); !ok {
+		t.Errorf("newest resolution not found")
+	}
+	if ok, _ := c.Get(client, resolved[0], "www.example.com"); ok {
+		t.Errorf("oldest resolution not evicted")
+	}
+	checkAccounting(t, c)
+}
+
+func TestOverflowError(t *testing.T) {
+	limits := DefaultLimits()
+	limits.MaxNamesNode = 1
+	c := NewCache(time.Hour, limits)
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	now := time.Now()
+	c.Set(now, client, "a.example.com", []net.IP{resolved})
+	c.Set(now, client, "b.example.com", []net.IP{resolved})
+	if err := c.Set(now, client, "c.example.com", []net.IP{resolved}); err == nil {
+		t.Errorf("set over the limit without error")
+	}
+	if c.EvictedNames() != 0 {
+		t.Errorf("EvictedNames() = %v, want 0", c.EvictedNames())
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+// LimitProfile overrides the limits per client for the clients in a
+// network. Zero values use the limits of the cache.
+type LimitProfile struct {
+	Network         *net.IPNet
+	MaxBlocksClient int
+	MaxNamesNode    int
+}
+
+// Validate checks the profile values.
+func (p LimitProfile) Validate() error {
+	if p.Network == nil {
+		return errors.New("network is required")
+	}
+	if p.MaxBlocksClient < 0 || p.MaxNamesNode < 0 {
+		return errors.New("invalid limits")
+	}
+	return nil
+}
+
+// LimitProfiles option sets the limit profiles applied to the clients. If
+// several networks contain a client, the most specific is used.
+func LimitProfiles(p ...LimitProfile) CacheOption {
+	return func(o *cacheOptions) {
+		o.profiles = append(o.profiles, p...)
+	}
+}
+
+// ClientLimits returns the limits applied to the client.
+func (o *Cache) ClientLimits(ip net.IP) Limits {
+	return o.clientLimits(o.ClientNet(ip))
+}
+
+// clientLimits returns the limits with the profile of the client network.
+func (o *Cache) clientLimits(network *net.IPNet) Limits {
+	limits := o.limits
+	for _, p := range o.profiles {
+		if !p.Network.Contains(network.IP) {
+			continue
+		}
+		if p.MaxBlocksClient > 0 {
+			limits.MaxBlocksClient = p.MaxBlocksClient
+		}
+		if p.MaxNamesNode > 0 {
+			limits.MaxNamesNode = p.MaxNamesNode
+		}
+		break
+	}
+	return limits
+}
+
+// maxNamesNode returns the max names per node of all the profiles.
+func (o *Cache) maxNamesNode() int {
+	max := o.limits.MaxNamesNode
+	for _, p := range o.profiles {
+		if p.MaxNamesNode > max {
+			max = p.MaxNamesNode
+		}
+	}
+	return max
+}
+
+// sortProfiles returns a copy of the profiles, most specific first.
+func sortProfiles(profiles []LimitProfile) []LimitProfile {
+	if len(profiles) == 0 {
+		return nil
+	}
+	sorted := make([]LimitProfile, len(profiles))
+	copy(sorted, profiles)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		oi, _ := sorted[i].Network.Mask.Size()
+		oj, _ := sorted[j].Network.Mask.Size()
+		return oi > oj
+	})
+	return sorted
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/luids-io/dns/pkg/resolvcache/tracelog"
+)
+
+// ReplayStats stores the result of a trace log replay.
+type ReplayStats struct {
+	// Collects read from the trace log
+	Collects int
+	// Stored in the cache
+	Stored int
+	// Expired collects discarded
+	Expired int
+	// Invalid lines skipped
+	Invalid int
+}
+
+// Replay reads the collects of a trace log and inserts them in the cache
+// with their original timestamps. Collects expired are discarded. Trace
+// logs don't store ttls, so records use the expiration of the cache.
+func (o *Cache) Replay(in io.Reader) (ReplayStats, error) {
+	var st ReplayStats
+	now := time.Now()
+	invalid, err := tracelog.ReadCollects(in, func(c tracelog.Collect) bool {
+		st.Collects++
+		if now.Sub(c.Ts) > o.Expires() {
+			st.Expired++
+			return true
+		}
+		err := o.Insert(c.Ts, Resolution{
+			Client:   c.Client.IP,
+			Name:     c.Name,
+			CNAMEs:   c.CNAMEs,
+			Resolved: c.Resolved,
+		})
+		if err == nil {
+			st.Stored++
+		}
+		return true
+	})
+	st.Invalid = invalid
+	return st, err
+}
+
+// ReplayFile replays the trace log file in the cache.
+func (o *Cache) ReplayFile(filename string) (ReplayStats, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	defer file.Close()
+	return o.Replay(file)
+}
+
+// ReplayTrace option replays the trace log files on start, after loading
+// the snapshot.
+func ReplayTrace(files ...string) Option {
+	return func(o *options) {
+		o.replayFiles = append(o.replayFiles, files...)
+	}
+}
+
+func (s *Service) replayTrace(filename string) error {
+	st, err := s.cache.ReplayFile(filename)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("replayed %s: %v collects, %v stored, %v expired, %v invalid lines",
+		filename, st.Collects, st.Stored, st.Expired, st.Invalid)
+	return nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/luids-io/api/dnsutil"
+	"github.com/luids-io/core/yalogi"
+)
+
+// Record stores a resolution and the time it was collected. Records sent
+// in the catch-up of a peer also store the first resolution of the current
+// period and the previous periods, oldest first, so the peer can answer
+// checks at a point in time and history queries. Since is zero in the
+// records collected.
+type Record struct {
+	Ts    time.Time
+	Since time.Time
+	Past  []Period
+	Resolution
+}
+
+// Period stores a previous period of resolution of a record.
+type Period struct {
+	Since time.Time
+	Last  time.Time
+	TTL   time.Duration
+}
+
+// Peer is the interface for the replication of records between cache
+// instances. Origin is the instance that sends the records and it returns
+// the instance of the peer, that changes when the peer restarts. Records
+// received are not replicated again.
+type Peer interface {
+	Replicate(ctx context.Context, origin string, records []Record) (string, error)
+}
+
+// Records calls fn for each resolution stored until it returns false.
+// Resolutions expired by their ttl are included while the cache stores
+// them, so peers receive their history. Resolutions through cnames are
+// returned once, from the name queried. Clients are locked one at a time
+// and fn is called unlocked.
+func (o *Cache) Records(fn func(Record) bool) {
+	now := time.Now()
+	for _, e := range o.clientList() {
+		client := e.client
+		records := make([]Record, 0)
+		add := func(key ipKey, i item) {
+			if now.Sub(i.ts) > o.Expires() {
+				return
+			}
+			r := Record{Ts: i.ts, Since: i.since, Resolution: Resolution{
+				Client:   client.network.IP,
+				Name:     i.name,
+				Resolved: []net.IP{key.IP()},
+			}}
+			for _, p := range i.past {
+				r.Past = append(r.Past, Period{Since: p.since, Last: p.ts, TTL: p.ttl})
+			}
+			if len(i.chain) > 0 {
+				if i.chain[0] != i.name {
+					return
+				}
+				r.CNAMEs = i.chain[1:]
+			}
+			if i.ttl > 0 {
+				r.TTLs = []time.Duration{i.ttl}
+			}
+			records = append(records, r)
+		}
+		client.mu.RLock()
+		for _, b := range client.blocks {
+			b.mu.RLock()
+			for k, idx := range b.index {
+				n := &b.nodes[idx]
+				if n.name == "" {
+					continue
+				}
+				add(k, n.item)
+				for _, i := range n.others {
+					add(k, i)
+				}
+			}
+			b.mu.RUnlock()
+		}
+		client.mu.RUnlock()
+		for _, r := range records {
+			if !fn(r) {
+				return
+			}
+		}
+	}
+}
+
+// Instance returns the identifier of the service used in replication, it
+// changes on each execution.
+func (s *Service) Instance() string {
+	return s.instance
+}
+
+// Replicate implements Peer interface. Records expired or sent by this
+// instance are ignored.
+func (s *Service) Replicate(ctx context.Context, origin string, records []Record) (string, error) {
+	if !s.started {
+		return "", dnsutil.ErrUnavailable
+	}
+	if origin == s.instance {
+		return s.instance, nil
+	}
+	now := time.Now()
+	failed := 0
+	for _, r := range records {
+		if r.Ts.After(now) {
+			r.Ts = now
+		}
+		if r.Client == nil || r.Name == "" || len(r.Resolved) == 0 || now.Sub(r.Ts) > s.store.Expires() {
+			failed++
+			continue
+		}
+		var err error
+		if s.cache != nil && (!r.Since.IsZero() || len(r.Past) > 0) {
+			err = s.cache.insertRecord(r)
+		} else {
+			err = s.insert(r.Ts, r.Resolution)
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		s.logger.Debugf("replicate from %s: %v of %v records not stored", origin, failed, len(records))
+	}
+	return s.instance, nil
+}
+
+// insertRecord stores the record with its periods of resolution, aliases
+// are stored with the periods of the name queried. Periods expired or
+// exceeding the history are discarded.
+func (o *Cache) insertRecord(r Record) error {
+	since := r.Since
+	if since.IsZero() || since.After(r.Ts) {
+		since = r.Ts
+	}
+	var past []period
+	for _, p := range r.Past {
+		if p.Since.After(p.Last) || !p.Last.Before(since) || time.Since(p.Last) > o.Expires() {
+			continue
+		}
+		ttl := p.TTL
+		if !o.ttl.enabled {
+			ttl = 0
+		}
+		past = o.addPeriod(past, period{since: p.Since, ts: p.Last, ttl: ttl})
+	}
+	if len(past) > o.history {
+		past = past[len(past)-o.history:]
+	}
+	key := o.clientKey(r.Client)
+	err := o.insertPeriods(o.getClientBlock(key, r.Client), key, r.Ts, r.Resolution, since, past)
+	if o.overMemory() {
+		o.evictMemory()
+	}
+	return err
+}
+
+// replicate queues the record to all peers.
+func (s *Service) replicate(r Record) {
+	for _, p := range s.replicas {
+		p.enqueue(r)
+	}
+}
+
+func newInstanceID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+var (
+	errPeerRestarted = errors.New("peer has restarted")
+	errReplicaClosed = errors.New("replica closed")
+)
+
+// replicaRetry is the interval used for reconnecting and for checking
+// idle peers.
+const replicaRetry = 5 * time.Second
+
+// replicaTimeout is the timeout of the replication requests.
+const replicaTimeout = 10 * time.Second
+
+// replicator sends batches of records to a peer. When the peer is not
+// synced, queued records are discarded and all the content of the cache is
+// sent once the peer is available (catch-up).
+type replicator struct {
+	// overflow is accessed atomically
+	overflow int32
+	name     string
+	peer     Peer
+	origin   string
+	cache    *Cache
+	logger   yalogi.Logger
+	queue    chan Record
+	size     int
+	wait     time.Duration
+	// state used by the run goroutine
+	instance string
+	synced   bool
+	lastSend time.Time
+	lastTry  time.Time
+}
+
+func (r *replicator) enqueue(rec Record) {
+	select {
+	case r.queue <- rec:
+	default:
+		atomic.StoreInt32(&r.overflow, 1)
+	}
+}
+
+func (r *replicator) run(close <-chan struct{}) {
+	ticker := time.NewTicker(r.wait)
+	defer ticker.Stop()
+	batch := make([]Record, 0, r.size)
+	for {
+		select {
+		case <-close:
+			if r.synced && len(batch) > 0 {
+				r.send(batch)
+			}
+			return
+		case rec := <-r.queue:
+			batch = append(batch, rec)
+			if len(batch) < r.size {
+				continue
+			}
+		case <-ticker.C:
+		}
+		if atomic.SwapInt32(&r.overflow, 0) == 1 && r.synced {
+			r.logger.Warnf("replica %s: queue is full, records discarded", r.name)
+			r.synced = false
+		}
+		if !r.synced {
+			// records queued are in the cache, catch-up will send them
+			batch = batch[:0]
+			if time.Since(r.lastTry) >= replicaRetry {
+				r.lastTry = time.Now()
+				r.catchup(close)
+			}
+			continue
+		}
+		if len(batch) == 0 && time.Since(r.lastSend) < replicaRetry {
+			continue
+		}
+		r.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send records to the peer, an empty batch checks the peer.
+func (r *replicator) send(batch []Record) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+	instance, err := r.peer.Replicate(ctx, r.origin, batch)
+	r.lastSend = time.Now()
+	if err != nil {
+		r.logger.Warnf("replica %s: sending %v records: %v", r.name, len(batch), err)
+		r.synced = false
+		return
+	}
+	if instance != r.instance {
+		r.logger.Infof("replica %s: peer has restarted", r.name)
+		r.synced = false
+		r.lastTry = time.Time{}
+	}
+}
+
+// catchup sends all the cache content to the peer.
+func (r *replicator) catchup(close <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	instance, err := r.peer.Replicate(ctx, r.origin, nil)
+	cancel()
+	if err != nil {
+		r.logger.Debugf("replica %s: %v", r.name, err)
+		return
+	}
+	r.instance = instance
+	atomic.StoreInt32(&r.overflow, 0)
+	// send cache content
+	sent := 0
+	batch := make([]Record, 0, r.size)
+	flush := func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		defer cancel()
+		instance, err = r.peer.Replicate(ctx, r.origin, batch)
+		if err == nil && instance != r.instance {
+			err = errPeerRestarted
+		}
+		sent += len(batch)
+		batch = batch[:0]
+		return err == nil
+	}
+	r.cache.Records(func(rec Record) bool {
+		select {
+		case <-close:
+			err = errReplicaClosed
+			return false
+		default:
+		}
+		batch = append(batch, rec)
+		if len(batch) < r.size {
+			return true
+		}
+		return flush()
+	})
+	if err == nil && len(batch) > 0 {
+		flush()
+	}
+	if err != nil {
+		r.logger.Warnf("replica %s: catch-up: %v", r.name, err)
+		return
+	}
+	r.lastSend = time.Now()
+	r.synced = true
+	r.logger.Infof("replica %s: catch-up completed, %v records sent", r.name, sent)
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReplicaCatchupHistory(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+	orig := snapCache()
+	snapFill(t, orig, base)
+
+	peer := NewService(snapCache())
+	if err := peer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Shutdown()
+
+	var records []Record
+	orig.Records(func(r Record) bool {
+		records = append(records, r)
+		return true
+	})
+	// aliases are sent in the record of the name queried
+	if len(records) != 3 {
+		t.Fatalf("Records() = %v records, want 3", len(records))
+	}
+	for _, r := range records {
+		if r.Since.IsZero() {
+			t.Errorf("record %s without since", r.Name)
+		}
+	}
+	if _, err := peer.Replicate(context.Background(), "orig", records); err != nil {
+		t.Fatalf("Replicate() = %v", err)
+	}
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "2001:db8::1"} {
+		ip := net.ParseIP(client)
+		want := orig.History(ip, time.Time{}, base)
+		got := peer.cache.History(ip, time.Time{}, base)
+		if !sameHistory(got, want) {
+			t.Errorf("client %s history = %v, want %v", client, got, want)
+		}
+	}
+	// checks at a point in time of a past period
+	at := base.Add(-29*time.Minute - 30*time.Second)
+	m := peer.cache.MatchAt(net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1"), "www.example.com", MatchExact, at)
+	if !m.Result || !m.Since.Equal(base.Add(-30*time.Minute)) {
+		t.Errorf("MatchAt() = %+v", m)
+	}
+}
+
+func TestReplicaRecordWithoutPeriods(t *testing.T) {
+	peer := NewService(snapCache())
+	if err := peer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Shutdown()
+	now := time.Now()
+	r := Record{Ts: now, Resolution: Resolution{
+		Client:   net.ParseIP("10.0.0.1"),
+		Name:     "www.example.com",
+		Resolved: []net.IP{net.ParseIP("192.0.2.1")},
+	}}
+	if _, err := peer.Replicate(context.Background(), "orig", []Record{r}); err != nil {
+		t.Fatalf("Replicate() = %v", err)
+	}
+	m := peer.cache.Match(r.Client, r.Resolved[0], r.Name)
+	if !m.Result || !m.Since.Equal(m.Last) {
+		t.Errorf("Match() = %+v", m)
+	}
+}
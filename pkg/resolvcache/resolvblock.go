@@ -3,7 +3,7 @@
 package resolvcache
 
 import (
-	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,14 +12,18 @@ import (
 
 // stores resolved ips and names
 type resolvBlock struct {
-	cache *Cache
-	mu    sync.RWMutex
-	last  time.Time
+	cache  *Cache
+	client *clientBlock
+	mu     sync.RWMutex
+	last   time.Time
 	// index map[ip]idx node
-	index map[string]int
+	index map[ipKey]int
 	nodes []node
 	// next stores next free node
 	next int
+	// dropped is true if the block was removed from the client, inserts
+	// must use another block
+	dropped bool
 }
 
 // node in block struct
@@ -33,50 +37,71 @@ type node struct {
 }
 
 type item struct {
-	ts   time.Time
-	name string
+	ts time.Time
+	// since is the first resolution of the current period
+	since time.Time
+	name  string
+	// ttl of the dns record, zero if unknown
+	ttl time.Duration
+	// chain from the name queried to the last alias, nil if there are no
+	// aliases. It's shared by all items of the resolution.
+	chain []string
+	// past stores previous periods of resolution, oldest first
+	past []period
 }
 
 // BlockSize stores the number of nodes in blocks
 //const BlockSize = 512
 
-func (b *resolvBlock) doQuery(resolved net.IP, name string) (bool, time.Time) {
+func (b *resolvBlock) doQuery(key ipKey, m matcher, at time.Time) (item, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	//check the index for the resolved ip
-	idx, ok := b.index[getIPKey(resolved)]
+	idx, ok := b.index[key]
+	if ok {
+		return b.nodes[idx].query(m, at, b.cache)
+	}
+	return item{}, false
+}
+
+func (b *resolvBlock) lookup(key ipKey, found map[string]item) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	idx, ok := b.index[key]
 	if ok {
-		return b.nodes[idx].query(name, b.cache.expires)
+		b.nodes[idx].names(time.Now(), b.cache, found)
 	}
-	return false, time.Time{}
 }
 
 // insert returns true if inserted, false if block is full.
 // It returns an error if max domains per node has reached
-func (b *resolvBlock) insert(resolved net.IP, name string, ts time.Time) (bool, error) {
+func (b *resolvBlock) insert(key ipKey, i item) (bool, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-
-	max := b.cache.limits.MaxNamesNode
-	key := getIPKey(resolved)
+	if b.dropped {
+		return false, nil
+	}
 	// checks if it's a resolved ip
 	idx, ok := b.index[key]
 	if ok {
 		// update block last update
-		b.last = ts
+		b.touch(i.ts)
 		// update node
-		err := b.nodes[idx].update(name, ts, max)
+		evicted, err := b.nodes[idx].update(i, b.client)
 		if err != nil {
 			return false, err
 		}
+		if evicted {
+			b.client.evictName()
+		}
 		return true, nil
 	}
 	//check if block has space for next node
 	if b.next < b.cache.limits.BlockSize {
 		// update block last update
-		b.last = ts
+		b.touch(i.ts)
 		//adds node to block
-		b.nodes[b.next].update(name, ts, max)
+		b.nodes[b.next].update(i, b.client)
 		b.index[key] = b.next
 		b.next++
 		return true, nil
@@ -84,80 +109,174 @@ func (b *resolvBlock) insert(resolved net.IP, name string, ts time.Time) (bool,
 	return false, nil
 }
 
-func (b *resolvBlock) clean(d time.Duration) {
+// full returns true if block has no free nodes.
+func (b *resolvBlock) full() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.next >= b.cache.limits.BlockSize
+}
+
+// updated returns the last update of the block.
+func (b *resolvBlock) updated() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.last
+}
+
+// touch updates last update of the block if ts is newer
+func (b *resolvBlock) touch(ts time.Time) {
+	if ts.After(b.last) {
+		b.last = ts
+	}
+}
+
+// clean clears the nodes outdated and moves the nodes in use to the
+// beginning of the block, so its slots can be reused. It returns the
+// number of nodes in use.
+func (b *resolvBlock) clean(d time.Duration) int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	for i, n := range b.nodes {
-		//clear values of nodes outdated
-		if time.Since(n.last) > d {
-			b.nodes[i].name = ""
-			b.nodes[i].others = nil
+	live := make([]ipKey, 0, len(b.index))
+	for k, idx := range b.index {
+		if b.nodes[idx].name == "" || time.Since(b.nodes[idx].last) > d {
+			b.nodes[idx] = node{}
+			delete(b.index, k)
+			continue
+		}
+		live = append(live, k)
+	}
+	sort.Slice(live, func(i, j int) bool { return b.index[live[i]] < b.index[live[j]] })
+	for i, k := range live {
+		if idx := b.index[k]; idx != i {
+			b.nodes[i] = b.nodes[idx]
+			b.nodes[idx] = node{}
+			b.index[k] = i
 		}
 	}
+	b.next = len(live)
+	return len(live)
 }
 
-func (n *node) update(name string, ts time.Time, max int) error {
+// drop marks the block as removed.
+func (b *resolvBlock) drop() {
+	b.mu.Lock()
+	b.dropped = true
+	b.mu.Unlock()
+}
+
+// update stores the item in the node, items of the same name are added to
+// the periods of the item stored. It returns true if an item stored was
+// evicted by the overflow policy.
+func (n *node) update(i item, client *clientBlock) (bool, error) {
+	c := client.cache
+	max := client.limits.MaxNamesNode
 	// updates node last update
-	n.last = ts
+	if i.ts.After(n.last) {
+		n.last = i.ts
+	}
 	// if embedded item is empty
 	if n.name == "" {
-		n.ts = ts
-		n.name = name
-		return nil
-	} else if n.name == name {
-		n.ts = ts
-	} else {
-		// if embedded item not empty
-		if len(n.others) == 0 {
-			n.others = make([]item, 0, max)
-			n.others = append(n.others, item{name: name, ts: ts})
-			return nil
+		n.item = i
+		return false, nil
+	}
+	if n.name == i.name {
+		n.item.collect(i, c)
+		return false, nil
+	}
+	// if embedded item not empty
+	if len(n.others) == 0 {
+		n.others = make([]item, 0, max)
+		n.others = append(n.others, i)
+		return false, nil
+	}
+	// check if name already exists
+	for j, o := range n.others {
+		if o.name == i.name {
+			n.others[j].collect(i, c)
+			return false, nil
 		}
-		// check if name already exists
-		for i, o := range n.others {
-			if o.name == name {
-				n.others[i].ts = ts
-				return nil
-			}
+	}
+	// check limits
+	if len(n.others) >= max {
+		if c.overflow != OverflowEvict {
+			return false, dnsutil.ErrLimitResolvedNamesIP
+		}
+		return n.evictOldest(i), nil
+	}
+	// add new name
+	n.others = append(n.others, i)
+	return false, nil
+}
+
+// merge adds the items of the node o.
+func (n *node) merge(o node, c *clientBlock) {
+	n.update(o.item, c)
+	for _, i := range o.others {
+		n.update(i, c)
+	}
+	if o.last.After(n.last) {
+		n.last = o.last
+	}
+}
+
+func (n *node) names(now time.Time, c *Cache, found map[string]item) {
+	if n.name == "" || now.Sub(n.last) > c.Expires() {
+		return
+	}
+	add := func(i item) {
+		if !c.valid(i, now) {
+			return
 		}
-		// check limits
-		if len(n.others) >= max {
-			return dnsutil.ErrLimitResolvedNamesIP
+		if last, ok := found[i.name]; !ok || i.ts.After(last.ts) {
+			found[i.name] = i
 		}
-		// add new name
-		n.others = append(n.others, item{name: name, ts: ts})
 	}
-	return nil
+	add(n.item)
+	for _, o := range n.others {
+		add(o)
+	}
 }
 
-func (n *node) query(name string, expires time.Duration) (bool, time.Time) {
+// query returns the item not expired at the time for the name, if several
+// items match returns the newest. The item returned has the period that
+// contains the time.
+func (n *node) query(m matcher, at time.Time, c *Cache) (item, bool) {
 	// check node expired
-	if time.Since(n.last) > expires {
-		return false, time.Time{}
+	if at.Sub(n.last) > c.Expires() {
+		return item{}, false
 	}
 	// value was cleaned
 	if n.name == "" {
-		return false, time.Time{}
+		return item{}, false
 	}
-	// if query without name, returns last update of the node
-	if name == "" {
-		return true, n.last
+	// exact match, only one item can match
+	if m.exact() {
+		// check name in embedded item
+		if m.name == n.name {
+			return c.itemAt(n.item, at)
+		}
+		// check in items
+		for _, o := range n.others {
+			if m.name == o.name {
+				return c.itemAt(o, at)
+			}
+		}
+		return item{}, false
 	}
-	// check name in embedded item
-	if name == n.name {
-		if time.Since(n.ts) <= expires {
-			return true, n.ts
+	// returns the newest item that matches
+	var found item
+	if m.match(n.name) {
+		if i, ok := c.itemAt(n.item, at); ok {
+			found = i
 		}
-		return false, time.Time{}
 	}
-	// check in items
 	for _, o := range n.others {
-		if name == o.name {
-			if time.Since(o.ts) <= expires {
-				return true, o.ts
-			}
-			return false, time.Time{}
+		if !m.match(o.name) {
+			continue
+		}
+		if i, ok := c.itemAt(o, at); ok && i.ts.After(found.ts) {
+			found = i
 		}
 	}
-	return false, time.Time{}
+	return found, found.name != ""
 }
@@ -6,11 +6,14 @@ package resolvcache
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc/peer"
 
 	"github.com/luids-io/api/dnsutil"
@@ -22,8 +25,16 @@ type Service struct {
 	opts   options
 	logger yalogi.Logger
 	trace  TraceLogger
-	// cache
-	cache *Cache
+	// store and cache, nil if the store is not the memory cache
+	store   Store
+	cache   *Cache
+	cleanMu sync.Mutex
+	evicted uint64
+	// metrics is nil if disabled
+	metrics *metrics
+	// replication
+	instance string
+	replicas []*replicator
 	//control
 	started bool
 	mu      sync.Mutex
@@ -32,9 +43,11 @@ type Service struct {
 }
 
 // TraceLogger interface defines collection and query logger interface.
+// Client contains the ip of the client and the mask of the network used
+// for grouping it in the cache.
 type TraceLogger interface {
-	LogCollect(*peer.Peer, time.Time, net.IP, string, []net.IP, []string) error
-	LogCheck(peer *peer.Peer, ts time.Time, client, resolved net.IP, name string, resp dnsutil.CacheResponse) error
+	LogCollect(peer *peer.Peer, ts time.Time, client *net.IPNet, name string, resolved []net.IP, cnames []string) error
+	LogCheck(peer *peer.Peer, ts time.Time, client *net.IPNet, resolved net.IP, name string, resp dnsutil.CacheResponse) error
 }
 
 // Option is used for component configuration.
@@ -46,11 +59,30 @@ type options struct {
 	dumpInterval  time.Duration
 	cleanInterval time.Duration
 	dumpFile      string
+	dumpFormat    DumpFormat
+	snapInterval  time.Duration
+	snapFile      string
+	metrics       bool
+	checkMode     MatchMode
+	replicaPeers  []replicaPeer
+	replicaSize   int
+	replicaWait   time.Duration
+	replicaQueue  int
+	replayFiles   []string
+}
+
+type replicaPeer struct {
+	name string
+	peer Peer
 }
 
 var defaultOptions = options{
+	logger:        yalogi.LogNull,
 	dumpInterval:  5 * time.Minute,
 	cleanInterval: 1 * time.Minute,
+	replicaSize:   256,
+	replicaWait:   1 * time.Second,
+	replicaQueue:  8192,
 }
 
 // DumpCache option sets interval and filename for dump.
@@ -63,6 +95,66 @@ func DumpCache(d time.Duration, fname string) Option {
 	}
 }
 
+// SetDumpFormat option sets the format used in dumps.
+func SetDumpFormat(f DumpFormat) Option {
+	return func(o *options) {
+		o.dumpFormat = f
+	}
+}
+
+// SnapshotCache option sets filename for the cache snapshot. The snapshot is
+// loaded on start and saved on shutdown. If interval is greater than zero,
+// the snapshot will be also saved periodically. An invalid snapshot is
+// renamed with the suffix .corrupt and the cache starts empty.
+func SnapshotCache(d time.Duration, fname string) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.snapInterval = d
+		}
+		o.snapFile = fname
+	}
+}
+
+// EnableMetrics option registers prometheus metrics of the service on
+// start.
+func EnableMetrics(b bool) Option {
+	return func(o *options) {
+		o.metrics = b
+	}
+}
+
+// SetCheckMode option sets the match mode used by Check.
+func SetCheckMode(m MatchMode) Option {
+	return func(o *options) {
+		o.checkMode = m
+	}
+}
+
+// ReplicateTo option replicates the resolutions collected to the peer. Name
+// is used in logs.
+func ReplicateTo(name string, p Peer) Option {
+	return func(o *options) {
+		o.replicaPeers = append(o.replicaPeers, replicaPeer{name: name, peer: p})
+	}
+}
+
+// SetReplicaBatch option sets the max number of records sent to peers in a
+// batch, the max time that records wait before they are sent and the size
+// of the queue of each peer.
+func SetReplicaBatch(size int, wait time.Duration, queue int) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.replicaSize = size
+		}
+		if wait > 0 {
+			o.replicaWait = wait
+		}
+		if queue > 0 {
+			o.replicaQueue = queue
+		}
+	}
+}
+
 // SetTraceLogger option sets a collection and query logger.
 func SetTraceLogger(l TraceLogger) Option {
 	return func(o *options) {
@@ -79,66 +171,385 @@ func SetLogger(l yalogi.Logger) Option {
 	}
 }
 
-// NewService creates a new Service.
-func NewService(c *Cache, opt ...Option) *Service {
+// NewService creates a new Service using the store. Snapshots, trace
+// replays, replication to peers and the queries of clients require the
+// store to be a Cache.
+func NewService(st Store, opt ...Option) *Service {
 	opts := defaultOptions
 	for _, o := range opt {
 		o(&opts)
 	}
 	s := &Service{
-		opts:   opts,
-		logger: opts.logger,
-		trace:  opts.trace,
-		cache:  c,
+		opts:     opts,
+		logger:   opts.logger,
+		trace:    opts.trace,
+		store:    st,
+		instance: newInstanceID(),
+	}
+	s.cache, _ = st.(*Cache)
+	if opts.metrics {
+		s.metrics = newMetrics(st)
+	}
+	for _, p := range opts.replicaPeers {
+		s.replicas = append(s.replicas, &replicator{
+			name:   p.name,
+			peer:   p.peer,
+			origin: s.instance,
+			cache:  s.cache,
+			logger: s.logger,
+			queue:  make(chan Record, opts.replicaQueue),
+			size:   opts.replicaSize,
+			wait:   opts.replicaWait,
+		})
 	}
 	return s
 }
 
 // Collect implements dnsutil.ResolvCollector.
 func (s *Service) Collect(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string) error {
+	return s.CollectTTL(ctx, client, name, resolved, cnames, nil)
+}
+
+// CollectTTL collects the resolution with the ttls of the resolved ips.
+// Cnames must be in chain order and are stored with the same ttls.
+func (s *Service) CollectTTL(ctx context.Context, client net.IP, name string, resolved []net.IP, cnames []string, ttls []time.Duration) error {
+	return s.CollectAt(ctx, time.Now(), Resolution{
+		Client:   client,
+		Name:     name,
+		CNAMEs:   cnames,
+		Resolved: resolved,
+		TTLs:     ttls,
+	})
+}
+
+// CollectAt collects the resolution made at the time, used by sources that
+// report the time of the answers. A zero time or a time in the future is
+// now.
+func (s *Service) CollectAt(ctx context.Context, ts time.Time, r Resolution) error {
 	if !s.started {
 		return dnsutil.ErrUnavailable
 	}
-	now := time.Now()
-	err := s.cache.Set(now, client, name, resolved)
+	if now := time.Now(); ts.IsZero() || ts.After(now) {
+		ts = now
+	}
+	err := s.insert(ts, r)
 	if err != nil {
-		s.logger.Warnf("collecting '%v,%v,%v': %v", client, name, resolved)
+		s.logger.Warnf("collecting '%v,%v,%v,%v': %v", r.Client, r.Name, r.Resolved, r.CNAMEs, err)
+	} else if len(s.replicas) > 0 && r.Negative == Positive {
+		s.replicate(Record{Ts: ts, Resolution: r})
 	}
-	if len(cnames) > 0 {
-		for _, cname := range cnames {
-			err = s.cache.Set(now, client, cname, resolved)
-			if err != nil {
-				s.logger.Warnf("collecting '%v,%v,%v': %v", client, cname, resolved)
-			}
+	if s.metrics != nil {
+		s.metrics.collect(err)
+	}
+	if s.trace != nil && r.Negative == Positive {
+		peer, _ := peer.FromContext(ctx)
+		err := s.trace.LogCollect(peer, ts, s.traceClient(r.Client), r.Name, r.Resolved, r.CNAMEs)
+		if err != nil {
+			s.logger.Warnf("writting to collect logger '%v,%v,%v,%v': %v", r.Client, r.Name, r.Resolved, r.CNAMEs, err)
 		}
 	}
+	return err
+}
+
+// CollectMany collects the resolutions in a batch. It returns the errors
+// related by position to the resolutions, nil if all were collected.
+func (s *Service) CollectMany(ctx context.Context, rs []Resolution) ([]error, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	now := time.Now()
+	errs := s.insertMany(now, rs)
+	var p *peer.Peer
 	if s.trace != nil {
-		peer, _ := peer.FromContext(ctx)
-		err := s.trace.LogCollect(peer, now, client, name, resolved, cnames)
+		p, _ = peer.FromContext(ctx)
+	}
+	for i, r := range rs {
+		var err error
+		if errs != nil {
+			err = errs[i]
+		}
 		if err != nil {
-			s.logger.Warnf("writting to collect logger '%v,%v,%v,%v': %v", client, name, resolved, cnames)
+			s.logger.Warnf("collecting '%v,%v,%v,%v': %v", r.Client, r.Name, r.Resolved, r.CNAMEs, err)
+		} else if len(s.replicas) > 0 && r.Negative == Positive {
+			s.replicate(Record{Ts: now, Resolution: r})
+		}
+		if s.metrics != nil {
+			s.metrics.collect(err)
+		}
+		if s.trace != nil && r.Negative == Positive {
+			err := s.trace.LogCollect(p, now, s.traceClient(r.Client), r.Name, r.Resolved, r.CNAMEs)
+			if err != nil {
+				s.logger.Warnf("writting to collect logger '%v,%v,%v,%v': %v", r.Client, r.Name, r.Resolved, r.CNAMEs, err)
+			}
 		}
 	}
+	return errs, nil
+}
+
+// CollectNegative collects a negative answer to the query of the name.
+// Negative answers are not replicated nor written to the trace log.
+func (s *Service) CollectNegative(ctx context.Context, client net.IP, name string, n Negative) error {
+	if !s.started {
+		return dnsutil.ErrUnavailable
+	}
+	if n == Positive {
+		return dnsutil.ErrBadRequest
+	}
+	err := s.insert(time.Now(), Resolution{Client: client, Name: name, Negative: n})
+	if err != nil {
+		s.logger.Warnf("collecting %v '%v,%v': %v", n, client, name, err)
+	}
+	if s.metrics != nil {
+		s.metrics.collect(err)
+	}
 	return err
 }
 
 // Check implements dnsutil.ResolvChecker.
 func (s *Service) Check(ctx context.Context, client, resolved net.IP, name string) (dnsutil.CacheResponse, error) {
+	return s.CheckAt(ctx, client, resolved, name, time.Time{})
+}
+
+// CheckAt checks if the client had resolved the ip and name at the time of
+// an observation, a zero time is now.
+func (s *Service) CheckAt(ctx context.Context, client, resolved net.IP, name string, at time.Time) (dnsutil.CacheResponse, error) {
+	m, err := s.Match(ctx, client, resolved, name, s.opts.checkMode, at)
+	if err != nil {
+		return dnsutil.CacheResponse{}, err
+	}
+	return dnsutil.CacheResponse{Result: m.Result, Last: m.Last, Store: m.Store}, nil
+}
+
+// Match checks the cache at the time comparing names with the mode and
+// returns the name and ttl information of the match. A zero time is now.
+func (s *Service) Match(ctx context.Context, client, resolved net.IP, name string, mode MatchMode, at time.Time) (Match, error) {
 	if !s.started {
-		return dnsutil.CacheResponse{}, dnsutil.ErrUnavailable
+		return Match{}, dnsutil.ErrUnavailable
 	}
 	now := time.Now()
-	resp := dnsutil.CacheResponse{}
-	resp.Result, resp.Last = s.cache.Get(client, resolved, name)
-	resp.Store = s.cache.Store()
+	m, err := s.match(client, resolved, name, mode, at, now)
+	if err != nil {
+		return Match{}, err
+	}
+	var p *peer.Peer
 	if s.trace != nil {
-		peer, _ := peer.FromContext(ctx)
-		err := s.trace.LogCheck(peer, now, client, resolved, name, resp)
+		p, _ = peer.FromContext(ctx)
+	}
+	s.logCheck(p, now, client, resolved, name, m)
+	return m, nil
+}
+
+// CheckMany checks the batch with the check mode of the service. Responses
+// are related by position to the checks.
+func (s *Service) CheckMany(ctx context.Context, cs []Check) ([]dnsutil.CacheResponse, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	now := time.Now()
+	var ms []Match
+	if bm, ok := s.store.(BatchMatcher); ok {
+		ms = bm.MatchMany(cs, s.opts.checkMode)
+	} else {
+		ms = make([]Match, 0, len(cs))
+		for _, c := range cs {
+			m, err := s.match(c.Client, c.Resolved, c.Name, s.opts.checkMode, c.At, now)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, m)
+		}
+	}
+	var p *peer.Peer
+	if s.trace != nil {
+		p, _ = peer.FromContext(ctx)
+	}
+	resps := make([]dnsutil.CacheResponse, 0, len(ms))
+	for i, m := range ms {
+		s.logCheck(p, now, cs[i].Client, cs[i].Resolved, cs[i].Name, m)
+		resps = append(resps, dnsutil.CacheResponse{Result: m.Result, Last: m.Last, Store: m.Store})
+	}
+	return resps, nil
+}
+
+// match checks the store, a zero time is now.
+func (s *Service) match(client, resolved net.IP, name string, mode MatchMode, at, now time.Time) (Match, error) {
+	if tm, ok := s.store.(TimeMatcher); ok {
+		if at.IsZero() {
+			at = now
+		}
+		return tm.MatchAt(client, resolved, name, mode, at), nil
+	}
+	if mode != MatchExact || !at.IsZero() {
+		return Match{}, dnsutil.ErrNotSupported
+	}
+	var m Match
+	m.Result, m.Last = s.store.Get(client, resolved, name)
+	m.Store = storeTime(s.store)
+	return m, nil
+}
+
+// logCheck updates metrics and writes the check to the trace logger.
+func (s *Service) logCheck(p *peer.Peer, now time.Time, client, resolved net.IP, name string, m Match) {
+	if s.metrics != nil {
+		s.metrics.check(m.Result)
+	}
+	if s.trace != nil {
+		resp := dnsutil.CacheResponse{Result: m.Result, Last: m.Last, Store: m.Store}
+		err := s.trace.LogCheck(p, now, s.traceClient(client), resolved, name, resp)
 		if err != nil {
-			s.logger.Warnf("writting to query logger '%v,%v,%v': %v", client, name, resolved)
+			s.logger.Warnf("writting to query logger '%v,%v,%v': %v", client, name, resolved, err)
+		}
+	}
+}
+
+// Lookup returns the names resolved by the client for the resolved ip.
+func (s *Service) Lookup(ctx context.Context, client, resolved net.IP) ([]NameInfo, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	if s.cache == nil {
+		return nil, dnsutil.ErrNotSupported
+	}
+	return s.cache.Lookup(client, resolved), nil
+}
+
+// History returns the periods of resolution of the client in the time
+// window, oldest first. A zero time in to is now.
+func (s *Service) History(ctx context.Context, client net.IP, from, to time.Time) ([]HistoryRecord, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	if s.cache == nil {
+		return nil, dnsutil.ErrNotSupported
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if to.Before(from) {
+		return nil, dnsutil.ErrBadRequest
+	}
+	return s.cache.History(client, from, to), nil
+}
+
+// Failures returns the negative answers received by the client.
+func (s *Service) Failures(ctx context.Context, client net.IP) (FailureInfo, error) {
+	if !s.started {
+		return FailureInfo{}, dnsutil.ErrUnavailable
+	}
+	if s.cache == nil {
+		return FailureInfo{}, dnsutil.ErrNotSupported
+	}
+	info, ok := s.cache.Failures(client)
+	if !ok {
+		info.Client = s.cache.ClientNet(client)
+	}
+	return info, nil
+}
+
+// maxClientStats limits the number of clients returned by ClientStats.
+const maxClientStats = 1024
+
+// ClientStats returns the behavioural information of the client. If client
+// is nil, it returns the most recently updated clients up to
+// maxClientStats.
+func (s *Service) ClientStats(ctx context.Context, client net.IP) ([]ClientStats, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	if s.cache == nil {
+		return nil, dnsutil.ErrNotSupported
+	}
+	if client == nil {
+		return s.cache.AllClientStats(maxClientStats), nil
+	}
+	st, ok := s.cache.ClientStats(client)
+	if !ok {
+		return nil, nil
+	}
+	return []ClientStats{st}, nil
+}
+
+// Clients returns the clients that resolved the ip or the name.
+func (s *Service) Clients(ctx context.Context, resolved net.IP, name string) ([]ClientInfo, error) {
+	if !s.started {
+		return nil, dnsutil.ErrUnavailable
+	}
+	if s.cache == nil {
+		return nil, dnsutil.ErrNotSupported
+	}
+	if resolved == nil && name == "" {
+		return nil, dnsutil.ErrBadRequest
+	}
+	return s.cache.Clients(resolved, name)
+}
+
+// Flush removes the clients in the network from the cache, all clients if
+// network is nil. It returns the number of clients removed.
+func (s *Service) Flush(ctx context.Context, network *net.IPNet) (int, error) {
+	if !s.started {
+		return 0, dnsutil.ErrUnavailable
+	}
+	if network == nil {
+		if s.cache == nil {
+			s.store.Flush()
+			s.logger.Debugf("flushed store")
+			return 0, nil
 		}
+		count := s.cache.ClientCount()
+		s.cache.Flush()
+		s.logger.Debugf("flushed cache: %v clients", count)
+		return count, nil
+	}
+	if s.cache == nil {
+		return 0, dnsutil.ErrNotSupported
+	}
+	count := s.cache.FlushNet(network)
+	s.logger.Debugf("flushed %v from cache: %v clients", network, count)
+	return count, nil
+}
+
+// Clean removes expired items from the cache now.
+func (s *Service) Clean(ctx context.Context) error {
+	if !s.started {
+		return dnsutil.ErrUnavailable
+	}
+	s.cleanMu.Lock()
+	s.clean()
+	s.cleanMu.Unlock()
+	return nil
+}
+
+// Dump writes the cache content to the file using the format.
+func (s *Service) Dump(ctx context.Context, filename string, format DumpFormat) error {
+	if !s.started {
+		return dnsutil.ErrUnavailable
+	}
+	if filename == "" {
+		return dnsutil.ErrBadRequest
+	}
+	s.logger.Debugf("dumping cache to %s", filename)
+	return s.dump(filename, format)
+}
+
+// Stats returns usage information of the cache.
+func (s *Service) Stats(ctx context.Context) (Stats, error) {
+	if !s.started {
+		return Stats{}, dnsutil.ErrUnavailable
 	}
-	return resp, nil
+	return s.store.Stats(), nil
+}
+
+// SetExpires changes the expiration time of the cache.
+func (s *Service) SetExpires(ctx context.Context, d time.Duration) error {
+	if !s.started {
+		return dnsutil.ErrUnavailable
+	}
+	if d <= 0 {
+		return dnsutil.ErrBadRequest
+	}
+	s.logger.Debugf("changing cache expiration from %v to %v", s.store.Expires(), d)
+	s.store.SetExpires(d)
+	return nil
 }
 
 // Uptime returns cache information.
@@ -146,7 +557,7 @@ func (s *Service) Uptime(ctx context.Context) (time.Time, time.Duration, error)
 	if !s.started {
 		return time.Time{}, 0, dnsutil.ErrUnavailable
 	}
-	return s.cache.Flushed(), s.cache.Expires(), nil
+	return s.store.Flushed(), s.store.Expires(), nil
 }
 
 // Start service cache.
@@ -157,9 +568,30 @@ func (s *Service) Start() error {
 		return nil
 	}
 	s.logger.Infof("starting cache service")
+	if s.cache == nil && (s.opts.snapFile != "" || len(s.opts.replayFiles) > 0 || len(s.replicas) > 0) {
+		return errors.New("snapshots, replays and replicas require a memory cache")
+	}
+	if s.opts.snapFile != "" {
+		err := s.loadSnapshot(s.opts.snapFile)
+		if err != nil {
+			return fmt.Errorf("loading snapshot: %v", err)
+		}
+	}
+	for _, filename := range s.opts.replayFiles {
+		err := s.replayTrace(filename)
+		if err != nil {
+			return fmt.Errorf("replaying trace: %v", err)
+		}
+	}
+	if s.metrics != nil {
+		err := prometheus.Register(s.metrics)
+		if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+			return fmt.Errorf("registering metrics: %v", err)
+		}
+	}
 	// start maintenance goroutines
 	s.close = make(chan struct{})
-	if s.cache.Expires() > 0 {
+	if s.store.Expires() > 0 {
 		s.wg.Add(1)
 		go s.autoClean()
 	}
@@ -167,6 +599,18 @@ func (s *Service) Start() error {
 		s.wg.Add(1)
 		go s.autoDump()
 	}
+	if s.opts.snapFile != "" && s.opts.snapInterval > 0 {
+		s.wg.Add(1)
+		go s.autoSnapshot()
+	}
+	for _, r := range s.replicas {
+		s.logger.Infof("replicating to %s", r.name)
+		s.wg.Add(1)
+		go func(r *replicator) {
+			defer s.wg.Done()
+			r.run(s.close)
+		}(r)
+	}
 	s.started = true
 	return nil
 }
@@ -182,22 +626,152 @@ func (s *Service) Shutdown() {
 	s.started = false
 	close(s.close)
 	s.wg.Wait()
+	if s.metrics != nil {
+		prometheus.Unregister(s.metrics)
+	}
+	if s.opts.snapFile != "" {
+		s.logger.Infof("saving snapshot to %s", s.opts.snapFile)
+		err := s.saveSnapshot(s.opts.snapFile)
+		if err != nil {
+			s.logger.Errorf("saving snapshot: %v", err)
+		}
+	}
+	if c, ok := s.store.(io.Closer); ok {
+		err := c.Close()
+		if err != nil {
+			s.logger.Errorf("closing store: %v", err)
+		}
+	}
 }
 
-func (s *Service) dump(filename string) error {
+func (s *Service) traceClient(client net.IP) *net.IPNet {
+	if ip4 := client.To4(); ip4 != nil {
+		client = ip4
+	}
+	mask := net.CIDRMask(len(client)*8, len(client)*8)
+	if s.cache != nil {
+		mask = s.cache.ClientNet(client).Mask
+	}
+	return &net.IPNet{IP: client, Mask: mask}
+}
+
+// insert stores the resolution in the store. Stores that don't implement
+// Inserter store the name and each cname with Set.
+func (s *Service) insert(ts time.Time, r Resolution) error {
+	if i, ok := s.store.(Inserter); ok {
+		return i.Insert(ts, r)
+	}
+	if r.Negative != Positive {
+		return dnsutil.ErrNotSupported
+	}
+	err := s.store.Set(ts, r.Client, r.Name, r.Resolved)
+	for _, cname := range r.CNAMEs {
+		if cerr := s.store.Set(ts, r.Client, cname, r.Resolved); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// insertMany stores the resolutions with the same timestamp and returns the
+// errors related by position, nil if all were stored.
+func (s *Service) insertMany(ts time.Time, rs []Resolution) []error {
+	if s.cache != nil {
+		return s.cache.InsertMany(ts, rs)
+	}
+	var errs []error
+	for i, r := range rs {
+		if err := s.insert(ts, r); err != nil {
+			if errs == nil {
+				errs = make([]error, len(rs))
+			}
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+func (s *Service) dump(filename string, format DumpFormat) error {
 	if !s.started {
 		return errors.New("service not started")
 	}
+	start := time.Now()
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
-	s.cache.Dump(file)
+	if format == DumpJSON && s.cache != nil {
+		err = s.cache.DumpRecords(file)
+	} else {
+		s.store.Dump(file)
+	}
 	file.Sync()
 	file.Close()
+	if s.metrics != nil {
+		s.metrics.dump(time.Since(start))
+	}
+	return err
+}
+
+func (s *Service) clean() {
+	start := time.Now()
+	s.store.Clean()
+	if s.metrics != nil {
+		s.metrics.clean(time.Since(start))
+	}
+	if s.cache == nil {
+		return
+	}
+	if evicted := s.cache.Evicted(); evicted > s.evicted {
+		s.logger.Infof("evicted %v clients from cache (total: %v)", evicted-s.evicted, evicted)
+		s.evicted = evicted
+	}
+}
+
+func (s *Service) loadSnapshot(filename string) error {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		s.logger.Infof("snapshot %s not found", filename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	loaded, err := s.cache.Load(file)
+	file.Close()
+	if err != nil {
+		// an invalid snapshot must not block the startup, it is kept
+		// apart for inspection and the cache starts empty
+		corrupt := filename + ".corrupt"
+		s.logger.Warnf("loading snapshot %s: %v, renaming to %s", filename, err, corrupt)
+		if rerr := os.Rename(filename, corrupt); rerr != nil {
+			s.logger.Warnf("renaming snapshot %s: %v", filename, rerr)
+		}
+		return nil
+	}
+	s.logger.Infof("loaded %v items from snapshot %s", loaded, filename)
 	return nil
 }
 
+// saveSnapshot writes to a temporal file and renames it, so a crash while
+// saving never leaves a truncated snapshot.
+func (s *Service) saveSnapshot(filename string) error {
+	tmpname := filename + ".tmp"
+	file, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	err = s.cache.Save(file)
+	if err != nil {
+		file.Close()
+		os.Remove(tmpname)
+		return err
+	}
+	file.Sync()
+	file.Close()
+	return os.Rename(tmpname, filename)
+}
+
 // cache maintenance go routines
 func (s *Service) autoDump() {
 	tick := time.NewTicker(s.opts.dumpInterval)
@@ -206,7 +780,28 @@ func (s *Service) autoDump() {
 		select {
 		case <-tick.C:
 			s.logger.Debugf("dumping cache to %s", s.opts.dumpFile)
-			s.dump(s.opts.dumpFile)
+			err := s.dump(s.opts.dumpFile, s.opts.dumpFormat)
+			if err != nil {
+				s.logger.Warnf("dumping cache: %v", err)
+			}
+		case <-s.close:
+			s.wg.Done()
+			return
+		}
+	}
+}
+
+func (s *Service) autoSnapshot() {
+	tick := time.NewTicker(s.opts.snapInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			s.logger.Debugf("saving snapshot to %s", s.opts.snapFile)
+			err := s.saveSnapshot(s.opts.snapFile)
+			if err != nil {
+				s.logger.Warnf("saving snapshot: %v", err)
+			}
 		case <-s.close:
 			s.wg.Done()
 			return
@@ -221,7 +816,9 @@ func (s *Service) autoClean() {
 		select {
 		case <-tick.C:
 			s.logger.Debugf("cleaning cache")
-			s.cache.Clean()
+			s.cleanMu.Lock()
+			s.clean()
+			s.cleanMu.Unlock()
 		case <-s.close:
 			s.wg.Done()
 			return
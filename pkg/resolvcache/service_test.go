@@ -0,0 +1,82 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/dnsutil"
+)
+
+func TestServiceCheckMany(t *testing.T) {
+	svc := NewService(NewCache(time.Hour, DefaultLimits()), SetCheckMode(MatchSubdomain))
+	ctx := context.Background()
+	if _, err := svc.CheckMany(ctx, nil); err != dnsutil.ErrUnavailable {
+		t.Errorf("CheckMany() before start = %v, want %v", err, dnsutil.ErrUnavailable)
+	}
+	if err := svc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Shutdown()
+	client := net.ParseIP("10.0.0.1")
+	resolved := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}
+	if err := svc.Collect(ctx, client, "www.example.com", resolved[:1], nil); err != nil {
+		t.Fatal(err)
+	}
+	checks := []Check{
+		{Client: client, Resolved: resolved[1], Name: "example.com"},
+		{Client: client, Resolved: resolved[0], Name: "example.com"},
+		{Client: client, Resolved: resolved[0], Name: "example.org"},
+		{Client: net.ParseIP("10.0.0.2"), Resolved: resolved[0]},
+	}
+	resps, err := svc.CheckMany(ctx, checks)
+	if err != nil {
+		t.Fatalf("CheckMany() = %v", err)
+	}
+	want := []bool{false, true, false, false}
+	if len(resps) != len(want) {
+		t.Fatalf("CheckMany() = %v responses, want %v", len(resps), len(want))
+	}
+	for i, r := range resps {
+		if r.Result != want[i] {
+			t.Errorf("CheckMany()[%v] = %v, want %v", i, r.Result, want[i])
+		}
+		single, err := svc.Check(ctx, checks[i].Client, checks[i].Resolved, checks[i].Name)
+		if err != nil || single.Result != r.Result || !single.Last.Equal(r.Last) {
+			t.Errorf("CheckMany()[%v] = %+v, Check() = %+v %v", i, r, single, err)
+		}
+	}
+}
+
+func TestServiceCollectAt(t *testing.T) {
+	svc := NewService(NewCache(time.Hour, DefaultLimits()))
+	if err := svc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Shutdown()
+	ctx := context.Background()
+	client, resolved := net.ParseIP("10.0.0.1"), net.ParseIP("192.0.2.1")
+	ts := time.Now().Add(-30 * time.Minute).Truncate(time.Second)
+	r := Resolution{Client: client, Name: "www.example.com", Resolved: []net.IP{resolved}}
+	if err := svc.CollectAt(ctx, ts, r); err != nil {
+		t.Fatalf("CollectAt() = %v", err)
+	}
+	if resp, _ := svc.CheckAt(ctx, client, resolved, "www.example.com", ts.Add(-time.Minute)); resp.Result {
+		t.Errorf("CheckAt() before the response time = %+v", resp)
+	}
+	resp, _ := svc.CheckAt(ctx, client, resolved, "www.example.com", ts.Add(time.Minute))
+	if !resp.Result || !resp.Last.Equal(ts) {
+		t.Errorf("CheckAt() after the response time = %+v, want last %v", resp, ts)
+	}
+	// times in the future are now
+	r.Name = "www.example.org"
+	if err := svc.CollectAt(ctx, time.Now().Add(time.Hour), r); err != nil {
+		t.Fatalf("CollectAt() = %v", err)
+	}
+	if resp, _ := svc.Check(ctx, client, resolved, "www.example.org"); !resp.Result || resp.Last.After(time.Now()) {
+		t.Errorf("Check() of future resolution = %+v", resp)
+	}
+}
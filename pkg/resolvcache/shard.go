@@ -0,0 +1,95 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"sync"
+)
+
+// cacheShards is the number of shards of the client map, must be a power
+// of two
+const cacheShards = 64
+
+// ipKey is used as map key for ips, ipv4 addresses are stored in the ipv6
+// mapped form, so net.IP values of 4 and 16 bytes have the same key
+type ipKey [net.IPv6len]byte
+
+var v4InV6Prefix = [12]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff}
+
+func getIPKey(ip net.IP) (k ipKey) {
+	if len(ip) == net.IPv4len {
+		copy(k[:], v4InV6Prefix[:])
+		copy(k[12:], ip)
+		return
+	}
+	copy(k[:], ip)
+	return
+}
+
+// IP returns a new net.IP from the key
+func (k ipKey) IP() net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, k[:])
+	return ip
+}
+
+func (k ipKey) String() string {
+	return k.IP().String()
+}
+
+// mask applies the prefix to the key, prefix is relative to the 128 bits
+func (k ipKey) mask(prefix int) ipKey {
+	for i := range k {
+		switch {
+		case prefix >= 8:
+			prefix -= 8
+		case prefix <= 0:
+			k[i] = 0
+		default:
+			k[i] &= ^byte(0xff >> uint(prefix))
+			prefix = 0
+		}
+	}
+	return k
+}
+
+// shard returns a shard index using fnv-1a
+func (k ipKey) shard() int {
+	h := uint32(2166136261)
+	for _, b := range k {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return int(h & (cacheShards - 1))
+}
+
+// cacheShard stores a partition of the clients
+type cacheShard struct {
+	mu      sync.RWMutex
+	clients map[ipKey]*clientBlock
+}
+
+type clientEntry struct {
+	key    ipKey
+	client *clientBlock
+}
+
+func (o *Cache) shard(k ipKey) *cacheShard {
+	return &o.shards[k.shard()]
+}
+
+// clientList returns a copy of the pointers to client blocks, shards are
+// locked one at a time.
+func (o *Cache) clientList() []clientEntry {
+	list := make([]clientEntry, 0, o.ClientCount())
+	for i := range o.shards {
+		s := &o.shards[i]
+		s.mu.RLock()
+		for k, c := range s.clients {
+			list = append(list, clientEntry{key: k, client: c})
+		}
+		s.mu.RUnlock()
+	}
+	return list
+}
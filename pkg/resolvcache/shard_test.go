@@ -0,0 +1,53 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPKey(t *testing.T) {
+	v4 := net.ParseIP("10.1.2.3")
+	if getIPKey(v4) != getIPKey(v4.To4()) {
+		t.Errorf("ipv4 keys of 4 and 16 bytes differ")
+	}
+	tests := []string{"10.1.2.3", "0.0.0.0", "255.255.255.255", "2001:db8::1", "::1", "::ffff:192.0.2.1"}
+	for _, s := range tests {
+		ip := net.ParseIP(s)
+		k := getIPKey(ip)
+		if !k.IP().Equal(ip) {
+			t.Errorf("key of %s returns %v", s, k.IP())
+		}
+		if k.String() != ip.String() {
+			t.Errorf("key of %s string %s", s, k.String())
+		}
+		if sh := k.shard(); sh < 0 || sh >= cacheShards {
+			t.Errorf("key of %s shard %v", s, sh)
+		}
+	}
+	if getIPKey(net.ParseIP("10.0.0.1")) == getIPKey(net.ParseIP("10.0.0.2")) {
+		t.Errorf("different ips with the same key")
+	}
+}
+
+func TestIPKeyMask(t *testing.T) {
+	tests := []struct {
+		ip     string
+		prefix int
+		want   string
+	}{
+		{"10.1.2.3", 96 + 24, "10.1.2.0"},
+		{"10.1.2.3", 96 + 20, "10.1.0.0"},
+		{"10.1.2.3", 96 + 32, "10.1.2.3"},
+		{"2001:db8:1:2::1", 48, "2001:db8:1::"},
+		{"2001:db8:1:2::1", 0, "::"},
+		{"2001:db8:1:2::1", 128, "2001:db8:1:2::1"},
+	}
+	for _, tt := range tests {
+		got := getIPKey(net.ParseIP(tt.ip)).mask(tt.prefix)
+		if !got.IP().Equal(net.ParseIP(tt.want)) {
+			t.Errorf("mask(%s, %v) = %v, want %s", tt.ip, tt.prefix, got, tt.want)
+		}
+	}
+}
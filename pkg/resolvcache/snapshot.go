@@ -0,0 +1,295 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+)
+
+// SnapshotVersion is the version of the binary format written by Save.
+const SnapshotVersion = 1
+
+// snapshotMagic identifies the snapshot files.
+var snapshotMagic = [4]byte{'L', 'R', 'C', 'S'}
+
+// ErrSnapshotFormat is returned when loading an invalid snapshot.
+var ErrSnapshotFormat = errors.New("resolvcache: invalid snapshot format")
+
+// Save writes a binary snapshot of the cache content to writer.
+func (o *Cache) Save(out io.Writer) error {
+	w := &snapWriter{w: bufio.NewWriter(out)}
+	w.write(snapshotMagic[:])
+	w.uvarint(SnapshotVersion)
+	w.varint(time.Now().UnixNano())
+	w.varint(int64(o.Expires()))
+
+	clients := o.clientList()
+	w.uvarint(uint64(len(clients)))
+	for _, e := range clients {
+		client := e.client
+		client.mu.RLock()
+		w.str(e.key.String())
+		w.uvarint(uint64(len(client.blocks)))
+		for _, b := range client.blocks {
+			b.mu.RLock()
+			w.varint(b.last.UnixNano())
+			w.uvarint(uint64(len(b.index)))
+			for k, i := range b.index {
+				node := b.nodes[i]
+				w.str(k.String())
+				w.varint(node.last.UnixNano())
+				w.uvarint(uint64(len(node.others) + 1))
+				w.item(node.item)
+				for _, item := range node.others {
+					w.item(item)
+				}
+			}
+			b.mu.RUnlock()
+		}
+		client.mu.RUnlock()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Load reads a snapshot written by Save and inserts its content in the
+// cache, updating the index and the limits as the inserts do. Items older
+// than the expiration are discarded. The snapshot is
+// read completely before inserting, so nothing is loaded if it is invalid.
+// It returns the number of items loaded.
+func (o *Cache) Load(in io.Reader) (int, error) {
+	r := &snapReader{r: bufio.NewReader(in)}
+	var magic [4]byte
+	r.read(magic[:])
+	if r.err != nil || magic != snapshotMagic {
+		return 0, ErrSnapshotFormat
+	}
+	version := r.uvarint()
+	if r.err != nil {
+		return 0, ErrSnapshotFormat
+	}
+	if version != SnapshotVersion {
+		return 0, fmt.Errorf("resolvcache: unsupported snapshot version %v", version)
+	}
+	r.varint() // snapshot timestamp
+	r.varint() // expires used by the cache that created the snapshot
+
+	now := time.Now()
+	clients := make([]snapClient, 0)
+	nclients := r.uvarint()
+	for i := uint64(0); i < nclients && r.err == nil; i++ {
+		client := net.ParseIP(r.str())
+		items := make([]snapItem, 0)
+		nblocks := r.uvarint()
+		for j := uint64(0); j < nblocks && r.err == nil; j++ {
+			r.varint() // block last update
+			nnodes := r.uvarint()
+			for k := uint64(0); k < nnodes && r.err == nil; k++ {
+				resolved := net.ParseIP(r.str())
+				r.varint() // node last update
+				nitems := r.uvarint()
+				for l := uint64(0); l < nitems && r.err == nil; l++ {
+					i := r.item()
+					if !o.ttl.enabled {
+						i.ttl = 0
+						for m := range i.past {
+							i.past[m].ttl = 0
+						}
+					}
+					if len(i.past) > o.history {
+						i.past = i.past[len(i.past)-o.history:]
+					}
+					if i.name == "" || resolved == nil || now.Sub(i.ts) > o.Expires() {
+						continue
+					}
+					items = append(items, snapItem{resolved: resolved, item: i})
+				}
+			}
+		}
+		if r.err != nil {
+			break
+		}
+		if client == nil || len(items) == 0 {
+			continue
+		}
+		clients = append(clients, snapClient{ip: client, items: items})
+	}
+	if r.err != nil {
+		return 0, ErrSnapshotFormat
+	}
+	loaded := 0
+	for _, sc := range clients {
+		// insert in chronological order to rebuild blocks
+		items := sc.items
+		sort.SliceStable(items, func(a, b int) bool { return items[a].ts.Before(items[b].ts) })
+		key := o.clientKey(sc.ip)
+		c := o.getClientBlock(key, sc.ip)
+		var last time.Time
+		for _, item := range items {
+			c.start(item.since)
+			// items of the same resolution share the time stamp
+			if !item.ts.Equal(last) {
+				c.rate.add(item.ts)
+				last = item.ts
+			}
+			err := o.insertItem(c, key, []net.IP{item.resolved}, []time.Duration{item.ttl}, item.item)
+			if err != nil {
+				continue
+			}
+			loaded++
+		}
+	}
+	// check memory limits
+	if o.overMemory() {
+		o.evictMemory()
+	}
+	return loaded, nil
+}
+
+type snapClient struct {
+	ip    net.IP
+	items []snapItem
+}
+
+type snapItem struct {
+	resolved net.IP
+	item
+}
+
+// snapWriter encodes values and keeps the first error
+type snapWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (w *snapWriter) write(p []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+}
+
+func (w *snapWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	w.write(w.buf[:n])
+}
+
+func (w *snapWriter) varint(v int64) {
+	n := binary.PutVarint(w.buf[:], v)
+	w.write(w.buf[:n])
+}
+
+func (w *snapWriter) str(s string) {
+	w.uvarint(uint64(len(s)))
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+func (w *snapWriter) item(i item) {
+	w.str(i.name)
+	w.varint(i.ts.UnixNano())
+	w.varint(int64(i.ttl))
+	w.uvarint(uint64(len(i.chain)))
+	for _, name := range i.chain {
+		w.str(name)
+	}
+	w.varint(i.since.UnixNano())
+	w.uvarint(uint64(len(i.past)))
+	for _, p := range i.past {
+		w.varint(p.since.UnixNano())
+		w.varint(p.ts.UnixNano())
+		w.varint(int64(p.ttl))
+	}
+}
+
+// snapReader decodes values and keeps the first error
+type snapReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+// maxSnapString limits the size of strings readed from snapshots
+const maxSnapString = 1024
+
+// maxSnapChain limits the length of cname chains readed from snapshots
+const maxSnapChain = 64
+
+// maxSnapPast limits the number of periods readed from snapshots
+const maxSnapPast = 1024
+
+func (r *snapReader) read(p []byte) {
+	if r.err == nil {
+		_, r.err = io.ReadFull(r.r, p)
+	}
+}
+
+func (r *snapReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	var v uint64
+	v, r.err = binary.ReadUvarint(r.r)
+	return v
+}
+
+func (r *snapReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	var v int64
+	v, r.err = binary.ReadVarint(r.r)
+	return v
+}
+
+func (r *snapReader) str() string {
+	size := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if size > maxSnapString {
+		r.err = ErrSnapshotFormat
+		return ""
+	}
+	p := make([]byte, size)
+	r.read(p)
+	return string(p)
+}
+
+func (r *snapReader) item() item {
+	var i item
+	i.name = r.str()
+	i.ts = time.Unix(0, r.varint())
+	i.ttl = time.Duration(r.varint())
+	n := r.uvarint()
+	if n > maxSnapChain {
+		r.err = ErrSnapshotFormat
+		return i
+	}
+	for j := uint64(0); j < n && r.err == nil; j++ {
+		i.chain = append(i.chain, r.str())
+	}
+	i.since = time.Unix(0, r.varint())
+	n = r.uvarint()
+	if n > maxSnapPast {
+		r.err = ErrSnapshotFormat
+		return i
+	}
+	for j := uint64(0); j < n && r.err == nil; j++ {
+		var p period
+		p.since = time.Unix(0, r.varint())
+		p.ts = time.Unix(0, r.varint())
+		p.ttl = time.Duration(r.varint())
+		i.past = append(i.past, p)
+	}
+	return i
+}
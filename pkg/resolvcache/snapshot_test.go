@@ -0,0 +1,225 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func snapCache() *Cache {
+	return NewCache(time.Hour, DefaultLimits(), HonourTTL(0, 0), KeepHistory(4))
+}
+
+// snapFill inserts resolutions with ttls, cname chains and past periods.
+func snapFill(t *testing.T, c *Cache, base time.Time) {
+	t.Helper()
+	ttl := []time.Duration{time.Minute}
+	inserts := []struct {
+		ts time.Duration
+		r  Resolution
+	}{
+		{-30 * time.Minute, Resolution{Client: net.ParseIP("10.0.0.1"), Name: "www.example.com", Resolved: []net.IP{net.ParseIP("192.0.2.1")}, TTLs: ttl}},
+		{-29 * time.Minute, Resolution{Client: net.ParseIP("10.0.0.1"), Name: "www.example.com", Resolved: []net.IP{net.ParseIP("192.0.2.1")}, TTLs: ttl}},
+		{-20 * time.Minute, Resolution{Client: net.ParseIP("10.0.0.1"), Name: "www.example.com", Resolved: []net.IP{net.ParseIP("192.0.2.1")}, TTLs: ttl}},
+		{-5 * time.Minute, Resolution{Client: net.ParseIP("10.0.0.1"), Name: "www.example.com", Resolved: []net.IP{net.ParseIP("192.0.2.1")}, TTLs: ttl}},
+		{-10 * time.Minute, Resolution{Client: net.ParseIP("10.0.0.2"), Name: "cdn.example.com", CNAMEs: []string{"edge.example.net"}, Resolved: []net.IP{net.ParseIP("192.0.2.2")}, TTLs: ttl}},
+		{-time.Minute, Resolution{Client: net.ParseIP("2001:db8::1"), Name: "www.example.org", Resolved: []net.IP{net.ParseIP("2001:db8:1::1")}}},
+	}
+	for _, in := range inserts {
+		if err := c.Insert(base.Add(in.ts), in.r); err != nil {
+			t.Fatalf("inserting %v: %v", in.r, err)
+		}
+	}
+}
+
+func sameHistory(got, want []HistoryRecord) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if !g.Resolved.Equal(w.Resolved) || g.Name != w.Name || !g.Since.Equal(w.Since) ||
+			!g.Last.Equal(w.Last) || g.TTL != w.TTL || len(g.Chain) != len(w.Chain) {
+			return false
+		}
+		for j := range g.Chain {
+			if g.Chain[j] != w.Chain[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+	orig := snapCache()
+	snapFill(t, orig, base)
+
+	var buf bytes.Buffer
+	if err := orig.Save(&buf); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	loaded := snapCache()
+	n, err := loaded.Load(&buf)
+	if err != nil {
+		t.Fatalf("loading: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("loaded %v items, want 4", n)
+	}
+	if loaded.ClientCount() != orig.ClientCount() {
+		t.Errorf("ClientCount() = %v, want %v", loaded.ClientCount(), orig.ClientCount())
+	}
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "2001:db8::1"} {
+		ip := net.ParseIP(client)
+		want := orig.History(ip, time.Time{}, base)
+		got := loaded.History(ip, time.Time{}, base)
+		if len(want) == 0 {
+			t.Fatalf("client %s without history", client)
+		}
+		if !sameHistory(got, want) {
+			t.Errorf("client %s history = %v, want %v", client, got, want)
+		}
+	}
+	// the first client must keep its past periods
+	if h := loaded.History(net.ParseIP("10.0.0.1"), time.Time{}, base); len(h) != 3 {
+		t.Errorf("periods loaded = %v, want 3", len(h))
+	}
+	m := loaded.MatchAt(net.ParseIP("10.0.0.2"), net.ParseIP("192.0.2.2"), "edge.example.net", MatchExact, base.Add(-9*time.Minute-30*time.Second))
+	if !m.Result || m.TTL != time.Minute || len(m.Chain) != 2 || m.Chain[0] != "cdn.example.com" {
+		t.Errorf("match after load = %+v", m)
+	}
+}
+
+func TestSnapshotIndex(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+	orig := snapCache()
+	snapFill(t, orig, base)
+	var buf bytes.Buffer
+	if err := orig.Save(&buf); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	loaded := NewCache(time.Hour, DefaultLimits(), ClientIndex(true))
+	if _, err := loaded.Load(&buf); err != nil {
+		t.Fatalf("loading: %v", err)
+	}
+	tests := []struct {
+		resolved net.IP
+		name     string
+		want     string
+	}{
+		{net.ParseIP("192.0.2.1"), "", "10.0.0.1"},
+		{nil, "www.example.com", "10.0.0.1"},
+		{nil, "cdn.example.com", "10.0.0.2"},
+		{nil, "edge.example.net", "10.0.0.2"},
+		{net.ParseIP("2001:db8:1::1"), "", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		clients, err := loaded.Clients(tt.resolved, tt.name)
+		if err != nil {
+			t.Fatalf("Clients() = %v", err)
+		}
+		if len(clients) != 1 || !clients[0].Client.Equal(net.ParseIP(tt.want)) {
+			t.Errorf("Clients(%v, %q) = %v, want %v", tt.resolved, tt.name, clients, tt.want)
+		}
+	}
+}
+
+func TestSnapshotMaxMemory(t *testing.T) {
+	limits := DefaultLimits()
+	limits.BlockSize = 16
+	orig := NewCache(time.Hour, limits)
+	resolved := benchIPs(192, 40)
+	now := time.Now().Add(-time.Minute)
+	for _, client := range benchIPs(10, 1000) {
+		if err := orig.Set(now, client, "www.example.com", resolved); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := orig.Save(&buf); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	limits.MaxMemory = 1
+	loaded := NewCache(time.Hour, limits)
+	if _, err := loaded.Load(&buf); err != nil {
+		t.Fatalf("loading: %v", err)
+	}
+	if max := int64(limits.MaxMemory) * 1024 * 1024; loaded.Memory() > max {
+		t.Errorf("Memory() = %v after load, exceeds %v", loaded.Memory(), max)
+	}
+	if loaded.ClientCount() == 0 || loaded.ClientCount() >= orig.ClientCount() {
+		t.Errorf("ClientCount() = %v after load, want evictions", loaded.ClientCount())
+	}
+	checkAccounting(t, loaded)
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	base := time.Now().Truncate(time.Second)
+	orig := snapCache()
+	snapFill(t, orig, base)
+	var buf bytes.Buffer
+	if err := orig.Save(&buf); err != nil {
+		t.Fatalf("saving: %v", err)
+	}
+	data := buf.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"magic", []byte("XXXX")},
+		{"version", append(append([]byte{}, snapshotMagic[:]...), SnapshotVersion+1)},
+		{"truncated", data[:len(data)-3]},
+		{"half", data[:len(data)/2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := snapCache()
+			n, err := c.Load(bytes.NewReader(tt.data))
+			if err == nil {
+				t.Fatalf("Load() without error")
+			}
+			if n != 0 || c.ClientCount() != 0 {
+				t.Errorf("Load() = %v items, %v clients, want empty cache", n, c.ClientCount())
+			}
+		})
+	}
+}
+
+func TestServiceCorruptSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolvcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "cache.snap")
+	if err := ioutil.WriteFile(fname, []byte("LRCS\x01\x02"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(snapCache(), SnapshotCache(0, fname))
+	if err := svc.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	svc.Shutdown()
+	if _, err := os.Stat(fname + ".corrupt"); err != nil {
+		t.Errorf("corrupt snapshot not renamed: %v", err)
+	}
+	// the snapshot saved on shutdown must be valid
+	file, err := os.Open(fname)
+	if err != nil {
+		t.Fatalf("snapshot not saved: %v", err)
+	}
+	defer file.Close()
+	if _, err := snapCache().Load(file); err != nil {
+		t.Errorf("loading saved snapshot: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"time"
+)
+
+// Stats stores usage information of the cache.
+type Stats struct {
+	Expires time.Duration
+	Flushed time.Time
+	Cleaned time.Time
+	// usage
+	Clients int
+	Blocks  int
+	// Nodes in use, nodes cleaned are not included
+	Nodes int
+	Names int
+	// NamesNode stores the number of nodes by the number of names stored,
+	// index 0 is for nodes with one name
+	NamesNode []int
+	Memory    int64
+	Evicted   uint64
+	// evictions by the overflow policy
+	EvictedBlocks uint64
+	EvictedNames  uint64
+	Overflows     []ClientOverflow
+	// negative answers collected
+	NXDomain uint64
+	NoData   uint64
+}
+
+// Stats returns usage information, it iterates over all nodes.
+func (o *Cache) Stats() Stats {
+	st := Stats{
+		Expires:   o.Expires(),
+		Flushed:   o.Flushed(),
+		Cleaned:   o.Cleaned(),
+		Memory:    o.Memory(),
+		Evicted:   o.Evicted(),
+		NamesNode: make([]int, o.maxNamesNode()+1),
+		// overflows
+		EvictedBlocks: o.EvictedBlocks(),
+		EvictedNames:  o.EvictedNames(),
+		Overflows:     o.Overflows(),
+		// negative answers
+		NXDomain: o.NXDomains(),
+		NoData:   o.NoDatas(),
+	}
+	for _, e := range o.clientList() {
+		client := e.client
+		st.Clients++
+		client.mu.RLock()
+		for _, b := range client.blocks {
+			st.Blocks++
+			b.mu.RLock()
+			for i := 0; i < b.next; i++ {
+				n := &b.nodes[i]
+				if n.name == "" {
+					continue
+				}
+				names := len(n.others) + 1
+				st.Nodes++
+				st.Names += names
+				if names > len(st.NamesNode) {
+					names = len(st.NamesNode)
+				}
+				st.NamesNode[names-1]++
+			}
+			b.mu.RUnlock()
+		}
+		client.mu.RUnlock()
+	}
+	return st
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// Store is the interface of the storage backends used by Service. Cache
+// is the default store, in memory. Stores implementing io.Closer are
+// closed on shutdown of the service.
+type Store interface {
+	// Set stores the names resolved by the client.
+	Set(ts time.Time, client net.IP, name string, resolved []net.IP) error
+	// Get returns true and the last resolution if the client resolved the
+	// ip and the name, name can be empty.
+	Get(client, resolved net.IP, name string) (bool, time.Time)
+	// Clean removes expired items.
+	Clean()
+	// Flush removes all items.
+	Flush()
+	// Dump writes the content of the store in text format.
+	Dump(out io.Writer)
+	// Stats returns usage information.
+	Stats() Stats
+	// Expires, SetExpires and Flushed manage the expiration of items.
+	Expires() time.Duration
+	SetExpires(d time.Duration)
+	Flushed() time.Time
+}
+
+// Inserter is implemented by stores that keep the cnames and the ttls of
+// the resolutions. Stores that don't implement it only store the name and
+// the cnames with Set.
+type Inserter interface {
+	Insert(ts time.Time, r Resolution) error
+}
+
+// TimeMatcher is implemented by stores that support match modes and checks
+// at a point in time. Stores that don't implement it only support exact
+// matches now.
+type TimeMatcher interface {
+	MatchAt(client, resolved net.IP, name string, mode MatchMode, at time.Time) Match
+}
+
+// BatchMatcher is implemented by stores that match checks in batches more
+// efficiently than one by one.
+type BatchMatcher interface {
+	MatchMany(cs []Check, mode MatchMode) []Match
+}
+
+// storeTime returns the time from which the store has data.
+func storeTime(st Store) time.Time {
+	flushed, expires := st.Flushed(), st.Expires()
+	if time.Since(flushed) < expires {
+		return flushed
+	}
+	return time.Now().Add(-expires)
+}
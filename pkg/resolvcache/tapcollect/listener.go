@@ -0,0 +1,214 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package tapcollect implements a listener that collects the resolutions
+// sent by dns servers in dnstap frame streams.
+//
+// Servers connect to the listener socket using the bidirectional frame
+// stream protocol. Messages of type CLIENT_RESPONSE with answers to A or
+// AAAA queries are collected, the client is the query address of the
+// message and the resolution is stored with the response time. Messages of
+// type RESOLVER_RESPONSE are only collected if the option ResolverResponses
+// is set.
+package tapcollect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// Collector is the interface of the resolv cache that receives the
+// resolutions with the time of the response.
+type Collector interface {
+	CollectAt(ctx context.Context, ts time.Time, r resolvcache.Resolution) error
+}
+
+// Listener collects the resolutions of the dnstap connections.
+type Listener struct {
+	opts      options
+	logger    yalogi.Logger
+	collector Collector
+
+	mu     sync.Mutex
+	lis    net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Option is used for component configuration.
+type Option func(*options)
+
+type options struct {
+	logger   yalogi.Logger
+	timeout  time.Duration
+	resolver bool
+}
+
+var defaultOptions = options{
+	logger:  yalogi.LogNull,
+	timeout: 10 * time.Second,
+}
+
+// SetLogger option allows set a custom logger.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
+}
+
+// SetTimeout option sets the timeout of the handshake of the connections.
+func SetTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// ResolverResponses option enables the collection of RESOLVER_RESPONSE
+// messages, the answers received by the server from upstream servers. The
+// query address of these messages is the server itself, so resolutions are
+// stored with the server as client. It's disabled by default.
+func ResolverResponses(b bool) Option {
+	return func(o *options) {
+		o.resolver = b
+	}
+}
+
+// ErrClosed is returned by Serve when the listener is closed.
+var ErrClosed = errors.New("tapcollect: listener closed")
+
+// New creates a new Listener.
+func New(c Collector, opt ...Option) *Listener {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Listener{
+		opts:      opts,
+		logger:    opts.logger,
+		collector: c,
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections and collects the resolutions until the
+// listener is closed.
+func (l *Listener) Serve(lis net.Listener) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		lis.Close()
+		return ErrClosed
+	}
+	l.lis = lis
+	l.mu.Unlock()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				l.logger.Warnf("dnstap: accepting connection: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return ErrClosed
+		}
+		l.conns[conn] = struct{}{}
+		l.wg.Add(1)
+		l.mu.Unlock()
+		go l.handle(conn)
+	}
+}
+
+// Close stops the listener and closes the connections.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	var err error
+	if l.lis != nil {
+		err = l.lis.Close()
+	}
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return err
+}
+
+func (l *Listener) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		l.wg.Done()
+	}()
+	remote := conn.RemoteAddr().String()
+	dec, err := framestream.NewDecoder(conn, &framestream.DecoderOptions{
+		MaxPayloadSize: dnstap.MaxPayloadSize,
+		ContentType:    dnstap.FSContentType,
+		Bidirectional:  true,
+		Timeout:        l.opts.timeout,
+	})
+	if err != nil {
+		l.logger.Warnf("dnstap: [remote=%s] handshake: %v", remote, err)
+		return
+	}
+	l.logger.Debugf("dnstap: [remote=%s] connection accepted", remote)
+	for {
+		frame, err := dec.Decode()
+		if err != nil {
+			if err != io.EOF && !l.isClosed() {
+				l.logger.Warnf("dnstap: [remote=%s] decoding: %v", remote, err)
+			}
+			return
+		}
+		r, ts, ok, err := parseFrame(frame, l.opts.resolver)
+		if err != nil {
+			l.logger.Debugf("dnstap: [remote=%s] parsing message: %v", remote, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		err = l.collector.CollectAt(context.Background(), ts, r)
+		if err != nil {
+			l.logger.Debugf("dnstap: [remote=%s] collecting '%v,%s,%v,%v': %v", remote, r.Client, r.Name, r.Resolved, r.CNAMEs, err)
+		}
+	}
+}
+
+func (l *Listener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
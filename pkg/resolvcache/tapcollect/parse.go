@@ -0,0 +1,81 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package tapcollect
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+
+	"github.com/luids-io/dns/pkg/resolvcache"
+)
+
+// parseFrame returns the resolution of the dnstap frame and its response
+// time, zero if the message doesn't include it. It returns false if the
+// message is not a client response with resolved ips, or a resolver response
+// if resolver is true.
+func parseFrame(frame []byte, resolver bool) (resolvcache.Resolution, time.Time, bool, error) {
+	var r resolvcache.Resolution
+	var ts time.Time
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(frame, dt); err != nil {
+		return r, ts, false, err
+	}
+	if dt.GetType() != dnstap.Dnstap_MESSAGE || dt.GetMessage() == nil {
+		return r, ts, false, nil
+	}
+	m := dt.GetMessage()
+	switch m.GetType() {
+	case dnstap.Message_CLIENT_RESPONSE:
+	case dnstap.Message_RESOLVER_RESPONSE:
+		if !resolver {
+			return r, ts, false, nil
+		}
+	default:
+		return r, ts, false, nil
+	}
+	client := net.IP(m.GetQueryAddress())
+	if len(client) != net.IPv4len && len(client) != net.IPv6len {
+		return r, ts, false, errors.New("invalid query address")
+	}
+	if len(m.GetResponseMessage()) == 0 {
+		return r, ts, false, errors.New("response message is empty")
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(m.GetResponseMessage()); err != nil {
+		return r, ts, false, err
+	}
+	if msg.Rcode != dns.RcodeSuccess || len(msg.Question) == 0 {
+		return r, ts, false, nil
+	}
+	q := msg.Question[0]
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeAAAA {
+		return r, ts, false, nil
+	}
+	// gets IPs and CNAMEs from answer
+	for _, a := range msg.Answer {
+		if rsp, ok := a.(*dns.A); ok {
+			r.Resolved = append(r.Resolved, rsp.A)
+			r.TTLs = append(r.TTLs, time.Duration(rsp.Hdr.Ttl)*time.Second)
+		} else if rsp, ok := a.(*dns.AAAA); ok {
+			r.Resolved = append(r.Resolved, rsp.AAAA)
+			r.TTLs = append(r.TTLs, time.Duration(rsp.Hdr.Ttl)*time.Second)
+		} else if rsp, ok := a.(*dns.CNAME); ok {
+			r.CNAMEs = append(r.CNAMEs, strings.TrimSuffix(rsp.Target, "."))
+		}
+	}
+	if len(r.Resolved) == 0 {
+		return r, ts, false, nil
+	}
+	r.Client = client
+	r.Name = strings.TrimSuffix(q.Name, ".")
+	if m.ResponseTimeSec != nil {
+		ts = time.Unix(int64(m.GetResponseTimeSec()), int64(m.GetResponseTimeNsec()))
+	}
+	return r, ts, true, nil
+}
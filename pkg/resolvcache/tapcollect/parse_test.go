@@ -0,0 +1,92 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package tapcollect
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+)
+
+// testTime is the response time of the test frames
+var testTime = time.Date(2021, 3, 1, 10, 0, 0, 500, time.UTC)
+
+func testFrame(t *testing.T, mtype dnstap.Message_Type, rcode int) []byte {
+	t.Helper()
+	msg := &dns.Msg{}
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	msg.Rcode = rcode
+	msg.Answer = append(msg.Answer,
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300}, Target: "edge.example.net."},
+		&dns.A{Hdr: dns.RR_Header{Name: "edge.example.net.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP("192.0.2.1").To4()})
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dtype := dnstap.Dnstap_MESSAGE
+	secs, nsecs := uint64(testTime.Unix()), uint32(testTime.Nanosecond())
+	frame, err := proto.Marshal(&dnstap.Dnstap{
+		Type: &dtype,
+		Message: &dnstap.Message{
+			Type:             &mtype,
+			QueryAddress:     net.ParseIP("10.0.0.1").To4(),
+			ResponseMessage:  packed,
+			ResponseTimeSec:  &secs,
+			ResponseTimeNsec: &nsecs,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		mtype    dnstap.Message_Type
+		rcode    int
+		resolver bool
+		want     bool
+	}{
+		{"client response", dnstap.Message_CLIENT_RESPONSE, dns.RcodeSuccess, false, true},
+		{"resolver response", dnstap.Message_RESOLVER_RESPONSE, dns.RcodeSuccess, false, false},
+		{"resolver response enabled", dnstap.Message_RESOLVER_RESPONSE, dns.RcodeSuccess, true, true},
+		{"client query", dnstap.Message_CLIENT_QUERY, dns.RcodeSuccess, true, false},
+		{"forwarder response", dnstap.Message_FORWARDER_RESPONSE, dns.RcodeSuccess, true, false},
+		{"nxdomain", dnstap.Message_CLIENT_RESPONSE, dns.RcodeNameError, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ts, ok, err := parseFrame(testFrame(t, tt.mtype, tt.rcode), tt.resolver)
+			if err != nil {
+				t.Fatalf("parseFrame() error = %v", err)
+			}
+			if ok != tt.want {
+				t.Fatalf("parseFrame() = %v, want %v", ok, tt.want)
+			}
+			if !ok {
+				return
+			}
+			if !ts.Equal(testTime) {
+				t.Errorf("response time = %v, want %v", ts, testTime)
+			}
+			if !r.Client.Equal(net.ParseIP("10.0.0.1")) || r.Name != "www.example.com" {
+				t.Errorf("resolution = %v %v", r.Client, r.Name)
+			}
+			if len(r.Resolved) != 1 || !r.Resolved[0].Equal(net.ParseIP("192.0.2.1")) || r.TTLs[0].Seconds() != 60 {
+				t.Errorf("resolved = %v %v", r.Resolved, r.TTLs)
+			}
+			if len(r.CNAMEs) != 1 || r.CNAMEs[0] != "edge.example.net" {
+				t.Errorf("cnames = %v", r.CNAMEs)
+			}
+		})
+	}
+	if _, _, _, err := parseFrame([]byte("garbage"), false); err == nil {
+		t.Errorf("parseFrame(garbage) without error")
+	}
+}
@@ -49,7 +49,7 @@ type logData struct {
 	op       opType
 	peer     *peer.Peer
 	ts       time.Time
-	client   net.IP
+	client   *net.IPNet
 	name     string
 	resolved []net.IP
 	cnames   []string
@@ -57,12 +57,15 @@ type logData struct {
 }
 
 func (data *logData) String() string {
-	client := data.client.String()
+	client := data.client.IP.String()
+	if ones, bits := data.client.Mask.Size(); ones < bits {
+		client = data.client.String()
+	}
 	peerinfo := ""
 	if data.peer != nil {
 		peerinfo = data.peer.Addr.String()
 	}
-	tstamp := data.ts.Format("20060102150405")
+	tstamp := data.ts.Format(tsFormat)
 	switch data.op {
 	case opCollect:
 		resolved := make([]string, 0, len(data.resolved))
@@ -91,7 +94,7 @@ func NewFile(fname string) (*File, error) {
 }
 
 // LogCollect implements resolvcache.TraceLogger.
-func (f *File) LogCollect(peer *peer.Peer, ts time.Time, client net.IP, name string, resolved []net.IP, cnames []string) error {
+func (f *File) LogCollect(peer *peer.Peer, ts time.Time, client *net.IPNet, name string, resolved []net.IP, cnames []string) error {
 	if f.closed {
 		return errors.New("tracelog: log is closed")
 	}
@@ -108,7 +111,7 @@ func (f *File) LogCollect(peer *peer.Peer, ts time.Time, client net.IP, name str
 }
 
 // LogCheck implements resolvcache.TraceLogger.
-func (f *File) LogCheck(peer *peer.Peer, ts time.Time, client, resolved net.IP, name string, resp dnsutil.CacheResponse) error {
+func (f *File) LogCheck(peer *peer.Peer, ts time.Time, client *net.IPNet, resolved net.IP, name string, resp dnsutil.CacheResponse) error {
 	if f.closed {
 		return errors.New("tracelog: log is closed")
 	}
@@ -0,0 +1,122 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package tracelog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Collect stores a collect operation read from a trace log. Client is the
+// network used by the cache for the client and Peer is empty if unknown.
+type Collect struct {
+	Ts       time.Time
+	Peer     string
+	Client   *net.IPNet
+	Name     string
+	Resolved []net.IP
+	CNAMEs   []string
+}
+
+// tsFormat is the format of the timestamps, in local time.
+const tsFormat = "20060102150405"
+
+// ReadCollects reads a trace log and calls fn for each collect operation
+// until it returns false. Check operations are ignored and invalid lines
+// are skipped. It returns the number of invalid lines.
+func ReadCollects(in io.Reader, fn func(Collect) bool) (int, error) {
+	invalid := 0
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 || fields[1] != "collect" {
+			if len(fields) < 2 || fields[1] != "check" {
+				invalid++
+			}
+			continue
+		}
+		c, err := parseCollect(fields)
+		if err != nil {
+			invalid++
+			continue
+		}
+		if !fn(c) {
+			break
+		}
+	}
+	return invalid, scanner.Err()
+}
+
+var errInvalidLine = errors.New("tracelog: invalid line")
+
+// parseCollect parses the fields of a collect line: timestamp, operation,
+// peer, client, name, resolved ips and cnames.
+func parseCollect(fields []string) (Collect, error) {
+	var c Collect
+	if len(fields) < 6 {
+		return c, errInvalidLine
+	}
+	ts, err := time.ParseInLocation(tsFormat, fields[0], time.Local)
+	if err != nil {
+		return c, errInvalidLine
+	}
+	c.Ts = ts
+	c.Peer = fields[2]
+	c.Client = parseClient(fields[3])
+	if c.Client == nil {
+		return c, errInvalidLine
+	}
+	c.Name = fields[4]
+	if c.Name == "" {
+		return c, errInvalidLine
+	}
+	// resolved ips are followed by cnames
+	for _, field := range fields[5:] {
+		if field == "" {
+			continue
+		}
+		if ip := net.ParseIP(field); ip != nil && len(c.CNAMEs) == 0 {
+			c.Resolved = append(c.Resolved, ip)
+			continue
+		}
+		c.CNAMEs = append(c.CNAMEs, field)
+	}
+	if len(c.Resolved) == 0 {
+		return c, errInvalidLine
+	}
+	return c, nil
+}
+
+// parseClient returns the client ip with the mask of the network used by
+// the cache.
+func parseClient(s string) *net.IPNet {
+	var ip net.IP
+	var mask net.IPMask
+	if strings.Contains(s, "/") {
+		cip, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil
+		}
+		ip, mask = cip, network.Mask
+	} else {
+		ip = net.ParseIP(s)
+		if ip == nil {
+			return nil
+		}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if mask == nil {
+		mask = net.CIDRMask(len(ip)*8, len(ip)*8)
+	}
+	return &net.IPNet{IP: ip, Mask: mask}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package resolvcache
+
+import (
+	"time"
+)
+
+// ttlPolicy stores the values used for computing expiration from ttls
+type ttlPolicy struct {
+	enabled bool
+	grace   time.Duration
+	min     time.Duration
+}
+
+// HonourTTL option enables expiration of the records using the ttl of the
+// dns answers. Records expire after max(ttl+grace, min), capped at the
+// expiration of the cache. Records without ttl use cache expiration.
+func HonourTTL(grace, min time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttl = ttlPolicy{enabled: true, grace: grace, min: min}
+	}
+}
+
+// HonoursTTL returns true if the cache uses ttls for expiration.
+func (o *Cache) HonoursTTL() bool {
+	return o.ttl.enabled
+}
+
+// lifetime returns the time that a record with the ttl is stored.
+func (o *Cache) lifetime(ttl time.Duration) time.Duration {
+	expires := o.Expires()
+	if ttl <= 0 {
+		return expires
+	}
+	d := ttl + o.ttl.grace
+	if d < o.ttl.min {
+		d = o.ttl.min
+	}
+	if d > expires {
+		d = expires
+	}
+	return d
+}
+
+// valid returns true if item is not expired.
+func (o *Cache) valid(i item, now time.Time) bool {
+	_, ok := o.itemAt(i, now)
+	return ok
+}
+
+// match returns the match for the item at the time.
+func (o *Cache) match(i item, at time.Time) Match {
+	return Match{
+		Result: true,
+		Since:  i.since,
+		Last:   i.ts,
+		Store:  o.Store(),
+		TTL:    i.ttl,
+		InTTL:  i.ttl > 0 && at.Sub(i.ts) <= i.ttl,
+		Name:   i.name,
+		Chain:  i.chain,
+	}
+}